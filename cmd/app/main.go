@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path"
@@ -14,37 +15,58 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/Muscaw/GitFortress/internal/application/metrics"
+	"github.com/Muscaw/GitFortress/internal/interfaces/azuredevops"
+	"github.com/Muscaw/GitFortress/internal/interfaces/bitbucket"
+	"github.com/Muscaw/GitFortress/internal/interfaces/boltdb"
+	"github.com/Muscaw/GitFortress/internal/interfaces/gitea"
 	"github.com/Muscaw/GitFortress/internal/interfaces/gitlab"
 	"github.com/Muscaw/GitFortress/internal/interfaces/influx"
 	"github.com/Muscaw/GitFortress/internal/interfaces/prometheus"
+	"github.com/Muscaw/GitFortress/internal/interfaces/ratelimit"
+	"github.com/Muscaw/GitFortress/internal/interfaces/static"
+	"github.com/Muscaw/GitFortress/internal/interfaces/webhook"
 	"github.com/rs/zerolog"
 
 	"github.com/Muscaw/GitFortress/config"
 	"github.com/Muscaw/GitFortress/internal/application"
+	stateService "github.com/Muscaw/GitFortress/internal/domain/state/service"
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
 	"github.com/Muscaw/GitFortress/internal/interfaces/github"
 	"github.com/Muscaw/GitFortress/internal/interfaces/system_git"
 )
 
+// stateStoreFileName is the state store located at the root of the clone folder, next to the input folders
+const stateStoreFileName = "gitfortress.db"
+
 func init() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 }
 
-type Ticker struct {
-	ticker *time.Ticker
-}
-
-func (t *Ticker) C() <-chan time.Time {
-	return t.ticker.C
-}
+// apiClients holds the http client of every input, so that the input and its exporters share the same API quota
+var apiClients = map[string]*http.Client{}
 
-func (t *Ticker) Stop() {
-	t.ticker.Stop()
+// getAPIClient returns the rate limit aware http client sending the API requests of the input
+func getAPIClient(input *config.Input) *http.Client {
+	if client, found := apiClients[input.Name]; found {
+		return client
+	}
+	client := ratelimit.NewClient(ratelimit.TransportOpts{
+		Gauge: metrics.GetMetricsService().TrackGauge(fmt.Sprintf("api_rate_limit_%s", input.Name)),
+	})
+	apiClients[input.Name] = client
+	return client
 }
 
 func createGithubInputService(input *config.Input) service.VCS {
-	client, err := github.GetGithubVCS(input.TargetURL, input.APIToken)
+	client, err := github.GetGithubVCS(input.TargetURL, input.APIToken, github.GithubOpts{
+		Affiliations:  input.Affiliations,
+		Organizations: input.Organizations,
+		Teams:         input.Teams,
+		Wikis:         input.Wikis,
+		Gists:         input.Gists,
+		HTTPClient:    getAPIClient(input),
+	})
 	if err != nil {
 		panic(fmt.Errorf("could not start github client %w", err))
 	}
@@ -52,16 +74,87 @@ func createGithubInputService(input *config.Input) service.VCS {
 }
 
 func createGitlabInputService(input *config.Input) service.VCS {
-	client, err := gitlab.GetGitlabVCS(input.TargetURL, input.APIToken)
+	client, err := gitlab.GetGitlabVCS(input.TargetURL, input.APIToken, gitlab.GitlabOpts{Groups: input.Groups, Wikis: input.Wikis, HTTPClient: getAPIClient(input)})
 	if err != nil {
 		panic(fmt.Errorf("could not start gitlab client %w", err))
 	}
 	return client
 }
 
+func createGiteaInputService(input *config.Input) service.VCS {
+	client, err := gitea.GetGiteaVCS(input.TargetURL, input.APIToken, gitea.GiteaOpts{HTTPClient: getAPIClient(input)})
+	if err != nil {
+		panic(fmt.Errorf("could not start gitea client %w", err))
+	}
+	return client
+}
+
+func createBitbucketInputService(input *config.Input) service.VCS {
+	client, err := bitbucket.GetBitbucketCloudVCS(input.TargetURL, input.Username, input.APIToken, input.Workspaces, bitbucket.BitbucketOpts{HTTPClient: getAPIClient(input)})
+	if err != nil {
+		panic(fmt.Errorf("could not start bitbucket client %w", err))
+	}
+	return client
+}
+
+func createBitbucketServerInputService(input *config.Input) service.VCS {
+	client, err := bitbucket.GetBitbucketServerVCS(input.TargetURL, input.Username, input.APIToken, input.Projects, bitbucket.BitbucketOpts{HTTPClient: getAPIClient(input)})
+	if err != nil {
+		panic(fmt.Errorf("could not start bitbucket server client %w", err))
+	}
+	return client
+}
+
+func createAzureDevOpsInputService(input *config.Input) service.VCS {
+	client, err := azuredevops.GetAzureDevOpsVCS(input.TargetURL, input.APIToken, input.Projects, azuredevops.AzureDevOpsOpts{HTTPClient: getAPIClient(input)})
+	if err != nil {
+		panic(fmt.Errorf("could not start azure devops client %w", err))
+	}
+	return client
+}
+
+func toSSHKey(sshKey *config.SSHKeyConfig) *entity.SSHKey {
+	if sshKey == nil {
+		return nil
+	}
+	return &entity.SSHKey{PrivateKeyPath: sshKey.PrivateKeyPath, Passphrase: sshKey.Passphrase, KnownHostsPath: sshKey.KnownHostsPath}
+}
+
+func getInputAuthentication(input *config.Input) entity.Auth {
+	return entity.Auth{Username: input.Username, Token: input.APIToken, SSHKey: toSSHKey(input.SSHKey)}
+}
+
+func createStaticInputService(input *config.Input) service.VCS {
+	var repositories []static.Repository
+	for _, r := range input.Repositories {
+		authentication := getInputAuthentication(input)
+		if r.Username != "" || r.Token != "" {
+			authentication.Username = r.Username
+			authentication.Token = r.Token
+		}
+		// Static urls are explicit, so the ssh key only applies to ssh urls
+		if !entity.IsSshUrl(r.URL) {
+			authentication.SSHKey = nil
+		} else if r.SSHKey != nil {
+			authentication.SSHKey = toSSHKey(r.SSHKey)
+		}
+		repositories = append(repositories, static.Repository{Url: r.URL, Authentication: &authentication})
+	}
+	client, err := static.GetStaticVCS(repositories, getInputAuthentication(input))
+	if err != nil {
+		panic(fmt.Errorf("could not start static client %w", err))
+	}
+	return client
+}
+
 var typeToVCS = map[string]func(*config.Input) service.VCS{
-	"github": createGithubInputService,
-	"gitlab": createGitlabInputService,
+	"github":           createGithubInputService,
+	"gitlab":           createGitlabInputService,
+	"gitea":            createGiteaInputService,
+	"bitbucket":        createBitbucketInputService,
+	"bitbucket-server": createBitbucketServerInputService,
+	"azuredevops":      createAzureDevOpsInputService,
+	"static":           createStaticInputService,
 }
 
 func createInputService(input *config.Input) service.VCS {
@@ -72,21 +165,229 @@ func createInputService(input *config.Input) service.VCS {
 	return val(input)
 }
 
-func startSynchronizationProcess(ctx context.Context, delay time.Duration, wg *sync.WaitGroup, cfg *config.Config, input *config.Input) {
+// getRemoteHosts returns the hosts of the urls configured for the input. Remotes of local repositories pointing to these hosts are accepted
+func getRemoteHosts(input *config.Input) []string {
+	urls := []string{input.TargetURL}
+	for _, r := range input.Repositories {
+		urls = append(urls, r.URL)
+	}
+	var hosts []string
+	for _, u := range urls {
+		if u == "" {
+			continue
+		}
+		host, err := entity.GetUrlHost(u)
+		if err != nil {
+			panic(fmt.Errorf("could not parse url %v for %v: %w", u, input.Name, err))
+		}
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// parseDuration returns 0 for an empty duration, meaning forever for retentions
+func parseDuration(inputName string, fieldName string, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Errorf("could not parse %v of %v: %w", fieldName, inputName, err))
+	}
+	return duration
+}
+
+// createExporters returns the exporters enabled for the input
+func createExporters(input *config.Input) []service.RepositoryExporter {
+	var exporters []service.RepositoryExporter
+	if input.ExportMetadata && input.Type == "github" {
+		exporter, err := github.GetGithubMetadataExporter(input.TargetURL, input.APIToken, getAPIClient(input))
+		if err != nil {
+			panic(fmt.Errorf("could not start github metadata exporter %w", err))
+		}
+		exporters = append(exporters, exporter)
+	}
+	if input.ExportMetadata && input.Type == "gitlab" {
+		exporter, err := gitlab.GetGitlabMetadataExporter(input.TargetURL, input.APIToken, getAPIClient(input))
+		if err != nil {
+			panic(fmt.Errorf("could not start gitlab metadata exporter %w", err))
+		}
+		exporters = append(exporters, exporter)
+	}
+	if input.ExportReleases && input.Type == "github" {
+		exporter, err := github.GetGithubReleasesExporter(input.TargetURL, input.APIToken, getAPIClient(input))
+		if err != nil {
+			panic(fmt.Errorf("could not start github releases exporter %w", err))
+		}
+		exporters = append(exporters, exporter)
+	}
+	if input.ExportReleases && input.Type == "gitlab" {
+		exporter, err := gitlab.GetGitlabReleasesExporter(input.TargetURL, input.APIToken, getAPIClient(input))
+		if err != nil {
+			panic(fmt.Errorf("could not start gitlab releases exporter %w", err))
+		}
+		exporters = append(exporters, exporter)
+	}
+	if input.ExportSettings && input.Type == "github" {
+		exporter, err := github.GetGithubSettingsExporter(input.TargetURL, input.APIToken, getAPIClient(input))
+		if err != nil {
+			panic(fmt.Errorf("could not start github settings exporter %w", err))
+		}
+		exporters = append(exporters, exporter)
+	}
+	if input.ExportSettings && input.Type == "gitlab" {
+		exporter, err := gitlab.GetGitlabSettingsExporter(input.TargetURL, input.APIToken, getAPIClient(input))
+		if err != nil {
+			panic(fmt.Errorf("could not start gitlab settings exporter %w", err))
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters
+}
+
+func createRepositoryRules(inputName string, rules []config.RepositoryRule) []application.RepositoryRule {
+	var repositoryRules []application.RepositoryRule
+	for _, r := range rules {
+		var visibilities []entity.Visibility
+		for _, v := range r.Visibility {
+			visibilities = append(visibilities, entity.Visibility(v))
+		}
+		repositoryRules = append(repositoryRules, application.RepositoryRule{
+			Fork:         r.Fork,
+			Archived:     r.Archived,
+			Visibilities: visibilities,
+			MinSizeKB:    r.MinSizeKB,
+			MaxSizeKB:    r.MaxSizeKB,
+			Topics:       r.Topics,
+			Languages:    r.Languages,
+			InactiveFor:  parseDuration(inputName, "inactiveFor", r.InactiveFor),
+			ActiveWithin: parseDuration(inputName, "activeWithin", r.ActiveWithin),
+		})
+	}
+	return repositoryRules
+}
+
+// createRepositoryFilter returns the filter selecting the repositories of the input to clone
+func createRepositoryFilter(input *config.Input) application.RepositoryFilter {
+	var includeRegexes []*regexp.Regexp
+	for _, i := range input.IncludeRepositoriesRegex {
+		includeRegexes = append(includeRegexes, regexp.MustCompile(i))
+	}
+	return application.RepositoryFilter{
+		IncludeRegexes: includeRegexes,
+		Include:        createRepositoryRules(input.Name, input.IncludeRepositories),
+		Exclude:        createRepositoryRules(input.Name, input.ExcludeRepositories),
+	}
+}
+
+// defaultRetry is used by inputs without retry: repositories are tried once per run and never quarantined
+var defaultRetry = config.RetryConfig{Attempts: 1, QuarantineAfter: 0}
+
+// createRetryOpts returns how the failed repositories of the input are retried. Backoff defaults to 10s and quarantine
+// interval to 24h
+func createRetryOpts(input *config.Input) application.RetryOpts {
+	retry := defaultRetry
+	if input.Retry != nil {
+		retry = *input.Retry
+	}
+	options := application.RetryOpts{
+		Attempts:           retry.Attempts,
+		Backoff:            10 * time.Second,
+		QuarantineAfter:    retry.QuarantineAfter,
+		QuarantineInterval: 24 * time.Hour,
+	}
+	if retry.Backoff != "" {
+		options.Backoff = parseDuration(input.Name, "retry backoff", retry.Backoff)
+	}
+	if retry.QuarantineInterval != "" {
+		options.QuarantineInterval = parseDuration(input.Name, "retry quarantineInterval", retry.QuarantineInterval)
+	}
+	return options
+}
+
+// createScheduleOpts returns the schedule of the input, running every syncDelay when the input does not set any
+func createScheduleOpts(input *config.Input, delay time.Duration) application.ScheduleOpts {
+	if input.Schedule == nil {
+		return application.ScheduleOpts{Schedule: application.IntervalSchedule{Interval: delay}}
+	}
+	var options application.ScheduleOpts
+	if input.Schedule.Cron != "" {
+		schedule, err := application.ParseCronSchedule(input.Schedule.Cron)
+		if err != nil {
+			panic(fmt.Errorf("could not parse schedule cron of %v: %w", input.Name, err))
+		}
+		options.Schedule = schedule
+	} else {
+		options.Schedule = application.IntervalSchedule{Interval: parseDuration(input.Name, "schedule interval", input.Schedule.Interval)}
+	}
+	options.Jitter = parseDuration(input.Name, "schedule jitter", input.Schedule.Jitter)
+	for _, w := range input.Schedule.MaintenanceWindows {
+		start, err := application.ParseCronSchedule(w.Cron)
+		if err != nil {
+			panic(fmt.Errorf("could not parse maintenance window cron of %v: %w", input.Name, err))
+		}
+		options.MaintenanceWindows = append(options.MaintenanceWindows, application.MaintenanceWindow{Start: start, Duration: parseDuration(input.Name, "maintenance window duration", w.Duration)})
+	}
+	return options
+}
+
+// startSynchronizationProcess synchronizes the input following its schedule. The queue, if any, receives the
+// synchronizations requested by webhooks
+func startSynchronizationProcess(ctx context.Context, delay time.Duration, wg *sync.WaitGroup, cfg *config.Config, input *config.Input, limiter *application.ConcurrencyLimiter, stateStore stateService.StateStore, queue *application.SyncQueue) {
 	client := createInputService(input)
 	localInputCloneFolder := path.Join(cfg.CloneFolderPath, input.Name)
 	err := os.MkdirAll(localInputCloneFolder, os.ModePerm)
 	if err != nil {
 		panic(fmt.Errorf("could not create local clone folder for %v. path is %v", input.Name, localInputCloneFolder))
 	}
-	localGit := system_git.GetLocalGit(localInputCloneFolder, entity.Auth{Token: input.APIToken})
+	var authentication service.RemoteAuthenticationProvider = getInputAuthentication(input)
+	if provider, ok := client.(service.RemoteAuthenticationProvider); ok {
+		authentication = provider
+	}
+	localGitOptions := system_git.LocalGitOpts{
+		CloneDirectory:         localInputCloneFolder,
+		Authentication:         authentication,
+		RemoteHosts:            getRemoteHosts(input),
+		Layout:                 input.Layout,
+		PreservedRefsRetention: parseDuration(input.Name, "preservedRefsRetention", input.PreservedRefsRetention),
+		LFS:                    input.LFS,
+		HTTPClient:             getAPIClient(input),
+	}
+	if err := system_git.MigrateToLayout(localGitOptions); err != nil {
+		log.Err(err).Msgf("could not migrate repositories of %v to the configured layout", input.Name)
+	}
+	localGit := system_git.GetLocalGit(localGitOptions)
+
+	exporters := createExporters(input)
+	filter := createRepositoryFilter(input)
 
 	var ignoredRepositoriesRegex []*regexp.Regexp
 	for _, i := range input.IgnoreRepositoriesRegex {
 		ignoredRepositoriesRegex = append(ignoredRepositoriesRegex, regexp.MustCompile(i))
 	}
-	go application.ScheduleEvery(wg, &Ticker{time.NewTicker(delay)}, ctx, func() {
-		application.SynchronizeRepos(ctx, input.Name, ignoredRepositoriesRegex, localGit, client)
+	synchronizationOptions := application.SynchronizationOpts{
+		Concurrency:      input.Concurrency,
+		Limiter:          limiter,
+		SkipUnchanged:    input.SkipUnchanged,
+		StateStore:       stateStore,
+		ArchiveOrphaned:  input.ArchiveOrphaned,
+		ArchiveRetention: parseDuration(input.Name, "archiveRetention", input.ArchiveRetention),
+		Exporters:        exporters,
+		Filter:           filter,
+		Retry:            createRetryOpts(input),
+	}
+	inputName := input.Name
+	scheduleOptions := createScheduleOpts(input, delay)
+	if queue != nil {
+		scheduleOptions.Queue = queue
+		scheduleOptions.SynchronizeRepositories = func(repositories []entity.Repository) {
+			application.SynchronizeRepositories(ctx, inputName, ignoredRepositoriesRegex, localGit, client, repositories, synchronizationOptions)
+		}
+	}
+	go application.RunScheduled(ctx, wg, scheduleOptions, func() {
+		application.SynchronizeRepos(ctx, inputName, ignoredRepositoriesRegex, localGit, client, synchronizationOptions)
 	})
 
 }
@@ -141,8 +442,37 @@ func main() {
 		panic(fmt.Errorf("could not proceed. clone folder path is not a directory: %v", cfg.CloneFolderPath))
 	}
 
+	stateStore, err := boltdb.OpenStateStore(boltdb.StateStoreOpts{Path: path.Join(cfg.CloneFolderPath, stateStoreFileName)})
+	if err != nil {
+		panic(err)
+	}
+	defer stateStore.Close()
+
+	var limiter *application.ConcurrencyLimiter
+	if cfg.MaxConcurrency > 0 {
+		limiter = application.NewConcurrencyLimiter(cfg.MaxConcurrency)
+	}
+	var endpoints []webhook.Endpoint
 	for _, input := range cfg.Inputs {
-		startSynchronizationProcess(ctx, delay, &wg, &cfg, &input)
+		var queue *application.SyncQueue
+		if input.WebhookSecret != "" {
+			queue = application.NewSyncQueue()
+			endpoints = append(endpoints, webhook.Endpoint{
+				InputName: input.Name,
+				InputType: input.Type,
+				Secret:    input.WebhookSecret,
+				Requester: queue,
+				Gauge:     metricsService.TrackGauge(fmt.Sprintf("webhooks_%s", input.Name)),
+			})
+		}
+		startSynchronizationProcess(ctx, delay, &wg, &cfg, &input, limiter, stateStore, queue)
+	}
+	if cfg.Webhooks != nil {
+		handler, err := webhook.NewHandler(endpoints)
+		if err != nil {
+			panic(fmt.Errorf("could not create webhook handler: %w", err))
+		}
+		webhook.Start(ctx, &wg, cfg.Webhooks.ListenAddress, handler)
 	}
 
 	done := make(chan os.Signal, 1)
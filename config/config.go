@@ -4,20 +4,211 @@ import (
 	"fmt"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	stateService "github.com/Muscaw/GitFortress/internal/domain/state/service"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
 )
 
+type SSHKeyConfig struct {
+	PrivateKeyPath string
+	Passphrase     string
+	KnownHostsPath string
+}
+
+func (k *SSHKeyConfig) Validate() error {
+	if k.PrivateKeyPath == "" {
+		return fmt.Errorf("sshKey privateKeyPath must be set")
+	}
+	return nil
+}
+
+type StaticRepository struct {
+	URL      string
+	Username string
+	Token    string
+	SSHKey   *SSHKeyConfig
+}
+
+func (r *StaticRepository) Validate() error {
+	if r.URL == "" {
+		return fmt.Errorf("static repository url must be set")
+	}
+	if !entity.IsHttpUrl(r.URL) && !entity.IsSshUrl(r.URL) {
+		return fmt.Errorf("static repository url must be an HTTP/HTTPS or SSH url: %v", r.URL)
+	}
+	if r.SSHKey != nil {
+		if err := r.SSHKey.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepositoryRule matches repositories on the attributes reported by github and gitlab inputs
+type RepositoryRule struct {
+	Fork         *bool
+	Archived     *bool
+	Visibility   []string
+	MinSizeKB    int64
+	MaxSizeKB    int64
+	Topics       []string
+	Languages    []string
+	InactiveFor  string
+	ActiveWithin string
+}
+
+var supportedVisibilities = []string{string(entity.VisibilityPublic), string(entity.VisibilityPrivate), string(entity.VisibilityInternal)}
+
+func (r *RepositoryRule) Validate() error {
+	for _, v := range r.Visibility {
+		if !slices.Contains(supportedVisibilities, v) {
+			return fmt.Errorf("repository rule visibility is not supported: %v. List of supported visibilities: %v", v, supportedVisibilities)
+		}
+	}
+	if r.MinSizeKB < 0 || r.MaxSizeKB < 0 {
+		return fmt.Errorf("repository rule sizes can not be negative")
+	}
+	if r.MaxSizeKB > 0 && r.MinSizeKB > r.MaxSizeKB {
+		return fmt.Errorf("repository rule minSizeKB can not be greater than maxSizeKB")
+	}
+	if r.InactiveFor != "" {
+		if duration, err := time.ParseDuration(r.InactiveFor); err != nil || duration <= 0 {
+			return fmt.Errorf("repository rule inactiveFor must be a positive duration: %v", r.InactiveFor)
+		}
+	}
+	if r.ActiveWithin != "" {
+		if duration, err := time.ParseDuration(r.ActiveWithin); err != nil || duration <= 0 {
+			return fmt.Errorf("repository rule activeWithin must be a positive duration: %v", r.ActiveWithin)
+		}
+	}
+	return nil
+}
+
+type MaintenanceWindowConfig struct {
+	Cron     string
+	Duration string
+}
+
+func (w *MaintenanceWindowConfig) Validate() error {
+	if _, err := cron.ParseStandard(w.Cron); err != nil {
+		return fmt.Errorf("maintenance window cron is invalid: %v: %w", w.Cron, err)
+	}
+	if duration, err := time.ParseDuration(w.Duration); err != nil || duration <= 0 {
+		return fmt.Errorf("maintenance window duration must be a positive duration: %v", w.Duration)
+	}
+	return nil
+}
+
+// ScheduleConfig replaces the global syncDelay for an input
+type ScheduleConfig struct {
+	Interval           string
+	Cron               string
+	Jitter             string
+	MaintenanceWindows []MaintenanceWindowConfig
+}
+
+func (s *ScheduleConfig) Validate() error {
+	if (s.Interval == "") == (s.Cron == "") {
+		return fmt.Errorf("schedule must set either an interval or a cron expression")
+	}
+	if s.Interval != "" {
+		if interval, err := time.ParseDuration(s.Interval); err != nil || interval <= 0 {
+			return fmt.Errorf("schedule interval must be a positive duration: %v", s.Interval)
+		}
+	}
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return fmt.Errorf("schedule cron is invalid: %v: %w", s.Cron, err)
+		}
+	}
+	if s.Jitter != "" {
+		if jitter, err := time.ParseDuration(s.Jitter); err != nil || jitter < 0 {
+			return fmt.Errorf("schedule jitter must be a positive duration: %v", s.Jitter)
+		}
+	}
+	for _, w := range s.MaintenanceWindows {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RetryConfig tells how failed repositories are retried. Inputs without retry use the default values
+type RetryConfig struct {
+	Attempts           int
+	Backoff            string
+	QuarantineAfter    int
+	QuarantineInterval string
+}
+
+func (r *RetryConfig) Validate() error {
+	if r.Attempts < 0 {
+		return fmt.Errorf("retry attempts can not be negative: %v", r.Attempts)
+	}
+	// Quarantines are decided from the attempts kept for every repository in the state store
+	if r.QuarantineAfter < 0 || r.QuarantineAfter > stateService.KeptAttemptsPerRepository {
+		return fmt.Errorf("retry quarantineAfter must be between 0 and %v: %v", stateService.KeptAttemptsPerRepository, r.QuarantineAfter)
+	}
+	if r.Backoff != "" {
+		if backoff, err := time.ParseDuration(r.Backoff); err != nil || backoff < 0 {
+			return fmt.Errorf("retry backoff must be a positive duration: %v", r.Backoff)
+		}
+	}
+	if r.QuarantineInterval != "" {
+		if interval, err := time.ParseDuration(r.QuarantineInterval); err != nil || interval < 0 {
+			return fmt.Errorf("retry quarantineInterval must be a positive duration: %v", r.QuarantineInterval)
+		}
+	}
+	return nil
+}
+
 type Input struct {
-	Name                    string
-	Type                    string
-	TargetURL               string
-	APIToken                string
-	IgnoreRepositoriesRegex []string
+	Name                     string
+	Type                     string
+	TargetURL                string
+	Username                 string
+	APIToken                 string
+	SSHKey                   *SSHKeyConfig
+	Workspaces               []string
+	Projects                 []string
+	Repositories             []StaticRepository
+	Affiliations             []string
+	Organizations            []string
+	Teams                    []string
+	Groups                   []string
+	Layout                   string
+	Concurrency              int
+	SkipUnchanged            bool
+	ArchiveOrphaned          bool
+	ArchiveRetention         string
+	PreservedRefsRetention   string
+	LFS                      bool
+	Wikis                    bool
+	Gists                    bool
+	ExportMetadata           bool
+	ExportReleases           bool
+	ExportSettings           bool
+	IgnoreRepositoriesRegex  []string
+	IncludeRepositoriesRegex []string
+	IncludeRepositories      []RepositoryRule
+	ExcludeRepositories      []RepositoryRule
+	Schedule                 *ScheduleConfig
+	WebhookSecret            string
+	Retry                    *RetryConfig
 }
 
-var supportedInputTypes = []string{"github", "gitlab"}
+var supportedInputTypes = []string{"github", "gitlab", "gitea", "bitbucket", "bitbucket-server", "azuredevops", "static"}
+
+// supportedWebhookInputTypes are the input types whose push events are parsed by the webhook server
+var supportedWebhookInputTypes = []string{"github", "gitlab", "gitea"}
+
+var supportedGithubAffiliations = []string{"owner", "collaborator", "organization_member"}
 
 func isInputTypeSupported(inputType string) bool {
 	for _, t := range supportedInputTypes {
@@ -28,6 +219,51 @@ func isInputTypeSupported(inputType string) bool {
 	return false
 }
 
+func isGithubAffiliationSupported(affiliation string) bool {
+	for _, a := range supportedGithubAffiliations {
+		if a == affiliation {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Input) validateGithubTargets() error {
+	if i.Type != "github" {
+		if len(i.Affiliations) > 0 || len(i.Organizations) > 0 || len(i.Teams) > 0 {
+			return fmt.Errorf("input affiliations, organizations and teams are only supported by github inputs")
+		}
+		return nil
+	}
+	for _, a := range i.Affiliations {
+		if !isGithubAffiliationSupported(a) {
+			return fmt.Errorf("input affiliation is not supported: %v. List of supported affiliations: %v", a, supportedGithubAffiliations)
+		}
+	}
+	for _, t := range i.Teams {
+		if organization, team, found := strings.Cut(t, "/"); !found || organization == "" || team == "" {
+			return fmt.Errorf("input team must be in the organization/team-slug format: %v", t)
+		}
+	}
+	return nil
+}
+
+func (i *Input) validateRepositoryRules() error {
+	rules := append(slices.Clone(i.IncludeRepositories), i.ExcludeRepositories...)
+	if len(rules) > 0 && i.Type != "github" && i.Type != "gitlab" {
+		return fmt.Errorf("input includeRepositories and excludeRepositories are only supported by github and gitlab inputs")
+	}
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if len(r.Languages) > 0 && i.Type != "github" {
+			return fmt.Errorf("repository rule languages are only supported by github inputs")
+		}
+	}
+	return nil
+}
+
 func (i *Input) Validate() error {
 	if i.Name == "" {
 		return fmt.Errorf("input name must be set")
@@ -35,11 +271,95 @@ func (i *Input) Validate() error {
 	if !isInputTypeSupported(i.Type) {
 		return fmt.Errorf("input type is not supported: %v. List of supported types: %v", i.Type, supportedInputTypes)
 	}
-	if i.TargetURL == "" {
-		return fmt.Errorf("input targetUrl must be set")
+	if i.Type == "static" {
+		if len(i.Repositories) == 0 {
+			return fmt.Errorf("input repositories must contain at least one repository for static inputs")
+		}
+		for _, r := range i.Repositories {
+			if err := r.Validate(); err != nil {
+				return err
+			}
+			if entity.IsSshUrl(r.URL) && r.SSHKey == nil && i.SSHKey == nil {
+				return fmt.Errorf("static repository %v uses ssh but no sshKey is configured", r.URL)
+			}
+		}
+	} else {
+		if i.TargetURL == "" {
+			return fmt.Errorf("input targetUrl must be set")
+		}
+		if i.APIToken == "" {
+			return fmt.Errorf("input apiToken must be set")
+		}
+		if len(i.Repositories) > 0 {
+			return fmt.Errorf("input repositories are only supported by static inputs")
+		}
+	}
+	if i.SSHKey != nil {
+		if err := i.SSHKey.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := i.validateGithubTargets(); err != nil {
+		return err
+	}
+	if i.Layout != "" && !strings.Contains(i.Layout, "{repo}") {
+		return fmt.Errorf("input layout must contain the {repo} placeholder: %v", i.Layout)
+	}
+	if i.ArchiveRetention != "" {
+		if retention, err := time.ParseDuration(i.ArchiveRetention); err != nil || retention <= 0 {
+			return fmt.Errorf("input archiveRetention must be a positive duration: %v", i.ArchiveRetention)
+		}
+	}
+	if i.PreservedRefsRetention != "" {
+		if retention, err := time.ParseDuration(i.PreservedRefsRetention); err != nil || retention <= 0 {
+			return fmt.Errorf("input preservedRefsRetention must be a positive duration: %v", i.PreservedRefsRetention)
+		}
+	}
+	if i.Concurrency < 0 {
+		return fmt.Errorf("input concurrency can not be negative: %v", i.Concurrency)
+	}
+	if i.Wikis && i.Type != "github" && i.Type != "gitlab" {
+		return fmt.Errorf("input wikis are only supported by github and gitlab inputs")
 	}
-	if i.APIToken == "" {
-		return fmt.Errorf("input apiToken must be set")
+	if i.Gists && i.Type != "github" {
+		return fmt.Errorf("input gists are only supported by github inputs")
+	}
+	if i.ExportMetadata && i.Type != "github" && i.Type != "gitlab" {
+		return fmt.Errorf("input exportMetadata is only supported by github and gitlab inputs")
+	}
+	if i.ExportReleases && i.Type != "github" && i.Type != "gitlab" {
+		return fmt.Errorf("input exportReleases is only supported by github and gitlab inputs")
+	}
+	if i.ExportSettings && i.Type != "github" && i.Type != "gitlab" {
+		return fmt.Errorf("input exportSettings is only supported by github and gitlab inputs")
+	}
+	if err := i.validateRepositoryRules(); err != nil {
+		return err
+	}
+	if i.Schedule != nil {
+		if err := i.Schedule.Validate(); err != nil {
+			return fmt.Errorf("input %v: %w", i.Name, err)
+		}
+	}
+	if i.Retry != nil {
+		if err := i.Retry.Validate(); err != nil {
+			return fmt.Errorf("input %v: %w", i.Name, err)
+		}
+	}
+	if i.WebhookSecret != "" && !slices.Contains(supportedWebhookInputTypes, i.Type) {
+		return fmt.Errorf("input webhookSecret is only supported by %v inputs", strings.Join(supportedWebhookInputTypes, ", "))
+	}
+	if len(i.Groups) > 0 && i.Type != "gitlab" {
+		return fmt.Errorf("input groups are only supported by gitlab inputs")
+	}
+	if i.Type == "bitbucket" && i.Username == "" {
+		return fmt.Errorf("input username must be set for bitbucket inputs")
+	}
+	if len(i.Workspaces) > 0 && i.Type != "bitbucket" {
+		return fmt.Errorf("input workspaces are only supported by bitbucket inputs")
+	}
+	if len(i.Projects) > 0 && i.Type != "bitbucket-server" && i.Type != "azuredevops" {
+		return fmt.Errorf("input projects are only supported by bitbucket-server and azuredevops inputs")
 	}
 	return nil
 }
@@ -79,21 +399,54 @@ func (p *PrometheusConfig) Validate() error {
 	return nil
 }
 
+type WebhooksConfig struct {
+	ListenAddress string
+}
+
+func (w *WebhooksConfig) Validate() error {
+	if w.ListenAddress == "" {
+		return fmt.Errorf("webhooks.listenAddress must be set")
+	}
+	return nil
+}
+
 type Config struct {
 	Inputs          []Input
 	CloneFolderPath string
 	SyncDelay       string
+	MaxConcurrency  int
 	InfluxDB        *InfluxDBConfig
 	Prometheus      *PrometheusConfig
+	Webhooks        *WebhooksConfig
 }
 
-func (c *Config) Process() {
+func expandHomeDir(path string) string {
 	usr, _ := user.Current()
 	dir := usr.HomeDir
-	if c.CloneFolderPath == "~" {
-		c.CloneFolderPath = dir
-	} else if strings.HasPrefix(c.CloneFolderPath, "~/") {
-		c.CloneFolderPath = filepath.Join(dir, c.CloneFolderPath[2:])
+	if path == "~" {
+		return dir
+	} else if strings.HasPrefix(path, "~/") {
+		return filepath.Join(dir, path[2:])
+	}
+	return path
+}
+
+func (k *SSHKeyConfig) process() {
+	k.PrivateKeyPath = expandHomeDir(k.PrivateKeyPath)
+	k.KnownHostsPath = expandHomeDir(k.KnownHostsPath)
+}
+
+func (c *Config) Process() {
+	c.CloneFolderPath = expandHomeDir(c.CloneFolderPath)
+	for _, i := range c.Inputs {
+		if i.SSHKey != nil {
+			i.SSHKey.process()
+		}
+		for _, r := range i.Repositories {
+			if r.SSHKey != nil {
+				r.SSHKey.process()
+			}
+		}
 	}
 }
 
@@ -110,6 +463,9 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("inputs must have unique names. name %v appears at least twice", i.Name)
 		}
 		inputNames[i.Name] = true
+		if i.WebhookSecret != "" && c.Webhooks == nil {
+			return fmt.Errorf("input %v has a webhookSecret but webhooks are not configured", i.Name)
+		}
 	}
 	if c.CloneFolderPath == "" {
 		return fmt.Errorf("CloneFolderPath is empty")
@@ -117,6 +473,9 @@ func (c *Config) Validate() error {
 	if c.SyncDelay == "" {
 		return fmt.Errorf("SyncDelay is empty")
 	}
+	if c.MaxConcurrency < 0 {
+		return fmt.Errorf("MaxConcurrency can not be negative: %v", c.MaxConcurrency)
+	}
 	if c.InfluxDB != nil {
 		if err := c.InfluxDB.Validate(); err != nil {
 			return err
@@ -127,6 +486,11 @@ func (c *Config) Validate() error {
 			return err
 		}
 	}
+	if c.Webhooks != nil {
+		if err := c.Webhooks.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -139,6 +139,13 @@ inputs:
     apiToken: some-token
     ignoreRepositoriesRegex:
       - a-repo-name
+    includeRepositories:
+      - fork: false
+        visibility: [private]
+    excludeRepositories:
+      - archived: true
+        inactiveFor: 26280h
+    webhookSecret: some-secret
 cloneFolderPath: /path/to/backup
 influxDB:
   url: "http://influxurl"
@@ -148,6 +155,8 @@ influxDB:
 prometheus:
   exposedPort: 1234
   autoConvertNames: false
+webhooks:
+  listenAddress: ":8090"
 `
 
 		err := os.WriteFile(path.Join(configFolder, "config.yml"), []byte(goodConfigFile), 0644)
@@ -164,11 +173,18 @@ prometheus:
 		}()
 
 		config := LoadConfig()
+		yes, no := true, false
 		expectedConfig := Config{
-			Inputs:          []Input{{Name: "Some input name", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", IgnoreRepositoriesRegex: []string{"a-repo-name"}}},
+			Inputs: []Input{{
+				Name: "Some input name", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", IgnoreRepositoriesRegex: []string{"a-repo-name"},
+				IncludeRepositories: []RepositoryRule{{Fork: &no, Visibility: []string{"private"}}},
+				ExcludeRepositories: []RepositoryRule{{Archived: &yes, InactiveFor: "26280h"}},
+				WebhookSecret:       "some-secret",
+			}},
 			CloneFolderPath: "/path/to/backup",
 			InfluxDB:        &InfluxDBConfig{Url: "http://influxurl", AuthToken: "influx_token", OrganizationName: "org_name", BucketName: "bucket_name"},
 			Prometheus:      &PrometheusConfig{ExposedPort: 1234, AutoConvertNames: false},
+			Webhooks:        &WebhooksConfig{ListenAddress: ":8090"},
 			SyncDelay:       "5m",
 		}
 
@@ -177,3 +193,208 @@ prometheus:
 		}
 	})
 }
+
+func Test_inputValidate(t *testing.T) {
+	t.Run("bitbucket input requires a username", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "bitbucket", TargetURL: "https://api.bitbucket.org/2.0", APIToken: "app-password"}
+		err := input.Validate()
+		if err == nil || err.Error() != "input username must be set for bitbucket inputs" {
+			t.Fatalf("unexpected validation result: %v", err)
+		}
+	})
+
+	t.Run("bitbucket-server input does not require a username", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "bitbucket-server", TargetURL: "https://bitbucket.example.com", APIToken: "some-token", Projects: []string{"PROJ"}}
+		if err := input.Validate(); err != nil {
+			t.Fatalf("unexpected validation error: %v", err)
+		}
+	})
+
+	t.Run("workspaces are rejected outside of bitbucket inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", Workspaces: []string{"some-workspace"}}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("static input does not require a target url nor a token", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "static", Repositories: []StaticRepository{{URL: "https://git.example.com/cgit/some-repo.git"}}}
+		if err := input.Validate(); err != nil {
+			t.Fatalf("unexpected validation error: %v", err)
+		}
+	})
+
+	t.Run("static ssh repository requires an ssh key", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "static", Repositories: []StaticRepository{{URL: "git@git.example.com:vendor/some-repo.git"}}}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+		input.SSHKey = &SSHKeyConfig{PrivateKeyPath: "~/.ssh/id_ed25519"}
+		if err := input.Validate(); err != nil {
+			t.Fatalf("unexpected validation error: %v", err)
+		}
+	})
+
+	t.Run("ssh key requires a private key path", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", SSHKey: &SSHKeyConfig{KnownHostsPath: "~/.ssh/known_hosts"}}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("static input requires repositories", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "static"}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("github input with organizations and teams", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", Affiliations: []string{"collaborator"}, Organizations: []string{"some-org"}, Teams: []string{"some-org/some-team"}}
+		if err := input.Validate(); err != nil {
+			t.Fatalf("unexpected validation error: %v", err)
+		}
+	})
+
+	t.Run("github input with unknown affiliation", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", Affiliations: []string{"admin"}}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("github input with team missing its organization", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", Teams: []string{"some-team"}}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("wikis are rejected outside of github and gitlab inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "gitea", TargetURL: "https://forgejo.example.com", APIToken: "some-token", Wikis: true}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("metadata export is rejected outside of github and gitlab inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "gitea", TargetURL: "https://forgejo.example.com", APIToken: "some-token", ExportMetadata: true}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("releases export is rejected outside of github and gitlab inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "static", Repositories: []StaticRepository{{URL: "https://git.example.com/cgit/some-repo.git"}}, ExportReleases: true}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("settings export is rejected outside of github and gitlab inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "bitbucket", Username: "some-user", APIToken: "some-token", ExportSettings: true}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("repository rules are rejected outside of github and gitlab inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "gitea", TargetURL: "https://forgejo.example.com", APIToken: "some-token", ExcludeRepositories: []RepositoryRule{{Topics: []string{"archive"}}}}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("repository rules are validated", func(t *testing.T) {
+		for _, rule := range []RepositoryRule{{Visibility: []string{"secret"}}, {MinSizeKB: 10, MaxSizeKB: 5}, {InactiveFor: "3y"}, {ActiveWithin: "-1h"}} {
+			input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", IncludeRepositories: []RepositoryRule{rule}}
+			if err := input.Validate(); err == nil {
+				t.Fatalf("expected a validation error for %+v", rule)
+			}
+		}
+	})
+
+	t.Run("repository rule languages are rejected outside of github inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "gitlab", TargetURL: "https://gitlab.com", APIToken: "some-token", IncludeRepositories: []RepositoryRule{{Languages: []string{"Go"}}}}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+
+	t.Run("schedule accepts cron expressions with maintenance windows", func(t *testing.T) {
+		schedule := &ScheduleConfig{Cron: "CRON_TZ=UTC 0 2 * * *", Jitter: "10m", MaintenanceWindows: []MaintenanceWindowConfig{{Cron: "0 1 * * 6", Duration: "4h"}}}
+		input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", Schedule: schedule}
+		if err := input.Validate(); err != nil {
+			t.Fatalf("unexpected validation error: %v", err)
+		}
+	})
+
+	t.Run("schedules are validated", func(t *testing.T) {
+		for _, schedule := range []ScheduleConfig{
+			{},
+			{Interval: "1h", Cron: "@hourly"},
+			{Interval: "0s"},
+			{Cron: "every night"},
+			{Interval: "1h", Jitter: "-1m"},
+			{Interval: "1h", MaintenanceWindows: []MaintenanceWindowConfig{{Cron: "0 1 * * 6"}}},
+		} {
+			input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", Schedule: &schedule}
+			if err := input.Validate(); err == nil {
+				t.Fatalf("expected a validation error for %+v", schedule)
+			}
+		}
+	})
+
+	t.Run("gists are rejected outside of github inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "gitlab", TargetURL: "https://gitlab.com", APIToken: "some-token", Gists: true}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+	t.Run("retries are validated", func(t *testing.T) {
+		for _, retry := range []RetryConfig{
+			{Attempts: -1},
+			{QuarantineAfter: 101},
+			{Backoff: "soon"},
+			{QuarantineInterval: "-1h"},
+		} {
+			input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", Retry: &retry}
+			if err := input.Validate(); err == nil {
+				t.Fatalf("expected a validation error for %+v", retry)
+			}
+		}
+		input := Input{Name: "some-input", Type: "github", TargetURL: "https://api.github.com", APIToken: "some-token", Retry: &RetryConfig{Attempts: 5, Backoff: "30s", QuarantineAfter: 3, QuarantineInterval: "6h"}}
+		if err := input.Validate(); err != nil {
+			t.Fatalf("unexpected validation error %v", err)
+		}
+	})
+
+	t.Run("webhook secrets are rejected outside of github, gitlab and gitea inputs", func(t *testing.T) {
+		input := Input{Name: "some-input", Type: "bitbucket", Username: "some-user", APIToken: "some-token", WebhookSecret: "some-secret"}
+		if err := input.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+}
+
+func Test_configValidate(t *testing.T) {
+	input := Input{Name: "some-input", Type: "gitea", TargetURL: "https://forgejo.example.com", APIToken: "some-token", WebhookSecret: "some-secret"}
+
+	t.Run("webhook secrets require webhooks to be configured", func(t *testing.T) {
+		config := Config{Inputs: []Input{input}, CloneFolderPath: "/path/to/backup", SyncDelay: "5m"}
+		if err := config.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+		config.Webhooks = &WebhooksConfig{ListenAddress: ":8090"}
+		if err := config.Validate(); err != nil {
+			t.Fatalf("unexpected validation error %v", err)
+		}
+	})
+
+	t.Run("webhooks require a listen address", func(t *testing.T) {
+		config := Config{Inputs: []Input{input}, CloneFolderPath: "/path/to/backup", SyncDelay: "5m", Webhooks: &WebhooksConfig{}}
+		if err := config.Validate(); err == nil {
+			t.Fatal("expected a validation error")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package application
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+// ConcurrencyLimiter bounds the number of repositories processed at the same time across all inputs
+type ConcurrencyLimiter struct {
+	slots chan struct{}
+}
+
+func NewConcurrencyLimiter(maxConcurrency int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{slots: make(chan struct{}, maxConcurrency)}
+}
+
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *ConcurrencyLimiter) Release() {
+	if c == nil {
+		return
+	}
+	<-c.slots
+}
+
+// forEachRepository runs f for every repository with at most concurrency workers.
+// No repository is started once ctx is done, in-flight ones are expected to honour ctx themselves
+func forEachRepository(ctx context.Context, repositories []entity.Repository, concurrency int, limiter *ConcurrencyLimiter, f func(entity.Repository)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	repositoryChannel := make(chan entity.Repository)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for repository := range repositoryChannel {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := limiter.Acquire(ctx); err != nil {
+					continue
+				}
+				f(repository)
+				limiter.Release()
+			}
+		}()
+	}
+
+	for _, repository := range repositories {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case repositoryChannel <- repository:
+		case <-ctx.Done():
+		}
+	}
+	close(repositoryChannel)
+	wg.Wait()
+}
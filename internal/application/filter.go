@@ -0,0 +1,123 @@
+package application
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+// RepositoryRule matches the repositories fulfilling all of its conditions. Unset conditions match any repository,
+// while conditions on an attribute the forge does not report never match
+type RepositoryRule struct {
+	Fork     *bool
+	Archived *bool
+	// Visibilities matches repositories having any of them
+	Visibilities []entity.Visibility
+	// MinSizeKB and MaxSizeKB bound the size of the repository. Unbounded when 0
+	MinSizeKB int64
+	MaxSizeKB int64
+	// Topics matches repositories having any of them
+	Topics []string
+	// Languages matches repositories whose main language is any of them, ignoring case
+	Languages []string
+	// InactiveFor matches repositories without activity for at least this duration
+	InactiveFor time.Duration
+	// ActiveWithin matches repositories with activity within this duration
+	ActiveWithin time.Duration
+}
+
+func hasAnyTopic(repository entity.Repository, topics []string) bool {
+	for _, t := range topics {
+		if slices.Contains(repository.Topics, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyLanguage(repository entity.Repository, languages []string) bool {
+	for _, l := range languages {
+		if repository.Language != "" && strings.EqualFold(repository.Language, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r RepositoryRule) Matches(repository entity.Repository, now time.Time) bool {
+	if r.Fork != nil && *r.Fork != repository.Fork {
+		return false
+	}
+	if r.Archived != nil && *r.Archived != repository.Archived {
+		return false
+	}
+	if len(r.Visibilities) > 0 && !slices.Contains(r.Visibilities, repository.Visibility) {
+		return false
+	}
+	if r.MinSizeKB > 0 && repository.SizeKB < r.MinSizeKB {
+		return false
+	}
+	if r.MaxSizeKB > 0 && repository.SizeKB > r.MaxSizeKB {
+		return false
+	}
+	if len(r.Topics) > 0 && !hasAnyTopic(repository, r.Topics) {
+		return false
+	}
+	if len(r.Languages) > 0 && !hasAnyLanguage(repository, r.Languages) {
+		return false
+	}
+	if r.InactiveFor > 0 && (repository.LastActivityAt.IsZero() || repository.LastActivityAt.After(now.Add(-r.InactiveFor))) {
+		return false
+	}
+	if r.ActiveWithin > 0 && (repository.LastActivityAt.IsZero() || repository.LastActivityAt.Before(now.Add(-r.ActiveWithin))) {
+		return false
+	}
+	return true
+}
+
+// RepositoryFilter selects the repositories to clone on top of the ignored repositories regexes.
+// The zero value selects every repository
+type RepositoryFilter struct {
+	// IncludeRegexes only selects the repositories whose full name matches any of them
+	IncludeRegexes []*regexp.Regexp
+	// Include only selects the repositories matching any of the rules
+	Include []RepositoryRule
+	// Exclude rejects the repositories matching any of the rules
+	Exclude []RepositoryRule
+}
+
+func matchesAnyRule(rules []RepositoryRule, repository entity.Repository, now time.Time) bool {
+	for _, r := range rules {
+		if r.Matches(repository, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f RepositoryFilter) IsSelected(repository entity.Repository, now time.Time) bool {
+	// Included repositories are matched the same way as ignored ones
+	if len(f.IncludeRegexes) > 0 && !isIgnoredRepository(f.IncludeRegexes, repository) {
+		return false
+	}
+	if len(f.Include) > 0 && !matchesAnyRule(f.Include, repository, now) {
+		return false
+	}
+	return !matchesAnyRule(f.Exclude, repository, now)
+}
+
+// getFilteredRepository returns the repository the filter is evaluated on. Wikis do not have attributes of their own
+// and follow the decision made for their repository
+func getFilteredRepository(remoteRepos []entity.Repository, repository entity.Repository) entity.Repository {
+	if repository.Kind != entity.KindWiki {
+		return repository
+	}
+	parent := entity.Repository{OwnerName: repository.OwnerName, RepositoryName: entity.RepositoryName{Name: strings.TrimSuffix(repository.RepositoryName.Name, ".wiki")}}
+	if remoteRepo := findRepository(remoteRepos, parent); remoteRepo != nil {
+		return *remoteRepo
+	}
+	return repository
+}
@@ -0,0 +1,121 @@
+package application
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+func Test_RepositoryRule_Matches(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	yes, no := true, false
+	aRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "some_repo"},
+		LastActivityAt: now.Add(-48 * time.Hour),
+		Archived:       true,
+		Visibility:     entity.VisibilityPrivate,
+		SizeKB:         2048,
+		Topics:         []string{"firmware", "embedded"},
+		Language:       "Go",
+	}
+	tests := []struct {
+		name    string
+		rule    RepositoryRule
+		matches bool
+	}{
+		{"empty rule", RepositoryRule{}, true},
+		{"fork", RepositoryRule{Fork: &yes}, false},
+		{"not a fork", RepositoryRule{Fork: &no}, true},
+		{"archived", RepositoryRule{Archived: &yes}, true},
+		{"visibility", RepositoryRule{Visibilities: []entity.Visibility{entity.VisibilityPublic, entity.VisibilityPrivate}}, true},
+		{"other visibility", RepositoryRule{Visibilities: []entity.Visibility{entity.VisibilityInternal}}, false},
+		{"size within bounds", RepositoryRule{MinSizeKB: 1024, MaxSizeKB: 4096}, true},
+		{"too large", RepositoryRule{MaxSizeKB: 1024}, false},
+		{"topic", RepositoryRule{Topics: []string{"website", "embedded"}}, true},
+		{"other topic", RepositoryRule{Topics: []string{"website"}}, false},
+		{"language ignoring case", RepositoryRule{Languages: []string{"go"}}, true},
+		{"other language", RepositoryRule{Languages: []string{"Rust"}}, false},
+		{"inactive", RepositoryRule{InactiveFor: 24 * time.Hour}, true},
+		{"not inactive for long enough", RepositoryRule{InactiveFor: 72 * time.Hour}, false},
+		{"active within", RepositoryRule{ActiveWithin: 72 * time.Hour}, true},
+		{"all conditions must match", RepositoryRule{Archived: &yes, InactiveFor: 72 * time.Hour}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.rule.Matches(aRepository, now) != test.matches {
+				t.Errorf("expected rule %+v to match: %v", test.rule, test.matches)
+			}
+		})
+	}
+
+	t.Run("unknown attributes never match", func(t *testing.T) {
+		unknownRepository := entity.Repository{OwnerName: entity.OwnerName{Name: "some_owner"}, RepositoryName: entity.RepositoryName{Name: "some_repo"}}
+		for _, rule := range []RepositoryRule{{Languages: []string{"Go"}}, {InactiveFor: time.Hour}, {ActiveWithin: time.Hour}, {Visibilities: []entity.Visibility{entity.VisibilityPrivate}}} {
+			if rule.Matches(unknownRepository, now) {
+				t.Errorf("expected rule %+v not to match", rule)
+			}
+		}
+	})
+}
+
+func Test_RepositoryFilter_IsSelected(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	yes, no := true, false
+	// All non-fork private repositories except archived ones older than 3 years
+	filter := RepositoryFilter{
+		Include: []RepositoryRule{{Fork: &no, Visibilities: []entity.Visibility{entity.VisibilityPrivate}}},
+		Exclude: []RepositoryRule{{Archived: &yes, InactiveFor: 3 * 365 * 24 * time.Hour}},
+	}
+	privateRepository := entity.Repository{OwnerName: entity.OwnerName{Name: "some_owner"}, RepositoryName: entity.RepositoryName{Name: "private"}, Visibility: entity.VisibilityPrivate, LastActivityAt: now.Add(-4 * 365 * 24 * time.Hour)}
+	archivedRepository := privateRepository
+	archivedRepository.Archived = true
+	recentlyArchivedRepository := archivedRepository
+	recentlyArchivedRepository.LastActivityAt = now.Add(-24 * time.Hour)
+	forkRepository := privateRepository
+	forkRepository.Fork = true
+	publicRepository := privateRepository
+	publicRepository.Visibility = entity.VisibilityPublic
+
+	for _, repository := range []entity.Repository{privateRepository, recentlyArchivedRepository} {
+		if !filter.IsSelected(repository, now) {
+			t.Errorf("expected repository %+v to be selected", repository)
+		}
+	}
+	for _, repository := range []entity.Repository{archivedRepository, forkRepository, publicRepository} {
+		if filter.IsSelected(repository, now) {
+			t.Errorf("expected repository %+v not to be selected", repository)
+		}
+	}
+
+	t.Run("include regexes", func(t *testing.T) {
+		filter := RepositoryFilter{IncludeRegexes: []*regexp.Regexp{regexOrFail("^some_owner/pri.*$", t)}}
+		if !filter.IsSelected(privateRepository, now) {
+			t.Error("repository matching an include regex must be selected")
+		}
+		otherRepository := entity.Repository{OwnerName: entity.OwnerName{Name: "other_owner"}, RepositoryName: entity.RepositoryName{Name: "private"}}
+		if filter.IsSelected(otherRepository, now) {
+			t.Error("repository not matching any include regex must not be selected")
+		}
+	})
+
+	t.Run("empty filter selects everything", func(t *testing.T) {
+		if !(RepositoryFilter{}).IsSelected(forkRepository, now) {
+			t.Error("repository must be selected without filter")
+		}
+	})
+}
+
+func Test_getFilteredRepository(t *testing.T) {
+	aRepository := entity.Repository{OwnerName: entity.OwnerName{Name: "some_owner"}, RepositoryName: entity.RepositoryName{Name: "some_repo"}, Archived: true}
+	wiki := entity.NewWikiRepository(aRepository)
+
+	if !getFilteredRepository([]entity.Repository{aRepository, wiki}, wiki).Archived {
+		t.Error("wikis must be filtered with the attributes of their repository")
+	}
+	if getFilteredRepository([]entity.Repository{wiki}, wiki).Kind != entity.KindWiki {
+		t.Error("wikis without listed repository must be filtered on their own")
+	}
+}
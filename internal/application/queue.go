@@ -0,0 +1,65 @@
+package application
+
+import (
+	"sync"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+// SyncQueue holds the synchronizations requested for an input between its scheduled runs.
+// Requests are coalesced until they are taken: a repository is synchronized once however many times it was requested,
+// and a full run covers every requested repository
+type SyncQueue struct {
+	mutex        sync.Mutex
+	fullRun      bool
+	repositories []entity.Repository
+	notify       chan struct{}
+}
+
+func NewSyncQueue() *SyncQueue {
+	return &SyncQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *SyncQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *SyncQueue) RequestRepository(repository entity.Repository) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if !q.fullRun && !contains(q.repositories, repository) {
+		q.repositories = append(q.repositories, repository)
+	}
+	q.signal()
+}
+
+func (q *SyncQueue) RequestFullRun() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.fullRun = true
+	q.repositories = nil
+	q.signal()
+}
+
+// C is notified whenever a request is added
+func (q *SyncQueue) C() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+	return q.notify
+}
+
+// Take returns and clears the pending requests
+func (q *SyncQueue) Take() (bool, []entity.Repository) {
+	if q == nil {
+		return false, nil
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	fullRun, repositories := q.fullRun, q.repositories
+	q.fullRun, q.repositories = false, nil
+	return fullRun, repositories
+}
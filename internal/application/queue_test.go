@@ -0,0 +1,44 @@
+package application
+
+import (
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+func Test_SyncQueue(t *testing.T) {
+	aRepository := entity.Repository{OwnerName: entity.OwnerName{Name: "some_owner"}, RepositoryName: entity.RepositoryName{Name: "some_repo"}}
+	anotherRepository := entity.Repository{OwnerName: entity.OwnerName{Name: "some_owner"}, RepositoryName: entity.RepositoryName{Name: "another_repo"}}
+
+	t.Run("repositories are coalesced", func(t *testing.T) {
+		queue := NewSyncQueue()
+		queue.RequestRepository(aRepository)
+		queue.RequestRepository(anotherRepository)
+		queue.RequestRepository(aRepository)
+
+		select {
+		case <-queue.C():
+		default:
+			t.Fatal("expected the queue to be notified")
+		}
+		fullRun, repositories := queue.Take()
+		if fullRun || !containsAll(repositories, []entity.Repository{aRepository, anotherRepository}) {
+			t.Fatalf("unexpected requests %v %v", fullRun, repositories)
+		}
+		if fullRun, repositories := queue.Take(); fullRun || len(repositories) != 0 {
+			t.Fatalf("expected taken requests to be cleared. got %v %v", fullRun, repositories)
+		}
+	})
+
+	t.Run("full runs cover repositories", func(t *testing.T) {
+		queue := NewSyncQueue()
+		queue.RequestRepository(aRepository)
+		queue.RequestFullRun()
+		queue.RequestRepository(anotherRepository)
+
+		fullRun, repositories := queue.Take()
+		if !fullRun || len(repositories) != 0 {
+			t.Fatalf("expected a single full run. got %v %v", fullRun, repositories)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	stateEntity "github.com/Muscaw/GitFortress/internal/domain/state/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/rs/zerolog"
+)
+
+// RetryOpts tells how failed clones and synchronizations are retried. The zero value tries once and never quarantines
+type RetryOpts struct {
+	// Attempts is how many times a clone or synchronization is tried within a run. Transient failures are retried,
+	// while permanent ones such as missing repositories or rejected credentials are not. Defaults to 1
+	Attempts int
+	// Backoff is the wait before the first retry, doubled after every retry
+	Backoff time.Duration
+	// QuarantineAfter is the number of consecutive failed runs after which a repository is quarantined. Quarantined
+	// repositories are tried once every QuarantineInterval until they succeed, without retries. Disabled when 0
+	QuarantineAfter    int
+	QuarantineInterval time.Duration
+	// Sleep waits between attempts. Defaults to a timer stopped when the context is done
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+func (o RetryOpts) getAttempts() int {
+	return max(o.Attempts, 1)
+}
+
+// isPermanentError tells whether the failure is expected to happen again when retried right away
+func isPermanentError(err error) bool {
+	return errors.Is(err, entity.ErrRepositoryNotFound) || errors.Is(err, entity.ErrAccessDenied) || errors.Is(err, context.Canceled)
+}
+
+func (o RetryOpts) sleep(ctx context.Context, d time.Duration) error {
+	if o.Sleep != nil {
+		return o.Sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run calls f until it succeeds, fails permanently or runs out of attempts. Returns the last result along with the
+// number of tries
+func (o RetryOpts) run(ctx context.Context, log zerolog.Logger, attempts int, f func() (entity.SynchronizationResult, error)) (entity.SynchronizationResult, int, error) {
+	backoff := o.Backoff
+	for try := 1; ; try++ {
+		result, err := f()
+		if err == nil || try >= attempts || isPermanentError(err) || ctx.Err() != nil {
+			return result, try, err
+		}
+		log.Warn().Err(err).Msgf("try %v of %v failed. retrying in %v", try, attempts, backoff)
+		if err := o.sleep(ctx, backoff); err != nil {
+			return result, try, err
+		}
+		backoff *= 2
+	}
+}
+
+// quarantine is the state of a repository failing run after run
+type quarantine struct {
+	// consecutiveFailures is the number of runs which failed since the last success
+	consecutiveFailures int
+	lastAttemptAt       time.Time
+}
+
+func (q quarantine) isQuarantined(options RetryOpts) bool {
+	return options.QuarantineAfter > 0 && q.consecutiveFailures >= options.QuarantineAfter
+}
+
+// isDue tells whether a quarantined repository is tried again during this run
+func (q quarantine) isDue(options RetryOpts, now time.Time) bool {
+	return !q.lastAttemptAt.Add(options.QuarantineInterval).After(now)
+}
+
+// getQuarantine reads the consecutive failed runs of the repository from the state store
+func getQuarantine(options SynchronizationOpts, inputName string, repository entity.Repository) (quarantine, error) {
+	if options.StateStore == nil || options.Retry.QuarantineAfter == 0 {
+		return quarantine{}, nil
+	}
+	attempts, err := options.StateStore.ListAttempts(inputName, repository.GetFullName())
+	if err != nil {
+		return quarantine{}, err
+	}
+	q := quarantine{consecutiveFailures: countTrailingFailures(attempts)}
+	if len(attempts) > 0 {
+		q.lastAttemptAt = attempts[len(attempts)-1].EndedAt
+	}
+	return q, nil
+}
+
+// countTrailingFailures counts the failed attempts since the last success
+func countTrailingFailures(attempts []stateEntity.SyncAttempt) int {
+	count := 0
+	for i := len(attempts) - 1; i >= 0 && !attempts[i].IsSuccess(); i-- {
+		count += 1
+	}
+	return count
+}
+
+// runUnlessQuarantined runs the clone or synchronization of the repository, unless it is quarantined and not due yet.
+// Returns whether it ran and whether the repository is quarantined
+func runUnlessQuarantined(log zerolog.Logger, inputName string, options SynchronizationOpts, repository entity.Repository, now time.Time, f func(attempts int)) (bool, bool) {
+	before, err := getQuarantine(options, inputName, repository)
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not read previous attempts of repository %v", repository.GetFullName())
+	}
+	attempts := options.Retry.getAttempts()
+	if before.isQuarantined(options.Retry) {
+		if !before.isDue(options.Retry, now) {
+			log.Debug().Msgf("repository %v is quarantined until %v", repository.GetFullName(), before.lastAttemptAt.Add(options.Retry.QuarantineInterval))
+			return false, true
+		}
+		log.Warn().Msgf("repository %v is quarantined after %v consecutive failed runs. trying it once", repository.GetFullName(), before.consecutiveFailures)
+		attempts = 1
+	}
+	f(attempts)
+	after, err := getQuarantine(options, inputName, repository)
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not read previous attempts of repository %v", repository.GetFullName())
+		return true, before.isQuarantined(options.Retry)
+	}
+	if after.isQuarantined(options.Retry) && !before.isQuarantined(options.Retry) {
+		log.Error().Msgf("repository %v failed %v consecutive runs. quarantining it, it is tried once every %v until it succeeds", repository.GetFullName(), after.consecutiveFailures, options.Retry.QuarantineInterval)
+	} else if before.isQuarantined(options.Retry) && !after.isQuarantined(options.Retry) {
+		log.Info().Msgf("repository %v succeeded and leaves quarantine", repository.GetFullName())
+	}
+	return true, after.isQuarantined(options.Retry)
+}
@@ -0,0 +1,146 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/rs/zerolog"
+)
+
+func Test_RetryOpts_run(t *testing.T) {
+	var waits []time.Duration
+	options := RetryOpts{Backoff: time.Second, Sleep: func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}}
+	failing := func(errs ...error) func() (entity.SynchronizationResult, error) {
+		return func() (entity.SynchronizationResult, error) {
+			err := errs[0]
+			if len(errs) > 1 {
+				errs = errs[1:]
+			}
+			return entity.SynchronizationResult{}, err
+		}
+	}
+
+	t.Run("transient failures are retried with an exponential backoff", func(t *testing.T) {
+		waits = nil
+		_, tries, err := options.run(context.Background(), zerolog.Nop(), 4, failing(fmt.Errorf("connection reset"), fmt.Errorf("connection reset"), nil))
+		if err != nil || tries != 3 {
+			t.Fatalf("expected a success on the third try. got %v tries and %v", tries, err)
+		}
+		if len(waits) != 2 || waits[0] != time.Second || waits[1] != 2*time.Second {
+			t.Fatalf("unexpected waits %v", waits)
+		}
+	})
+
+	t.Run("gives up once out of attempts", func(t *testing.T) {
+		_, tries, err := options.run(context.Background(), zerolog.Nop(), 2, failing(fmt.Errorf("connection reset")))
+		if err == nil || tries != 2 {
+			t.Fatalf("expected a failure after 2 tries. got %v tries and %v", tries, err)
+		}
+	})
+
+	t.Run("permanent failures are not retried", func(t *testing.T) {
+		for _, permanent := range []error{entity.ErrRepositoryNotFound, fmt.Errorf("could not fetch repository. %w", entity.ErrAccessDenied)} {
+			_, tries, err := options.run(context.Background(), zerolog.Nop(), 3, failing(permanent))
+			if err == nil || tries != 1 {
+				t.Fatalf("expected a single try for %v. got %v tries", permanent, tries)
+			}
+		}
+	})
+}
+
+func Test_SynchronizeRepos_quarantines_failing_repositories(t *testing.T) {
+	aRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "some_repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://someurl"},
+	}
+	remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+	localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, errorOnSynchonizeRepos: fmt.Errorf("some error")}
+	stateStore := fakeStateStore{}
+	options := SynchronizationOpts{StateStore: &stateStore, Retry: RetryOpts{
+		Attempts:           2,
+		QuarantineAfter:    2,
+		QuarantineInterval: time.Hour,
+		Sleep:              func(ctx context.Context, d time.Duration) error { return nil },
+	}}
+	synchronize := func() int {
+		localVcs.synchronizedRepositories = nil
+		SynchronizeRepos(context.Background(), "some-input", nil, &localVcs, &remoteVcs, options)
+		return len(localVcs.synchronizedRepositories)
+	}
+
+	if tries := synchronize(); tries != 2 || stateStore.attempts[0].Tries != 2 {
+		t.Fatalf("expected the failure to be retried within the run. got %v tries", tries)
+	}
+	if tries := synchronize(); tries != 2 {
+		t.Fatalf("expected the failure to be retried within the run. got %v tries", tries)
+	}
+	if tries := synchronize(); tries != 0 {
+		t.Fatalf("expected the quarantined repository not to be tried before the quarantine interval. got %v tries", tries)
+	}
+
+	stateStore.attempts[1].EndedAt = time.Now().Add(-2 * time.Hour)
+	if tries := synchronize(); tries != 1 {
+		t.Fatalf("expected the quarantined repository to be tried once. got %v tries", tries)
+	}
+
+	stateStore.attempts[2].EndedAt = time.Now().Add(-2 * time.Hour)
+	localVcs.errorOnSynchonizeRepos = nil
+	if tries := synchronize(); tries != 1 {
+		t.Fatalf("expected the quarantined repository to be tried once. got %v tries", tries)
+	}
+	if tries := synchronize(); tries != 1 {
+		t.Fatalf("expected the repository to leave quarantine once it succeeds. got %v tries", tries)
+	}
+}
+
+func Test_SynchronizeRepositories_holds_back_quarantined_repositories(t *testing.T) {
+	aRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "some_repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://someurl"},
+	}
+	remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+	localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, errorOnSynchonizeRepos: fmt.Errorf("some error")}
+	stateStore := fakeStateStore{}
+	options := SynchronizationOpts{StateStore: &stateStore, Retry: RetryOpts{
+		Attempts:           1,
+		QuarantineAfter:    2,
+		QuarantineInterval: time.Hour,
+	}}
+	requested := []entity.Repository{{OwnerName: aRepository.OwnerName, RepositoryName: aRepository.RepositoryName}}
+	push := func() int {
+		localVcs.synchronizedRepositories = nil
+		SynchronizeRepositories(context.Background(), "some-input", nil, &localVcs, &remoteVcs, requested, options)
+		return len(localVcs.synchronizedRepositories)
+	}
+
+	if tries := push(); tries != 1 {
+		t.Fatalf("expected the requested repository to be synchronized. got %v tries", tries)
+	}
+	if tries := push(); tries != 1 {
+		t.Fatalf("expected the requested repository to be synchronized. got %v tries", tries)
+	}
+	if tries := push(); tries != 0 {
+		t.Fatalf("expected the repository quarantined by failed pushes not to be tried before the quarantine interval. got %v tries", tries)
+	}
+
+	// A scheduled run holds the repository back as well, as webhook attempts count towards the quarantine
+	localVcs.synchronizedRepositories = nil
+	SynchronizeRepos(context.Background(), "some-input", nil, &localVcs, &remoteVcs, options)
+	if len(localVcs.synchronizedRepositories) != 0 {
+		t.Fatalf("expected the quarantined repository not to be tried by the run. got %v", localVcs.synchronizedRepositories)
+	}
+
+	stateStore.attempts[1].EndedAt = time.Now().Add(-2 * time.Hour)
+	localVcs.errorOnSynchonizeRepos = nil
+	if tries := push(); tries != 1 {
+		t.Fatalf("expected the quarantined repository to be tried once. got %v tries", tries)
+	}
+}
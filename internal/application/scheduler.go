@@ -2,30 +2,188 @@ package application
 
 import (
 	"context"
+	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/robfig/cron/v3"
 )
 
-type Ticker interface {
-	C() <-chan time.Time
-	Stop()
+// Clock abstracts time so that schedules can be tested without waiting
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Schedule tells when synchronizations start
+type Schedule interface {
+	// Next returns the first start strictly after the given time
+	Next(after time.Time) time.Time
+}
+
+// IntervalSchedule starts a synchronization at a fixed interval
+type IntervalSchedule struct {
+	Interval time.Duration
+}
+
+func (s IntervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(s.Interval)
+}
+
+// ParseCronSchedule parses a standard 5 fields cron expression, or a descriptor such as @daily.
+// Expressions use the local time zone unless prefixed by CRON_TZ=<zone>, such as CRON_TZ=UTC 0 2 * * *
+func ParseCronSchedule(expression string) (Schedule, error) {
+	return cron.ParseStandard(expression)
+}
+
+// MaintenanceWindow is a recurring period during which no synchronization starts.
+// Synchronizations running when the window opens are not interrupted
+type MaintenanceWindow struct {
+	// Start tells when the window opens
+	Start    Schedule
+	Duration time.Duration
+}
+
+// getEnd returns when the window containing the time closes, if any
+func (w MaintenanceWindow) getEnd(t time.Time) (time.Time, bool) {
+	start := w.Start.Next(t.Add(-w.Duration))
+	if start.After(t) {
+		return time.Time{}, false
+	}
+	return start.Add(w.Duration), true
+}
+
+// maxPostponements bounds the search for a start outside of the maintenance windows, in case they span all the time
+const maxPostponements = 1000
+
+type ScheduleOpts struct {
+	Schedule Schedule
+	// Jitter delays every start by a random duration up to Jitter, to spread the load of inputs sharing a schedule
+	Jitter             time.Duration
+	MaintenanceWindows []MaintenanceWindow
+	// Queue holds the synchronizations requested between scheduled runs, such as by webhooks. Requested full runs run f.
+	// Requests are not run during maintenance windows but once they close
+	Queue *SyncQueue
+	// SynchronizeRepositories synchronizes the repositories requested through the queue
+	SynchronizeRepositories func(repositories []entity.Repository)
+	// Clock defaults to the system clock
+	Clock Clock
+	// Random returns a random duration in [0, n). Defaults to math/rand
+	Random func(n time.Duration) time.Duration
 }
 
-func ScheduleEvery(wg *sync.WaitGroup, ticker Ticker, ctx context.Context, f func()) {
-	defer ticker.Stop()
+func (o ScheduleOpts) getJitter() time.Duration {
+	if o.Jitter <= 0 {
+		return 0
+	}
+	if o.Random != nil {
+		return o.Random(o.Jitter)
+	}
+	return time.Duration(rand.Int63n(int64(o.Jitter)))
+}
 
-	// Executing the first time directly
+// getMaintenanceEnd returns when the maintenance window containing the time closes, if any
+func (o ScheduleOpts) getMaintenanceEnd(t time.Time) (time.Time, bool) {
+	for _, w := range o.MaintenanceWindows {
+		if end, found := w.getEnd(t); found {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// getStart returns when a synchronization planned at the given time actually starts, once jittered and postponed
+// after the maintenance windows
+func (o ScheduleOpts) getStart(planned time.Time) time.Time {
+	start := planned
+	for i := 0; i < maxPostponements; i++ {
+		start = start.Add(o.getJitter())
+		end, found := o.getMaintenanceEnd(start)
+		if !found {
+			break
+		}
+		start = end
+	}
+	return start
+}
+
+func (o ScheduleOpts) runRequested(wg *sync.WaitGroup, f func()) {
+	fullRun, repositories := o.Queue.Take()
 	wg.Add(1)
-	f()
-	wg.Done()
+	defer wg.Done()
+	if fullRun {
+		f()
+	} else if len(repositories) > 0 && o.SynchronizeRepositories != nil {
+		o.SynchronizeRepositories(repositories)
+	}
+}
+
+// RunScheduled runs f once on start and then following the schedule until the context is done.
+// Starts missed while f was running are merged into a single run starting right away once it ends.
+// Requested synchronizations run in between, so that an input never has two synchronizations running at the same time
+func RunScheduled(ctx context.Context, wg *sync.WaitGroup, options ScheduleOpts, f func()) {
+	clock := options.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	planned := clock.Now()
+	start := options.getStart(planned)
+	// requestedAt is when the pending requests run. Zero when there is none
+	var requestedAt time.Time
 	for {
-		select {
-		case <-ticker.C():
-			wg.Add(1)
-			f()
-			wg.Done()
-		case <-ctx.Done():
+		next := start
+		if !requestedAt.IsZero() && requestedAt.Before(start) {
+			next = requestedAt
+		}
+		if wait := next.Sub(clock.Now()); wait > 0 {
+			select {
+			case <-clock.After(wait):
+			case <-options.Queue.C():
+				requestedAt = clock.Now()
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil {
 			return
 		}
+		if now := clock.Now(); now.Before(start) {
+			if requestedAt.IsZero() || now.Before(requestedAt) {
+				continue
+			}
+			if end, found := options.getMaintenanceEnd(now); found {
+				requestedAt = end
+				continue
+			}
+			requestedAt = time.Time{}
+			options.runRequested(wg, f)
+			continue
+		}
+		// The scheduled run covers the pending requests
+		requestedAt = time.Time{}
+		options.Queue.Take()
+		wg.Add(1)
+		f()
+		wg.Done()
+		// Starts planned before this run began, such as the ones postponed by a maintenance window, are covered by it
+		planned = options.Schedule.Next(planned)
+		for !planned.After(start) {
+			planned = options.Schedule.Next(planned)
+		}
+		if now := clock.Now(); planned.Before(now) {
+			planned = now
+		}
+		start = options.getStart(planned)
 	}
 }
@@ -5,43 +5,245 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
 )
 
-type fakeTicker struct {
-	channel    chan time.Time
-	stopCalled bool
+// fakeClock moves forward as soon as it is waited on
+type fakeClock struct {
+	now time.Time
 }
 
-func (f *fakeTicker) C() <-chan time.Time {
-	return f.channel
+func (f *fakeClock) Now() time.Time {
+	return f.now
 }
 
-func (f *fakeTicker) Stop() {
-	f.stopCalled = true
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.now = f.now.Add(d)
+	channel := make(chan time.Time, 1)
+	channel <- f.now
+	return channel
 }
 
-func Test_scheduleEvery(t *testing.T) {
-	ticker := fakeTicker{channel: make(chan time.Time), stopCalled: false}
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		ticker.channel <- time.Now()
-		ticker.channel <- time.Now()
-		cancel()
-	}()
+func cronOrFail(expression string, t *testing.T) Schedule {
+	schedule, err := ParseCronSchedule(expression)
+	if err != nil {
+		t.Fatalf("could not parse cron expression %v: %v", expression, err)
+	}
+	return schedule
+}
 
-	runCount := 0
+// runScheduled returns the start times of the first runs
+func runScheduled(options ScheduleOpts, runs int, runDuration time.Duration) []time.Time {
+	clock := options.Clock.(*fakeClock)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var starts []time.Time
 	var wg sync.WaitGroup
-	ScheduleEvery(&wg, &ticker, ctx, func() {
-		runCount += 1
+	RunScheduled(ctx, &wg, options, func() {
+		starts = append(starts, clock.Now())
+		clock.now = clock.now.Add(runDuration)
+		if len(starts) == runs {
+			cancel()
+		}
+	})
+	return starts
+}
+
+func Test_RunScheduled(t *testing.T) {
+	startTime := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	t.Run("runs on start and then every interval", func(t *testing.T) {
+		starts := runScheduled(ScheduleOpts{Schedule: IntervalSchedule{Interval: 5 * time.Minute}, Clock: &fakeClock{now: startTime}}, 3, time.Minute)
+
+		expected := []time.Time{startTime, startTime.Add(5 * time.Minute), startTime.Add(10 * time.Minute)}
+		if len(starts) != 3 || !starts[1].Equal(expected[1]) || !starts[2].Equal(expected[2]) {
+			t.Fatalf("expected runs at %v. got %v", expected, starts)
+		}
+	})
+
+	t.Run("missed starts are merged into a single run", func(t *testing.T) {
+		starts := runScheduled(ScheduleOpts{Schedule: IntervalSchedule{Interval: 5 * time.Minute}, Clock: &fakeClock{now: startTime}}, 3, 12*time.Minute)
+
+		expected := []time.Time{startTime, startTime.Add(12 * time.Minute), startTime.Add(24 * time.Minute)}
+		if len(starts) != 3 || !starts[1].Equal(expected[1]) || !starts[2].Equal(expected[2]) {
+			t.Fatalf("expected runs at %v. got %v", expected, starts)
+		}
+	})
+
+	t.Run("cron schedule", func(t *testing.T) {
+		starts := runScheduled(ScheduleOpts{Schedule: cronOrFail("CRON_TZ=UTC 0 2 * * *", t), Clock: &fakeClock{now: startTime}}, 3, time.Minute)
+
+		expected := []time.Time{startTime, time.Date(2024, 3, 2, 2, 0, 0, 0, time.UTC), time.Date(2024, 3, 3, 2, 0, 0, 0, time.UTC)}
+		if len(starts) != 3 || !starts[1].Equal(expected[1]) || !starts[2].Equal(expected[2]) {
+			t.Fatalf("expected runs at %v. got %v", expected, starts)
+		}
+	})
+
+	t.Run("no run starts during maintenance windows", func(t *testing.T) {
+		window := MaintenanceWindow{Start: cronOrFail("CRON_TZ=UTC 0 10 * * *", t), Duration: time.Hour}
+		starts := runScheduled(ScheduleOpts{Schedule: IntervalSchedule{Interval: 20 * time.Minute}, MaintenanceWindows: []MaintenanceWindow{window}, Clock: &fakeClock{now: startTime}}, 3, time.Minute)
+
+		expected := []time.Time{time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 11, 10, 0, 0, time.UTC), time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC)}
+		if len(starts) != 3 || !starts[0].Equal(expected[0]) {
+			t.Fatalf("expected the first run to be postponed to the end of the window at %v. got %v", expected[0], starts)
+		}
+		if !starts[1].Equal(expected[1]) || !starts[2].Equal(expected[2]) {
+			t.Fatalf("expected the postponed starts to be covered by the first run. expected runs at %v. got %v", expected, starts)
+		}
+	})
+
+	t.Run("jitter delays every run", func(t *testing.T) {
+		random := func(n time.Duration) time.Duration {
+			if n != 2*time.Minute {
+				t.Errorf("unexpected jitter bound %v", n)
+			}
+			return 30 * time.Second
+		}
+		starts := runScheduled(ScheduleOpts{Schedule: IntervalSchedule{Interval: 5 * time.Minute}, Jitter: 2 * time.Minute, Random: random, Clock: &fakeClock{now: startTime}}, 2, time.Minute)
+
+		expected := []time.Time{startTime.Add(30 * time.Second), startTime.Add(5*time.Minute + 30*time.Second)}
+		if len(starts) != 2 || !starts[0].Equal(expected[0]) || !starts[1].Equal(expected[1]) {
+			t.Fatalf("expected runs at %v. got %v", expected, starts)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		runCount := 0
+		var wg sync.WaitGroup
+		RunScheduled(ctx, &wg, ScheduleOpts{Schedule: IntervalSchedule{Interval: time.Minute}, Clock: &fakeClock{now: startTime}}, func() {
+			runCount += 1
+		})
+		if runCount != 0 {
+			t.Fatalf("expected no run once the context is done. got %v", runCount)
+		}
 	})
+}
 
-	// We expect func to be executed 3 times
-	// One initial time + 1 time for each tick
-	if runCount != 3 {
-		t.Fatalf("function executed %v. Expected 3 times", runCount)
+func Test_MaintenanceWindow_getEnd(t *testing.T) {
+	window := MaintenanceWindow{Start: cronOrFail("CRON_TZ=UTC 0 1 * * 6", t), Duration: 4 * time.Hour}
+	saturday := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		at     time.Time
+		within bool
+	}{
+		{saturday.Add(30 * time.Minute), false},
+		{saturday.Add(time.Hour), true},
+		{saturday.Add(4 * time.Hour), true},
+		{saturday.Add(5 * time.Hour), false},
+	} {
+		end, within := window.getEnd(test.at)
+		if within != test.within {
+			t.Errorf("expected %v to be within the window: %v", test.at, test.within)
+		}
+		if within && !end.Equal(saturday.Add(5*time.Hour)) {
+			t.Errorf("unexpected end of window %v", end)
+		}
 	}
+}
 
-	if !ticker.stopCalled {
-		t.Fatal("stop not called on ticker")
+// manualClock fires when the test moves it forward
+type manualClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	waits  chan time.Duration
+	timers chan time.Time
+}
+
+func newManualClock(now time.Time) *manualClock {
+	return &manualClock{now: now, waits: make(chan time.Duration, 10), timers: make(chan time.Time)}
+}
+
+func (m *manualClock) Now() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.now
+}
+
+func (m *manualClock) After(d time.Duration) <-chan time.Time {
+	m.waits <- d
+	return m.timers
+}
+
+func (m *manualClock) fire(d time.Duration) {
+	m.mutex.Lock()
+	m.now = m.now.Add(d)
+	m.mutex.Unlock()
+	m.timers <- m.now
+}
+
+func receiveOrFail[T any](channel <-chan T, t *testing.T) T {
+	select {
+	case value := <-channel:
+		return value
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
 	}
+	var zero T
+	return zero
+}
+
+func Test_RunScheduled_requests(t *testing.T) {
+	startTime := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	aRepository := entity.Repository{OwnerName: entity.OwnerName{Name: "some_owner"}, RepositoryName: entity.RepositoryName{Name: "some_repo"}}
+
+	t.Run("requests run between scheduled runs", func(t *testing.T) {
+		clock := newManualClock(startTime)
+		queue := NewSyncQueue()
+		fullRuns := make(chan time.Time, 10)
+		requestedRepositories := make(chan []entity.Repository, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var wg sync.WaitGroup
+		options := ScheduleOpts{Schedule: IntervalSchedule{Interval: time.Hour}, Queue: queue, Clock: clock, SynchronizeRepositories: func(repositories []entity.Repository) {
+			requestedRepositories <- repositories
+		}}
+		go RunScheduled(ctx, &wg, options, func() { fullRuns <- clock.Now() })
+
+		receiveOrFail(fullRuns, t)
+		receiveOrFail(clock.waits, t)
+		queue.RequestRepository(aRepository)
+		if repositories := receiveOrFail(requestedRepositories, t); !containsAll(repositories, []entity.Repository{aRepository}) {
+			t.Fatalf("expected the requested repository to be synchronized. got %v", repositories)
+		}
+
+		receiveOrFail(clock.waits, t)
+		queue.RequestFullRun()
+		receiveOrFail(fullRuns, t)
+
+		if wait := receiveOrFail(clock.waits, t); wait != time.Hour {
+			t.Fatalf("expected requested runs to keep the schedule. waiting %v", wait)
+		}
+	})
+
+	t.Run("requests received during a maintenance window are covered by the run starting once it closes", func(t *testing.T) {
+		clock := newManualClock(startTime)
+		queue := NewSyncQueue()
+		fullRuns := make(chan time.Time, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var wg sync.WaitGroup
+		window := MaintenanceWindow{Start: cronOrFail("CRON_TZ=UTC 0 10 * * *", t), Duration: time.Hour}
+		options := ScheduleOpts{Schedule: IntervalSchedule{Interval: time.Hour}, MaintenanceWindows: []MaintenanceWindow{window}, Queue: queue, Clock: clock, SynchronizeRepositories: func(repositories []entity.Repository) {
+			t.Errorf("expected no request to run during the maintenance window. got %v", repositories)
+		}}
+		go RunScheduled(ctx, &wg, options, func() { fullRuns <- clock.Now() })
+
+		receiveOrFail(clock.waits, t)
+		queue.RequestRepository(aRepository)
+		if wait := receiveOrFail(clock.waits, t); wait != 30*time.Minute {
+			t.Fatalf("expected to wait for the end of the window. waiting %v", wait)
+		}
+		clock.fire(30 * time.Minute)
+
+		if start := receiveOrFail(fullRuns, t); !start.Equal(time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)) {
+			t.Fatalf("expected a run once the window closes. got %v", start)
+		}
+		if fullRun, repositories := queue.Take(); fullRun || len(repositories) != 0 {
+			t.Fatalf("expected the pending requests to be covered by the run. got %v %v", fullRun, repositories)
+		}
+	})
 }
@@ -2,18 +2,23 @@ package application
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
+	"sync/atomic"
+	"time"
 
 	"github.com/Muscaw/GitFortress/internal/application/metrics"
+	stateEntity "github.com/Muscaw/GitFortress/internal/domain/state/entity"
+	stateService "github.com/Muscaw/GitFortress/internal/domain/state/service"
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
 	"github.com/rs/zerolog"
 
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
 )
 
-var executionCount int = 1
+var executionCount atomic.Int64
 
 func init() {
 }
@@ -36,7 +41,163 @@ func isIgnoredRepository(ignoredRepositories []*regexp.Regexp, repository entity
 	return false
 }
 
-func SynchronizeRepos(ctx context.Context, inputName string, ignoredRepositories []*regexp.Regexp, localVcs service.LocalVCS, remoteVcs service.VCS) {
+type SynchronizationOpts struct {
+	// Concurrency is the number of repositories of the input cloned or fetched at the same time. Defaults to 1
+	Concurrency int
+	// Limiter bounds the concurrency shared by all inputs. Unbounded when nil
+	Limiter *ConcurrencyLimiter
+	// SkipUnchanged does not fetch repositories without remote activity since their last synchronization
+	SkipUnchanged bool
+	// StateStore records every clone and synchronization attempt. Nothing is recorded when nil
+	StateStore stateService.StateStore
+	// ArchiveOrphaned moves the repositories not listed by the input anymore to its archive. Otherwise they are kept
+	// in place without being fetched, as they may only be excluded by a configuration change rather than deleted
+	ArchiveOrphaned bool
+	// ArchiveRetention is how long archived repositories are kept. They are kept forever when 0
+	ArchiveRetention time.Duration
+	// Exporters back up the data stored by the forge next to every repository, even when its git data is unchanged
+	Exporters []service.RepositoryExporter
+	// Filter selects the repositories to clone based on their attributes. Repositories already mirrored are kept
+	Filter RepositoryFilter
+	// Retry retries failed clones and synchronizations within a run, and quarantines the repositories failing run
+	// after run. Quarantines are tracked in the StateStore
+	Retry RetryOpts
+}
+
+// splitOrphanedRepositories separates the local repositories which do not exist on the remote anymore
+func splitOrphanedRepositories(localRepos []entity.Repository, remoteRepos []entity.Repository) ([]entity.Repository, []entity.Repository) {
+	var existingRepos, orphanedRepos []entity.Repository
+	for _, localRepo := range localRepos {
+		if contains(remoteRepos, localRepo) {
+			existingRepos = append(existingRepos, localRepo)
+		} else {
+			orphanedRepos = append(orphanedRepos, localRepo)
+		}
+	}
+	return existingRepos, orphanedRepos
+}
+
+func recordAttempt(log zerolog.Logger, options SynchronizationOpts, attempt stateEntity.SyncAttempt, result entity.SynchronizationResult, tries int, err error) {
+	if options.StateStore == nil {
+		return
+	}
+	attempt.EndedAt = time.Now()
+	attempt.Tries = tries
+	attempt.RefsUpdated = result.RefsUpdated
+	attempt.RefsPreserved = len(result.PreservedRefs)
+	attempt.BytesFetched = result.BytesFetched
+	attempt.LfsObjectsFailed = result.LfsObjectsFailed
+	attempt.Outcome = stateEntity.OutcomeSuccess
+	if err != nil {
+		attempt.Outcome = stateEntity.OutcomeFailure
+		attempt.Error = err.Error()
+	}
+	if err := options.StateStore.RecordAttempt(attempt); err != nil {
+		log.Err(err).Msgf("could not record %v attempt of repository %v", attempt.Operation, attempt.RepositoryName)
+	}
+}
+
+func findRepository(slice []entity.Repository, repository entity.Repository) *entity.Repository {
+	for i := range slice {
+		if entity.IsEqual(slice[i], repository) {
+			return &slice[i]
+		}
+	}
+	return nil
+}
+
+// exportRepository runs every exporter on the repository and returns how many failed. Exporters are independent of each other
+// and of the git synchronization
+func exportRepository(ctx context.Context, log zerolog.Logger, localVcs service.LocalVCS, exporters []service.RepositoryExporter, remoteRepo entity.Repository) int {
+	if len(exporters) == 0 {
+		return 0
+	}
+	directory, err := localVcs.GetDataDirectory(remoteRepo)
+	if err != nil {
+		log.Err(err).Msgf("could not find data directory of repository %v", remoteRepo.GetFullName())
+		return len(exporters)
+	}
+	failed := 0
+	for _, exporter := range exporters {
+		if err := exporter.Export(ctx, remoteRepo, directory); err != nil {
+			log.Err(err).Str("exporter", exporter.Name()).Msgf("could not export %v of repository %v", exporter.Name(), remoteRepo.GetFullName())
+			failed += 1
+		}
+	}
+	return failed
+}
+
+// unchangedActivityMargin is subtracted from the last synchronization before comparing it with the activity reported
+// by the forge, as GitLab updates the last activity at most once an hour and clocks of the forge and the host can differ
+const unchangedActivityMargin = time.Hour
+
+// unchangedMaxAge is how long repositories can be skipped as unchanged before being fetched anyway, so that activity
+// the forge did not report is still mirrored
+const unchangedMaxAge = 24 * time.Hour
+
+// isUnchanged tells whether the remote repository had no activity since the last synchronization of the local one.
+// Repositories are considered changed when the forge does not report any activity
+func isUnchanged(localVcs service.LocalVCS, remoteRepos []entity.Repository, localRepo entity.Repository, now time.Time) (bool, error) {
+	remoteRepo := findRepository(remoteRepos, localRepo)
+	if remoteRepo == nil || remoteRepo.LastActivityAt.IsZero() {
+		return false, nil
+	}
+	lastSynchronizedAt, err := localVcs.LastSynchronizedAt(localRepo)
+	if err != nil {
+		return false, err
+	}
+	if lastSynchronizedAt.IsZero() || now.Sub(lastSynchronizedAt) > unchangedMaxAge {
+		return false, nil
+	}
+	return remoteRepo.LastActivityAt.Before(lastSynchronizedAt.Add(-unchangedActivityMargin)), nil
+}
+
+func warnFailedLfsObjects(log zerolog.Logger, repository entity.Repository, result entity.SynchronizationResult) {
+	if result.LfsObjectsFailed > 0 {
+		log.Warn().Msgf("%v LFS objects of repository %v could not be downloaded. they are retried on the next synchronization", result.LfsObjectsFailed, repository.GetFullName())
+	}
+}
+
+// cloneRepository returns the result of the clone and whether the repository was cloned. Wikis without any page are
+// not cloned and not reported as failed
+func cloneRepository(ctx context.Context, log zerolog.Logger, inputName string, localVcs service.LocalVCS, options SynchronizationOpts, remoteRepo entity.Repository, attempts int) (entity.SynchronizationResult, bool) {
+	log.Info().Msgf("cloning repository %v", remoteRepo.GetFullName())
+	attempt := stateEntity.SyncAttempt{InputName: inputName, RepositoryName: remoteRepo.GetFullName(), Operation: stateEntity.OperationClone, StartedAt: time.Now()}
+	result, tries, err := options.Retry.run(ctx, log, attempts, func() (entity.SynchronizationResult, error) {
+		return localVcs.CloneRepository(ctx, remoteRepo)
+	})
+	if remoteRepo.Kind == entity.KindWiki && errors.Is(err, entity.ErrRepositoryNotFound) {
+		// Forges report the wiki feature as enabled even when no page was ever written
+		log.Debug().Msgf("wiki %v does not exist yet", remoteRepo.GetFullName())
+		return result, false
+	}
+	recordAttempt(log, options, attempt, result, tries, err)
+	if err != nil {
+		log.Err(err).Msgf("could not clone repository %v", remoteRepo.GetFullName())
+		return result, false
+	}
+	warnFailedLfsObjects(log, remoteRepo, result)
+	return result, true
+}
+
+func synchronizeRepository(ctx context.Context, log zerolog.Logger, inputName string, localVcs service.LocalVCS, options SynchronizationOpts, localRepo entity.Repository, attempts int) (entity.SynchronizationResult, error) {
+	log.Info().Msgf("pulling repository %v", localRepo.GetFullName())
+	attempt := stateEntity.SyncAttempt{InputName: inputName, RepositoryName: localRepo.GetFullName(), Operation: stateEntity.OperationSynchronize, StartedAt: time.Now()}
+	result, tries, err := options.Retry.run(ctx, log, attempts, func() (entity.SynchronizationResult, error) {
+		return localVcs.SynchronizeRepository(ctx, localRepo)
+	})
+	recordAttempt(log, options, attempt, result, tries, err)
+	for _, preservedRef := range result.PreservedRefs {
+		log.Warn().Str("preserved_ref", preservedRef).Msgf("reference of repository %v was rewritten or deleted on the remote. previous tip kept as %v", localRepo.GetFullName(), preservedRef)
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("could not pull repository %v", localRepo.GetFullName())
+	}
+	warnFailedLfsObjects(log, localRepo, result)
+	return result, err
+}
+
+func SynchronizeRepos(ctx context.Context, inputName string, ignoredRepositories []*regexp.Regexp, localVcs service.LocalVCS, remoteVcs service.VCS, options SynchronizationOpts) {
 	log := zerolog.New(os.Stdout).With().Timestamp().Str("input", inputName).Logger()
 	numberOfRepos := metrics.GetMetricsService().TrackGauge(fmt.Sprintf("synchronization_run_%s", inputName))
 	remoteRepos, err := remoteVcs.ListOwnedRepositories()
@@ -53,26 +214,41 @@ func SynchronizeRepos(ctx context.Context, inputName string, ignoredRepositories
 	}
 
 	ignoredReposCount := 0
-	clonedReposCount := 0
+	filteredReposCount := 0
+	now := time.Now()
+	var reposToClone []entity.Repository
 	for _, remoteRepo := range remoteRepos {
 		if isIgnoredRepository(ignoredRepositories, remoteRepo) {
 			ignoredReposCount += 1
 			continue
 		}
+		if !options.Filter.IsSelected(getFilteredRepository(remoteRepos, remoteRepo), now) {
+			filteredReposCount += 1
+			continue
+		}
 		if !contains(localRepos, remoteRepo) {
-			log.Info().Msgf("cloning repository %v", remoteRepo.GetFullName())
-			err := localVcs.CloneRepository(remoteRepo)
-			if err != nil {
-				log.Err(err).Msgf("could not clone repository %v", remoteRepo.GetFullName())
-			} else {
-				clonedReposCount += 1
-			}
+			reposToClone = append(reposToClone, remoteRepo)
 		}
-		select {
-		case <-ctx.Done():
-			return
-		default:
+	}
+
+	var clonedReposCount atomic.Int64
+	var quarantinedReposCount atomic.Int64
+	var failedLfsObjectsCount atomic.Int64
+	forEachRepository(ctx, reposToClone, options.Concurrency, options.Limiter, func(remoteRepo entity.Repository) {
+		repoLog := log.With().Str("repository", remoteRepo.GetFullName()).Logger()
+		_, quarantined := runUnlessQuarantined(repoLog, inputName, options, remoteRepo, now, func(attempts int) {
+			result, cloned := cloneRepository(ctx, repoLog, inputName, localVcs, options, remoteRepo, attempts)
+			failedLfsObjectsCount.Add(int64(result.LfsObjectsFailed))
+			if cloned {
+				clonedReposCount.Add(1)
+			}
+		})
+		if quarantined {
+			quarantinedReposCount.Add(1)
 		}
+	})
+	if ctx.Err() != nil {
+		return
 	}
 
 	localRepos, err = localVcs.ListOwnedRepositories()
@@ -82,28 +258,137 @@ func SynchronizeRepos(ctx context.Context, inputName string, ignoredRepositories
 		return
 	}
 
-	numberOfSynchronizedRepositories := 0
-	for _, localRepo := range localRepos {
-		log.Info().Msgf("pulling repository %v", localRepo.GetFullName())
-		err := localVcs.SynchronizeRepository(localRepo)
-		if err != nil {
-			log.Error().Err(err).Msgf("could not pull repository %v", localRepo.GetFullName())
+	localRepos, orphanedRepos := splitOrphanedRepositories(localRepos, remoteRepos)
+	if len(remoteRepos) == 0 && len(orphanedRepos) > 0 {
+		// An empty listing is more likely an access issue than every repository being deleted
+		log.Warn().Msgf("remote listed no repository while %v exist locally. orphaned repositories are not archived", len(orphanedRepos))
+		localRepos = append(localRepos, orphanedRepos...)
+		orphanedRepos = nil
+	}
+	archivedReposCount := 0
+	for _, orphanedRepo := range orphanedRepos {
+		repoLog := log.With().Str("repository", orphanedRepo.GetFullName()).Logger()
+		if !options.ArchiveOrphaned {
+			repoLog.Warn().Msgf("repository %v is not listed by the input anymore. it is kept but not synchronized", orphanedRepo.GetFullName())
+			continue
+		}
+		repoLog.Warn().Msgf("repository %v does not exist on the remote anymore. archiving it", orphanedRepo.GetFullName())
+		if err := localVcs.ArchiveRepository(orphanedRepo); err != nil {
+			repoLog.Err(err).Msgf("could not archive repository %v", orphanedRepo.GetFullName())
 		} else {
-			numberOfSynchronizedRepositories += 1
+			archivedReposCount += 1
 		}
-		select {
-		case <-ctx.Done():
-			return
-		default:
+	}
+	purgedArchivesCount := 0
+	if options.ArchiveRetention > 0 {
+		purgedArchivesCount, err = localVcs.PurgeArchivedRepositories(time.Now().Add(-options.ArchiveRetention))
+		if err != nil {
+			log.Err(err).Msg("could not purge archived repositories")
 		}
 	}
+
+	var numberOfSynchronizedRepositories atomic.Int64
+	var skippedReposCount atomic.Int64
+	var preservedRefsCount atomic.Int64
+	var failedExportsCount atomic.Int64
+	forEachRepository(ctx, localRepos, options.Concurrency, options.Limiter, func(localRepo entity.Repository) {
+		repoLog := log.With().Str("repository", localRepo.GetFullName()).Logger()
+		// Exports run once the git data is handled, including for unchanged repositories.
+		// The remote repository is exported as it tells the kind of repository, which local repositories do not know
+		defer func() {
+			if remoteRepo := findRepository(remoteRepos, localRepo); remoteRepo != nil && ctx.Err() == nil {
+				failedExportsCount.Add(int64(exportRepository(ctx, repoLog, localVcs, options.Exporters, *remoteRepo)))
+			}
+		}()
+		if options.SkipUnchanged {
+			unchanged, err := isUnchanged(localVcs, remoteRepos, localRepo, now)
+			if err != nil {
+				repoLog.Warn().Err(err).Msgf("could not check whether repository %v changed", localRepo.GetFullName())
+			} else if unchanged {
+				repoLog.Debug().Msgf("repository %v is unchanged since its last synchronization", localRepo.GetFullName())
+				skippedReposCount.Add(1)
+				return
+			}
+		}
+		_, quarantined := runUnlessQuarantined(repoLog, inputName, options, localRepo, now, func(attempts int) {
+			result, err := synchronizeRepository(ctx, repoLog, inputName, localVcs, options, localRepo, attempts)
+			preservedRefsCount.Add(int64(len(result.PreservedRefs)))
+			failedLfsObjectsCount.Add(int64(result.LfsObjectsFailed))
+			if err == nil {
+				numberOfSynchronizedRepositories.Add(1)
+			}
+		})
+		if quarantined {
+			quarantinedReposCount.Add(1)
+		}
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if count := quarantinedReposCount.Load(); count > 0 {
+		log.Warn().Msgf("%v repositories are quarantined after failing %v consecutive runs", count, options.Retry.QuarantineAfter)
+	}
 	numberOfRepos.SetInts(map[string]int{
 		"remote_repositories_count":       len(remoteRepos),
 		"local_repositories_count":        len(localRepos),
 		"ignored_repositories_count":      ignoredReposCount,
-		"cloned_repositories_count":       clonedReposCount,
-		"synchronized_repositories_count": numberOfSynchronizedRepositories,
-		"execution_count":                 executionCount,
+		"filtered_repositories_count":     filteredReposCount,
+		"cloned_repositories_count":       int(clonedReposCount.Load()),
+		"synchronized_repositories_count": int(numberOfSynchronizedRepositories.Load()),
+		"skipped_repositories_count":      int(skippedReposCount.Load()),
+		"orphaned_repositories_count":     len(orphanedRepos),
+		"preserved_refs_count":            int(preservedRefsCount.Load()),
+		"archived_repositories_count":     archivedReposCount,
+		"purged_archives_count":           purgedArchivesCount,
+		"failed_exports_count":            int(failedExportsCount.Load()),
+		"failed_lfs_objects_count":        int(failedLfsObjectsCount.Load()),
+		"quarantined_repositories_count":  int(quarantinedReposCount.Load()),
+		"execution_count":                 int(executionCount.Add(1)),
+	})
+}
+
+// SynchronizeRepositories synchronizes the given repositories of the input, cloning the ones not mirrored yet, such as
+// when a forge notifies a push. Only the owner and name of the repositories are used: they are looked up in the remote
+// listing, so that only repositories belonging to the input and selected by its filters are synchronized.
+// Quarantined repositories are held back as during scheduled runs, so that pushes do not bypass the quarantine interval
+func SynchronizeRepositories(ctx context.Context, inputName string, ignoredRepositories []*regexp.Regexp, localVcs service.LocalVCS, remoteVcs service.VCS, repositories []entity.Repository, options SynchronizationOpts) {
+	log := zerolog.New(os.Stdout).With().Timestamp().Str("input", inputName).Logger()
+	remoteRepos, err := remoteVcs.ListOwnedRepositories()
+	if err != nil {
+		log.Err(err).Msg("could not list all owned repos")
+		return
+	}
+	localRepos, err := localVcs.ListOwnedRepositories()
+	if err != nil {
+		log.Err(err).Msg("could not list all owned repos")
+		return
+	}
+	now := time.Now()
+	forEachRepository(ctx, repositories, options.Concurrency, options.Limiter, func(repository entity.Repository) {
+		repoLog := log.With().Str("repository", repository.GetFullName()).Logger()
+		remoteRepo := findRepository(remoteRepos, repository)
+		if remoteRepo == nil {
+			repoLog.Warn().Msgf("requested repository %v is not listed by the input", repository.GetFullName())
+			return
+		}
+		if localRepo := findRepository(localRepos, repository); localRepo != nil {
+			runUnlessQuarantined(repoLog, inputName, options, *localRepo, now, func(attempts int) {
+				synchronizeRepository(ctx, repoLog, inputName, localVcs, options, *localRepo, attempts)
+			})
+		} else if isIgnoredRepository(ignoredRepositories, *remoteRepo) || !options.Filter.IsSelected(getFilteredRepository(remoteRepos, *remoteRepo), now) {
+			repoLog.Debug().Msgf("requested repository %v is not selected by the input", repository.GetFullName())
+			return
+		} else {
+			cloned := false
+			runUnlessQuarantined(repoLog, inputName, options, *remoteRepo, now, func(attempts int) {
+				_, cloned = cloneRepository(ctx, repoLog, inputName, localVcs, options, *remoteRepo, attempts)
+			})
+			if !cloned {
+				return
+			}
+		}
+		if ctx.Err() == nil {
+			exportRepository(ctx, repoLog, localVcs, options.Exporters, *remoteRepo)
+		}
 	})
-	executionCount += 1
 }
@@ -3,10 +3,17 @@ package application
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"regexp"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	stateEntity "github.com/Muscaw/GitFortress/internal/domain/state/entity"
+	stateService "github.com/Muscaw/GitFortress/internal/domain/state/service"
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
 )
 
 func Test_contains(t *testing.T) {
@@ -121,15 +128,22 @@ func Test_isIgnoredRepository(t *testing.T) {
 }
 
 type fakeLocalVcs struct {
+	mutex                    sync.Mutex
 	ownedRepos               []entity.Repository
 	errorOnListOwnedRepos    error
 	clonedRepositories       []entity.Repository
 	errorOnCloneRepos        error
 	synchronizedRepositories []entity.Repository
 	errorOnSynchonizeRepos   error
+	lastSynchronizedAt       map[string]time.Time
+	archivedRepositories     []entity.Repository
+	synchronizationResult    entity.SynchronizationResult
+	purgedBefore             time.Time
 }
 
 func (f *fakeLocalVcs) ListOwnedRepositories() ([]entity.Repository, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if f.errorOnListOwnedRepos != nil {
 		return []entity.Repository{}, f.errorOnListOwnedRepos
 	} else {
@@ -137,18 +151,53 @@ func (f *fakeLocalVcs) ListOwnedRepositories() ([]entity.Repository, error) {
 	}
 }
 
-func (f *fakeLocalVcs) CloneRepository(repository entity.Repository) error {
+func (f *fakeLocalVcs) CloneRepository(_ context.Context, repository entity.Repository) (entity.SynchronizationResult, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if f.errorOnCloneRepos != nil {
-		return f.errorOnCloneRepos
+		return entity.SynchronizationResult{}, f.errorOnCloneRepos
 	}
 	f.clonedRepositories = append(f.clonedRepositories, repository)
 	f.ownedRepos = append(f.ownedRepos, repository)
-	return nil
+	return entity.SynchronizationResult{RefsUpdated: 1, BytesFetched: 100}, nil
 }
 
-func (f *fakeLocalVcs) SynchronizeRepository(repository entity.Repository) error {
+func (f *fakeLocalVcs) SynchronizeRepository(_ context.Context, repository entity.Repository) (entity.SynchronizationResult, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	f.synchronizedRepositories = append(f.synchronizedRepositories, repository)
-	return f.errorOnSynchonizeRepos
+	return f.synchronizationResult, f.errorOnSynchonizeRepos
+}
+
+func (f *fakeLocalVcs) LastSynchronizedAt(repository entity.Repository) (time.Time, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.lastSynchronizedAt[repository.GetFullName()], nil
+}
+
+func (f *fakeLocalVcs) ArchiveRepository(repository entity.Repository) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.archivedRepositories = append(f.archivedRepositories, repository)
+	var remainingRepos []entity.Repository
+	for _, r := range f.ownedRepos {
+		if !entity.IsEqual(r, repository) {
+			remainingRepos = append(remainingRepos, r)
+		}
+	}
+	f.ownedRepos = remainingRepos
+	return nil
+}
+
+func (f *fakeLocalVcs) PurgeArchivedRepositories(archivedBefore time.Time) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.purgedBefore = archivedBefore
+	return 0, nil
+}
+
+func (f *fakeLocalVcs) GetDataDirectory(repository entity.Repository) (string, error) {
+	return "/data/" + repository.GetFullName(), nil
 }
 
 type fakeRemoteVcs struct {
@@ -169,7 +218,7 @@ func containsAll(slice1 []entity.Repository, slice2 []entity.Repository) bool {
 		return false
 	}
 	for i := range slice1 {
-		if slice1[i] != slice2[i] {
+		if !reflect.DeepEqual(slice1[i], slice2[i]) {
 			return false
 		}
 	}
@@ -194,7 +243,7 @@ func Test_SynchronizeRepos(t *testing.T) {
 		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{}}
 		ignoredRepositories := []*regexp.Regexp{}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		expectedClonedAndSynchronizedRepos := []entity.Repository{aRepository}
 		if !containsAll(localVcs.clonedRepositories, expectedClonedAndSynchronizedRepos) {
@@ -211,7 +260,7 @@ func Test_SynchronizeRepos(t *testing.T) {
 		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}}
 		ignoredRepositories := []*regexp.Regexp{}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		if len(localVcs.clonedRepositories) != 0 {
 			t.Error("locally available repository should not be cloned again")
@@ -228,7 +277,7 @@ func Test_SynchronizeRepos(t *testing.T) {
 		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}}
 		ignoredRepositories := []*regexp.Regexp{}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		if len(localVcs.clonedRepositories) != 0 {
 			t.Error("locally available repository should not be cloned again")
@@ -238,6 +287,121 @@ func Test_SynchronizeRepos(t *testing.T) {
 		if !containsAll(localVcs.synchronizedRepositories, expectedSynchronizedRepositories) {
 			t.Error("locally available repository must be synchronized even without remote counterpart")
 		}
+
+		if len(localVcs.archivedRepositories) != 0 {
+			t.Error("repositories must not be archived when the remote lists no repository at all")
+		}
+	})
+
+	t.Run("unchanged repository is skipped", func(t *testing.T) {
+		remoteRepository := aRepository
+		remoteRepository.LastActivityAt = time.Now().Add(-3 * time.Hour)
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{remoteRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, lastSynchronizedAt: map[string]time.Time{aRepository.GetFullName(): time.Now().Add(-time.Hour)}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{SkipUnchanged: true})
+
+		if len(localVcs.synchronizedRepositories) != 0 {
+			t.Error("repository without activity since its last synchronization must not be synchronized")
+		}
+	})
+
+	t.Run("changed repository is synchronized", func(t *testing.T) {
+		remoteRepository := aRepository
+		remoteRepository.LastActivityAt = time.Now().Add(-time.Hour)
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{remoteRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, lastSynchronizedAt: map[string]time.Time{aRepository.GetFullName(): time.Now().Add(-2 * time.Hour)}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{SkipUnchanged: true})
+
+		if !containsAll(localVcs.synchronizedRepositories, []entity.Repository{aRepository}) {
+			t.Error("repository with activity since its last synchronization must be synchronized")
+		}
+	})
+
+	t.Run("repository with activity shortly before its last synchronization is synchronized", func(t *testing.T) {
+		// The forge may report the activity of a push made after the synchronization with an earlier time
+		remoteRepository := aRepository
+		remoteRepository.LastActivityAt = time.Now().Add(-2 * time.Hour)
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{remoteRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, lastSynchronizedAt: map[string]time.Time{aRepository.GetFullName(): time.Now().Add(-90 * time.Minute)}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{SkipUnchanged: true})
+
+		if !containsAll(localVcs.synchronizedRepositories, []entity.Repository{aRepository}) {
+			t.Error("repository with activity within the safety margin of its last synchronization must be synchronized")
+		}
+	})
+
+	t.Run("repository not synchronized for a long time is synchronized", func(t *testing.T) {
+		remoteRepository := aRepository
+		remoteRepository.LastActivityAt = time.Now().Add(-30 * 24 * time.Hour)
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{remoteRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, lastSynchronizedAt: map[string]time.Time{aRepository.GetFullName(): time.Now().Add(-25 * time.Hour)}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{SkipUnchanged: true})
+
+		if !containsAll(localVcs.synchronizedRepositories, []entity.Repository{aRepository}) {
+			t.Error("repository skipped as unchanged for longer than the maximum age must be synchronized")
+		}
+	})
+
+	t.Run("repository without known activity is synchronized", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, lastSynchronizedAt: map[string]time.Time{aRepository.GetFullName(): time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{SkipUnchanged: true})
+
+		if !containsAll(localVcs.synchronizedRepositories, []entity.Repository{aRepository}) {
+			t.Error("repository must be synchronized when the forge does not report its activity")
+		}
+	})
+
+	t.Run("repository removed from the remote is archived and not synchronized", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{anIgnoredRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository, anIgnoredRepository}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{ArchiveOrphaned: true})
+
+		if !containsAll(localVcs.archivedRepositories, []entity.Repository{aRepository}) {
+			t.Error("repository missing from the remote must be archived")
+		}
+		if !containsAll(localVcs.synchronizedRepositories, []entity.Repository{anIgnoredRepository}) {
+			t.Error("only repositories existing on the remote must be synchronized")
+		}
+		if !localVcs.purgedBefore.IsZero() {
+			t.Error("archived repositories must be kept without retention")
+		}
+	})
+
+	t.Run("repository excluded by a configuration change is kept and not synchronized", func(t *testing.T) {
+		aWiki := aRepository
+		aWiki.RepositoryName = entity.RepositoryName{Name: "some_repo.wiki"}
+		aWiki.Kind = entity.KindWiki
+		// The wiki is not listed anymore once wikis are disabled on the input
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository, aWiki}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{})
+
+		if len(localVcs.archivedRepositories) != 0 {
+			t.Error("repositories not listed anymore must not be archived unless archiving is enabled")
+		}
+		if containsAll(localVcs.synchronizedRepositories, []entity.Repository{aWiki}) {
+			t.Error("repositories not listed anymore must not be synchronized")
+		}
+	})
+
+	t.Run("archived repositories are purged after the retention", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{ArchiveRetention: 24 * time.Hour})
+
+		expectedPurge := time.Now().Add(-24 * time.Hour)
+		if localVcs.purgedBefore.Before(expectedPurge.Add(-time.Minute)) || localVcs.purgedBefore.After(expectedPurge) {
+			t.Errorf("expected archives older than 24h to be purged. purged before %v", localVcs.purgedBefore)
+		}
 	})
 
 	t.Run("ignored repository is not cloned", func(t *testing.T) {
@@ -245,7 +409,7 @@ func Test_SynchronizeRepos(t *testing.T) {
 		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{}}
 		ignoredRepositories := []*regexp.Regexp{ignoredRepositoryRegex}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		expectedClonedAndSynchronizedRepos := []entity.Repository{aRepository}
 		if !containsAll(localVcs.clonedRepositories, expectedClonedAndSynchronizedRepos) {
@@ -263,7 +427,7 @@ func Test_SynchronizeRepos(t *testing.T) {
 		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{anIgnoredRepository}}
 		ignoredRepositories := []*regexp.Regexp{ignoredRepositoryRegex}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		if len(localVcs.clonedRepositories) != 0 {
 			t.Error("locally available repository should not be cloned again")
@@ -275,12 +439,31 @@ func Test_SynchronizeRepos(t *testing.T) {
 		}
 	})
 
+	t.Run("filtered repository is not cloned and its existing mirror is kept", func(t *testing.T) {
+		archivedRepository, anotherArchivedRepository := aRepository, anIgnoredRepository
+		archivedRepository.Archived = true
+		anotherArchivedRepository.Archived = true
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{archivedRepository, anotherArchivedRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}}
+		archived := true
+		filter := RepositoryFilter{Exclude: []RepositoryRule{{Archived: &archived}}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{Filter: filter})
+
+		if len(localVcs.clonedRepositories) != 0 {
+			t.Error("filtered repository must not be cloned")
+		}
+		if len(localVcs.archivedRepositories) != 0 || !containsAll(localVcs.synchronizedRepositories, []entity.Repository{aRepository}) {
+			t.Error("existing mirror of a filtered repository must be kept and synchronized")
+		}
+	})
+
 	t.Run("error when listing remote vcs owned repos", func(t *testing.T) {
 		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}, errorWhenListingOwnedRepos: fmt.Errorf("could not load repos")}
 		localVcs := fakeLocalVcs{}
 		ignoredRepositories := []*regexp.Regexp{}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		if len(localVcs.clonedRepositories) != 0 {
 			t.Error("should not clone repos if an error is return before")
@@ -291,7 +474,7 @@ func Test_SynchronizeRepos(t *testing.T) {
 		localVcs := fakeLocalVcs{errorOnListOwnedRepos: fmt.Errorf("could not list repos")}
 		ignoredRepositories := []*regexp.Regexp{}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		if len(localVcs.clonedRepositories) != 0 {
 			t.Error("should not clone repos if an error is return before")
@@ -307,7 +490,7 @@ func Test_SynchronizeRepos(t *testing.T) {
 		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{}, errorOnCloneRepos: fmt.Errorf("could not list repos")}
 		ignoredRepositories := []*regexp.Regexp{}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		if len(localVcs.clonedRepositories) != 0 {
 			t.Error("should have cloned repos and fail on them")
@@ -323,7 +506,7 @@ func Test_SynchronizeRepos(t *testing.T) {
 		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{}, errorOnSynchonizeRepos: fmt.Errorf("some error")}
 		ignoredRepositories := []*regexp.Regexp{}
 
-		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs)
+		SynchronizeRepos(context.Background(), SOME_INPUT, ignoredRepositories, &localVcs, &remoteVcs, SynchronizationOpts{})
 
 		expectedClonedRepositories := []entity.Repository{aRepository}
 
@@ -336,3 +519,272 @@ func Test_SynchronizeRepos(t *testing.T) {
 		}
 	})
 }
+
+// blockingLocalVcs tracks how many repositories are synchronized at the same time
+type blockingLocalVcs struct {
+	fakeLocalVcs
+	running    atomic.Int64
+	maxRunning atomic.Int64
+}
+
+func (b *blockingLocalVcs) SynchronizeRepository(ctx context.Context, repository entity.Repository) (entity.SynchronizationResult, error) {
+	running := b.running.Add(1)
+	defer b.running.Add(-1)
+	for {
+		maxRunning := b.maxRunning.Load()
+		if running <= maxRunning || b.maxRunning.CompareAndSwap(maxRunning, running) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return b.fakeLocalVcs.SynchronizeRepository(ctx, repository)
+}
+
+func someRepositories(count int) []entity.Repository {
+	var repositories []entity.Repository
+	for i := 0; i < count; i++ {
+		repositories = append(repositories, entity.Repository{
+			OwnerName:      entity.OwnerName{Name: "some_owner"},
+			RepositoryName: entity.RepositoryName{Name: fmt.Sprintf("some_repo_%v", i)},
+			Remote:         entity.Remote{Name: "origin", HttpUrl: fmt.Sprintf("https://someurl/some_owner/some_repo_%v", i)},
+		})
+	}
+	return repositories
+}
+
+func Test_SynchronizeRepos_concurrency(t *testing.T) {
+	const SOME_INPUT = "some-input"
+	repositories := someRepositories(8)
+
+	t.Run("repositories are synchronized in parallel", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: repositories}
+		localVcs := blockingLocalVcs{fakeLocalVcs: fakeLocalVcs{ownedRepos: repositories}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{Concurrency: 4})
+
+		if len(localVcs.synchronizedRepositories) != len(repositories) {
+			t.Fatalf("expected %v synchronized repositories, got %v", len(repositories), len(localVcs.synchronizedRepositories))
+		}
+		if localVcs.maxRunning.Load() < 2 || localVcs.maxRunning.Load() > 4 {
+			t.Fatalf("expected between 2 and 4 repositories synchronized at the same time, got %v", localVcs.maxRunning.Load())
+		}
+	})
+
+	t.Run("global limiter bounds the input concurrency", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: repositories}
+		localVcs := blockingLocalVcs{fakeLocalVcs: fakeLocalVcs{ownedRepos: repositories}}
+
+		SynchronizeRepos(context.Background(), SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{Concurrency: 4, Limiter: NewConcurrencyLimiter(2)})
+
+		if len(localVcs.synchronizedRepositories) != len(repositories) {
+			t.Fatalf("expected %v synchronized repositories, got %v", len(repositories), len(localVcs.synchronizedRepositories))
+		}
+		if localVcs.maxRunning.Load() > 2 {
+			t.Fatalf("expected at most 2 repositories synchronized at the same time, got %v", localVcs.maxRunning.Load())
+		}
+	})
+
+	t.Run("cancelled context stops the synchronization", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: repositories}
+		localVcs := fakeLocalVcs{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		SynchronizeRepos(ctx, SOME_INPUT, nil, &localVcs, &remoteVcs, SynchronizationOpts{Concurrency: 4})
+
+		if len(localVcs.clonedRepositories) != 0 || len(localVcs.synchronizedRepositories) != 0 {
+			t.Fatal("no repository must be processed once the context is cancelled")
+		}
+	})
+}
+
+type fakeStateStore struct {
+	stateService.StateStore
+	mutex    sync.Mutex
+	attempts []stateEntity.SyncAttempt
+}
+
+func (f *fakeStateStore) RecordAttempt(attempt stateEntity.SyncAttempt) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.attempts = append(f.attempts, attempt)
+	return nil
+}
+
+func (f *fakeStateStore) ListAttempts(inputName string, repositoryName string) ([]stateEntity.SyncAttempt, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var attempts []stateEntity.SyncAttempt
+	for _, a := range f.attempts {
+		if a.InputName == inputName && a.RepositoryName == repositoryName {
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts, nil
+}
+
+func Test_SynchronizeRepos_records_attempts(t *testing.T) {
+	aRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "some_repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://someurl"},
+	}
+	remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+	localVcs := fakeLocalVcs{errorOnSynchonizeRepos: fmt.Errorf("some error")}
+	stateStore := fakeStateStore{}
+
+	SynchronizeRepos(context.Background(), "some-input", nil, &localVcs, &remoteVcs, SynchronizationOpts{StateStore: &stateStore})
+
+	if len(stateStore.attempts) != 2 {
+		t.Fatalf("expected a clone and a synchronization attempt, got %v", stateStore.attempts)
+	}
+	clone, synchronization := stateStore.attempts[0], stateStore.attempts[1]
+	if clone.InputName != "some-input" || clone.RepositoryName != "some_owner/some_repo" || clone.Operation != stateEntity.OperationClone {
+		t.Fatalf("unexpected clone attempt %v", clone)
+	}
+	if !clone.IsSuccess() || clone.RefsUpdated != 1 || clone.BytesFetched != 100 || clone.EndedAt.Before(clone.StartedAt) {
+		t.Fatalf("unexpected clone attempt %v", clone)
+	}
+	if synchronization.Operation != stateEntity.OperationSynchronize || synchronization.IsSuccess() || synchronization.Error != "some error" {
+		t.Fatalf("unexpected synchronization attempt %v", synchronization)
+	}
+}
+
+func Test_SynchronizeRepos_records_preserved_refs(t *testing.T) {
+	aRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "some_repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://someurl"},
+	}
+	remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+	localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, synchronizationResult: entity.SynchronizationResult{
+		RefsUpdated:   1,
+		PreservedRefs: []string{"refs/gitfortress/preserved/20240301T100000Z/heads/main"},
+	}}
+	stateStore := fakeStateStore{}
+
+	SynchronizeRepos(context.Background(), "some-input", nil, &localVcs, &remoteVcs, SynchronizationOpts{StateStore: &stateStore})
+
+	if len(stateStore.attempts) != 1 || stateStore.attempts[0].RefsPreserved != 1 {
+		t.Fatalf("expected the preserved reference to be recorded, got %v", stateStore.attempts)
+	}
+}
+
+func Test_SynchronizeRepos_tolerates_missing_wikis(t *testing.T) {
+	aWiki := entity.NewWikiRepository(entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "some_repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://someurl/some_owner/some_repo.git"},
+	})
+	remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aWiki}}
+	localVcs := fakeLocalVcs{errorOnCloneRepos: fmt.Errorf("could not clone repository. %w", entity.ErrRepositoryNotFound)}
+	stateStore := fakeStateStore{}
+
+	SynchronizeRepos(context.Background(), "some-input", nil, &localVcs, &remoteVcs, SynchronizationOpts{StateStore: &stateStore})
+
+	if len(stateStore.attempts) != 0 {
+		t.Fatalf("expected wikis without any page not to be recorded as failures, got %v", stateStore.attempts)
+	}
+}
+
+type fakeExporter struct {
+	mutex               sync.Mutex
+	exportedDirectories []string
+	errorOnExport       error
+}
+
+func (f *fakeExporter) Name() string {
+	return "fake"
+}
+
+func (f *fakeExporter) Export(_ context.Context, _ entity.Repository, directory string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.exportedDirectories = append(f.exportedDirectories, directory)
+	return f.errorOnExport
+}
+
+func Test_SynchronizeRepos_exports_repositories(t *testing.T) {
+	aRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "some_repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://someurl"},
+		LastActivityAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("exports run even when the git synchronization fails", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, errorOnSynchonizeRepos: fmt.Errorf("some error")}
+		failingExporter := fakeExporter{errorOnExport: fmt.Errorf("some error")}
+		exporter := fakeExporter{}
+
+		SynchronizeRepos(context.Background(), "some-input", nil, &localVcs, &remoteVcs, SynchronizationOpts{Exporters: []service.RepositoryExporter{&failingExporter, &exporter}})
+
+		if len(exporter.exportedDirectories) != 1 || exporter.exportedDirectories[0] != "/data/some_owner/some_repo" {
+			t.Fatalf("expected the repository to be exported, got %v", exporter.exportedDirectories)
+		}
+		if len(failingExporter.exportedDirectories) != 1 {
+			t.Fatalf("expected the failing exporter to be called, got %v", failingExporter.exportedDirectories)
+		}
+	})
+
+	t.Run("unchanged repositories are exported", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository}, lastSynchronizedAt: map[string]time.Time{"some_owner/some_repo": time.Now()}}
+		exporter := fakeExporter{}
+
+		SynchronizeRepos(context.Background(), "some-input", nil, &localVcs, &remoteVcs, SynchronizationOpts{SkipUnchanged: true, Exporters: []service.RepositoryExporter{&exporter}})
+
+		if len(localVcs.synchronizedRepositories) != 0 || len(exporter.exportedDirectories) != 1 {
+			t.Fatalf("expected the unchanged repository to only be exported, got %v and %v", localVcs.synchronizedRepositories, exporter.exportedDirectories)
+		}
+	})
+}
+
+func Test_SynchronizeRepositories(t *testing.T) {
+	aRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "some_repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://someurl"},
+	}
+	aNewRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some_owner"},
+		RepositoryName: entity.RepositoryName{Name: "new_repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://someurl/new"},
+	}
+	requested := func(repository entity.Repository) entity.Repository {
+		return entity.Repository{OwnerName: repository.OwnerName, RepositoryName: repository.RepositoryName}
+	}
+
+	t.Run("only requested repositories are synchronized and exported", func(t *testing.T) {
+		anotherRepository := aRepository
+		anotherRepository.RepositoryName = entity.RepositoryName{Name: "another_repo"}
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aRepository, anotherRepository, aNewRepository}}
+		localVcs := fakeLocalVcs{ownedRepos: []entity.Repository{aRepository, anotherRepository}}
+		exporter := fakeExporter{}
+
+		SynchronizeRepositories(context.Background(), "some-input", nil, &localVcs, &remoteVcs, []entity.Repository{requested(aRepository), requested(aNewRepository)}, SynchronizationOpts{Exporters: []service.RepositoryExporter{&exporter}})
+
+		if !containsAll(localVcs.synchronizedRepositories, []entity.Repository{aRepository}) {
+			t.Errorf("expected only the requested repository to be synchronized. got %v", localVcs.synchronizedRepositories)
+		}
+		if !containsAll(localVcs.clonedRepositories, []entity.Repository{aNewRepository}) {
+			t.Errorf("expected the requested repository to be cloned with its remote. got %v", localVcs.clonedRepositories)
+		}
+		if len(exporter.exportedDirectories) != 2 {
+			t.Errorf("expected the requested repositories to be exported. got %v", exporter.exportedDirectories)
+		}
+	})
+
+	t.Run("repositories not listed or not selected by the input are not cloned", func(t *testing.T) {
+		remoteVcs := fakeRemoteVcs{ownedRepos: []entity.Repository{aNewRepository}}
+		localVcs := fakeLocalVcs{}
+		unknownRepository := entity.Repository{OwnerName: entity.OwnerName{Name: "someone_else"}, RepositoryName: entity.RepositoryName{Name: "some_repo"}}
+
+		SynchronizeRepositories(context.Background(), "some-input", []*regexp.Regexp{regexOrFail("new_repo", t)}, &localVcs, &remoteVcs, []entity.Repository{unknownRepository, requested(aNewRepository)}, SynchronizationOpts{})
+
+		if len(localVcs.clonedRepositories) != 0 {
+			t.Errorf("expected no repository to be cloned. got %v", localVcs.clonedRepositories)
+		}
+	})
+}
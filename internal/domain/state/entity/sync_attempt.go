@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+type Operation string
+
+const (
+	OperationClone       Operation = "clone"
+	OperationSynchronize Operation = "synchronize"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// SyncAttempt is one clone or synchronization of a repository
+type SyncAttempt struct {
+	InputName      string
+	RepositoryName string
+	Operation      Operation
+	StartedAt      time.Time
+	EndedAt        time.Time
+	Outcome        Outcome
+	Error          string
+	RefsUpdated    int
+	RefsPreserved  int
+	BytesFetched   int64
+	// LfsObjectsFailed counts the LFS objects which could not be downloaded, without failing the attempt
+	LfsObjectsFailed int
+	// Tries is how many times the operation was tried during the run, transient failures being retried
+	Tries int
+}
+
+func (s SyncAttempt) IsSuccess() bool {
+	return s.Outcome == OutcomeSuccess
+}
@@ -0,0 +1,21 @@
+package service
+
+import "github.com/Muscaw/GitFortress/internal/domain/state/entity"
+
+// KeptAttemptsPerRepository is the number of most recent attempts kept for every repository. Older ones are dropped
+const KeptAttemptsPerRepository = 100
+
+type StateStore interface {
+	RecordAttempt(attempt entity.SyncAttempt) error
+	// ListInputs returns the inputs having at least one recorded attempt
+	ListInputs() ([]string, error)
+	// ListRepositories returns the full names of the repositories of the input having at least one recorded attempt
+	ListRepositories(inputName string) ([]string, error)
+	// ListAttempts returns the recorded attempts of the repository, oldest first
+	ListAttempts(inputName string, repositoryName string) ([]entity.SyncAttempt, error)
+	// GetLastAttempt returns nil when no attempt was recorded for the repository
+	GetLastAttempt(inputName string, repositoryName string) (*entity.SyncAttempt, error)
+	// GetLastSuccess returns nil when no attempt of the repository succeeded
+	GetLastSuccess(inputName string, repositoryName string) (*entity.SyncAttempt, error)
+	Close() error
+}
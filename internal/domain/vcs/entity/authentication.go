@@ -1,5 +1,20 @@
 package entity
 
+type SSHKey struct {
+	PrivateKeyPath string
+	Passphrase     string
+	// KnownHostsPath defaults to the known_hosts files of the user when empty
+	KnownHostsPath string
+}
+
 type Auth struct {
-	Token string
+	Username string
+	Token    string
+	// SSHKey is used to clone and fetch over SSH instead of HTTP when set
+	SSHKey *SSHKey
+}
+
+// GetAuthentication makes a single Auth usable as the authentication of every repository
+func (a Auth) GetAuthentication(_ Repository) Auth {
+	return a
 }
@@ -0,0 +1,12 @@
+package entity
+
+// SynchronizationResult describes what a clone or a synchronization brought into the local repository
+type SynchronizationResult struct {
+	RefsUpdated  int
+	BytesFetched int64
+	// PreservedRefs are the references keeping the previous tips of references rewritten or deleted on the remote
+	PreservedRefs []string
+	// LfsObjectsFailed counts the LFS objects which could not be downloaded. They do not fail the synchronization
+	// and are downloaded again on the next one
+	LfsObjectsFailed int
+}
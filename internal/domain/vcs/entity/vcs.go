@@ -1,10 +1,14 @@
 package entity
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"strings"
+	"time"
 )
 
+// OwnerName can span multiple path components, such as organization/project for Azure DevOps repositories
 type OwnerName struct {
 	Name string
 }
@@ -13,23 +17,140 @@ type RepositoryName struct {
 	Name string
 }
 
+// Remote holds the urls known for a remote. Forges provide both, local repositories only the one they were cloned with
 type Remote struct {
 	Name    string
 	HttpUrl string
+	SshUrl  string
 }
 
-func NewRemote(name string, httpUrl string) (Remote, error) {
-	if strings.HasPrefix(httpUrl, "http") || strings.HasPrefix(httpUrl, "https") {
-		return Remote{Name: name, HttpUrl: httpUrl}, nil
+func IsHttpUrl(remoteUrl string) bool {
+	return strings.HasPrefix(remoteUrl, "http://") || strings.HasPrefix(remoteUrl, "https://")
+}
+
+// IsSshUrl matches both ssh://user@host/path and the scp-like user@host:path syntax
+func IsSshUrl(remoteUrl string) bool {
+	if strings.HasPrefix(remoteUrl, "ssh://") {
+		return true
+	}
+	beforeColon, _, found := strings.Cut(remoteUrl, ":")
+	return found && !strings.Contains(beforeColon, "/") && strings.Contains(beforeColon, "@")
+}
+
+func NewRemote(name string, remoteUrl string) (Remote, error) {
+	if IsHttpUrl(remoteUrl) {
+		return Remote{Name: name, HttpUrl: remoteUrl}, nil
+	} else if IsSshUrl(remoteUrl) {
+		return Remote{Name: name, SshUrl: remoteUrl}, nil
 	} else {
-		return Remote{}, fmt.Errorf("remote httpUrl must contain a HTTP/HTTPS url. Received %v", httpUrl)
+		return Remote{}, fmt.Errorf("remote url must contain a HTTP/HTTPS or SSH url. Received %v", remoteUrl)
+	}
+}
+
+// GetUrl returns the HTTP url of the remote, or its SSH url when the HTTP url is unknown
+func (r Remote) GetUrl() string {
+	if r.HttpUrl != "" {
+		return r.HttpUrl
+	}
+	return r.SshUrl
+}
+
+func parseRepositoryName(name string) string {
+	return strings.TrimSuffix(name, ".git")
+}
+
+func getRemoteUrlPath(remoteUrl string) (string, error) {
+	if IsSshUrl(remoteUrl) && !strings.HasPrefix(remoteUrl, "ssh://") {
+		_, remotePath, _ := strings.Cut(remoteUrl, ":")
+		return remotePath, nil
+	}
+	parsedUrl, err := url.Parse(remoteUrl)
+	if err != nil {
+		return "", err
+	}
+	return parsedUrl.Path, nil
+}
+
+// GetUrlPath returns the path of a HTTP/HTTPS or SSH url, such as owner/repository.git for git@github.com:owner/repository.git
+func GetUrlPath(remoteUrl string) (string, error) {
+	return getRemoteUrlPath(remoteUrl)
+}
+
+// GetUrlHost returns the host name of a HTTP/HTTPS or SSH url
+func GetUrlHost(remoteUrl string) (string, error) {
+	if IsSshUrl(remoteUrl) && !strings.HasPrefix(remoteUrl, "ssh://") {
+		beforeColon, _, _ := strings.Cut(remoteUrl, ":")
+		_, host, _ := strings.Cut(beforeColon, "@")
+		return host, nil
+	}
+	parsedUrl, err := url.Parse(remoteUrl)
+	if err != nil {
+		return "", err
 	}
+	return parsedUrl.Hostname(), nil
 }
 
+// ParseRemoteUrl extracts the owner and the repository from urls such as https://github.com/owner/repository.git
+// or git@github.com:owner/repository.git.
+// Azure DevOps urls (https://dev.azure.com/organization/project/_git/repository) have organization/project as owner
+func ParseRemoteUrl(remoteUrl string) (OwnerName, RepositoryName, error) {
+	remotePath, err := getRemoteUrlPath(remoteUrl)
+	if err != nil {
+		return OwnerName{}, RepositoryName{}, fmt.Errorf("could not parse remote url %v: %w", remoteUrl, err)
+	}
+	parts := strings.Split(strings.Trim(remotePath, "/"), "/")
+	// Azure DevOps SSH urls are git@ssh.dev.azure.com:v3/organization/project/repository
+	if strings.Contains(remoteUrl, "ssh.dev.azure.com") && len(parts) == 4 && parts[0] == "v3" {
+		return OwnerName{Name: strings.Join(parts[1:3], "/")}, RepositoryName{Name: parts[3]}, nil
+	}
+	if len(parts) >= 3 && parts[len(parts)-2] == "_git" {
+		return OwnerName{Name: strings.Join(parts[:len(parts)-2], "/")}, RepositoryName{Name: parseRepositoryName(parts[len(parts)-1])}, nil
+	}
+	if len(parts) < 2 {
+		return OwnerName{}, RepositoryName{}, fmt.Errorf("could not find owner and repository in remote url: %v", remoteUrl)
+	}
+	return OwnerName{Name: parts[len(parts)-2]}, RepositoryName{Name: parseRepositoryName(parts[len(parts)-1])}, nil
+}
+
+// ErrRepositoryNotFound is returned when the remote repository does not exist or is empty, such as wikis without any page
+var ErrRepositoryNotFound = errors.New("remote repository not found")
+
+// ErrAccessDenied is returned when the remote rejects the credentials, which retrying does not fix
+var ErrAccessDenied = errors.New("remote repository access denied")
+
+// RepositoryKind tells what a repository holds. The zero value is the code of a project
+type RepositoryKind string
+
+const (
+	KindCode RepositoryKind = ""
+	KindWiki RepositoryKind = "wiki"
+	KindGist RepositoryKind = "gist"
+)
+
+// Visibility is the visibility reported by the forge. Secret gists are private
+type Visibility string
+
+const (
+	VisibilityPublic   Visibility = "public"
+	VisibilityPrivate  Visibility = "private"
+	VisibilityInternal Visibility = "internal"
+)
+
 type Repository struct {
 	OwnerName      OwnerName
 	RepositoryName RepositoryName
 	Remote         Remote
+	// LastActivityAt is the last push reported by the forge. Zero when unknown
+	LastActivityAt time.Time
+	Kind           RepositoryKind
+	// The attributes below are reported by the forge to filter repositories. They are left empty when unknown
+	Fork       bool
+	Archived   bool
+	Visibility Visibility
+	// SizeKB is the size of the git data in kilobytes
+	SizeKB   int64
+	Topics   []string
+	Language string
 }
 
 func (r Repository) GetFullName() string {
@@ -39,3 +160,21 @@ func (r Repository) GetFullName() string {
 func IsEqual(r1, r2 Repository) bool {
 	return r1.OwnerName == r2.OwnerName && r1.RepositoryName == r2.RepositoryName
 }
+
+func getWikiUrl(remoteUrl string) string {
+	if remoteUrl == "" {
+		return ""
+	}
+	return strings.TrimSuffix(remoteUrl, ".git") + ".wiki.git"
+}
+
+// NewWikiRepository returns the wiki of a repository, stored in the <repository>.wiki.git repository by GitHub and GitLab.
+// The last activity of the repository does not cover its wiki, so it is left unknown
+func NewWikiRepository(repository Repository) Repository {
+	return Repository{
+		OwnerName:      repository.OwnerName,
+		RepositoryName: RepositoryName{Name: repository.RepositoryName.Name + ".wiki"},
+		Remote:         Remote{Name: repository.Remote.Name, HttpUrl: getWikiUrl(repository.Remote.HttpUrl), SshUrl: getWikiUrl(repository.Remote.SshUrl)},
+		Kind:           KindWiki,
+	}
+}
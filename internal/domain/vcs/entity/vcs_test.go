@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ParseRemoteUrl(t *testing.T) {
+	testCases := []struct {
+		url           string
+		expectedOwner string
+		expectedRepo  string
+	}{
+		{url: "https://github.com/Muscaw/GitFortress.git", expectedOwner: "Muscaw", expectedRepo: "GitFortress"},
+		{url: "https://github.com/Muscaw/GitFortress", expectedOwner: "Muscaw", expectedRepo: "GitFortress"},
+		{url: "https://dev.azure.com/some-org/Some%20Project/_git/some-repo", expectedOwner: "some-org/Some Project", expectedRepo: "some-repo"},
+		{url: "https://devops.example.com/tfs/Collection/Project/_git/some-repo", expectedOwner: "tfs/Collection/Project", expectedRepo: "some-repo"},
+		{url: "git@github.com:Muscaw/GitFortress.git", expectedOwner: "Muscaw", expectedRepo: "GitFortress"},
+		{url: "ssh://git@bitbucket.example.com:7999/proj/some-repo.git", expectedOwner: "proj", expectedRepo: "some-repo"},
+		{url: "git@ssh.dev.azure.com:v3/some-org/Some Project/some-repo", expectedOwner: "some-org/Some Project", expectedRepo: "some-repo"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.url, func(t *testing.T) {
+			owner, repo, err := ParseRemoteUrl(testCase.url)
+			if err != nil {
+				t.Fatalf("could not parse url: %v", err)
+			}
+			if owner.Name != testCase.expectedOwner || repo.Name != testCase.expectedRepo {
+				t.Fatalf("expected %v/%v, got %v/%v", testCase.expectedOwner, testCase.expectedRepo, owner.Name, repo.Name)
+			}
+		})
+	}
+
+	t.Run("url without owner", func(t *testing.T) {
+		if _, _, err := ParseRemoteUrl("https://github.com/GitFortress"); err == nil {
+			t.Fatal("expected an error for an url without owner")
+		}
+	})
+}
+
+func Test_GetUrlHost(t *testing.T) {
+	testCases := map[string]string{
+		"https://github.com/Muscaw/GitFortress.git":               "github.com",
+		"git@github.com:Muscaw/GitFortress.git":                   "github.com",
+		"ssh://git@bitbucket.example.com:7999/proj/some-repo.git": "bitbucket.example.com",
+	}
+	for remoteUrl, expectedHost := range testCases {
+		host, err := GetUrlHost(remoteUrl)
+		if err != nil || host != expectedHost {
+			t.Fatalf("expected host %v for %v, got %v: %v", expectedHost, remoteUrl, host, err)
+		}
+	}
+}
+
+func Test_NewRemote(t *testing.T) {
+	t.Run("http url", func(t *testing.T) {
+		remote, err := NewRemote("origin", "https://github.com/Muscaw/GitFortress.git")
+		if err != nil || remote.HttpUrl != "https://github.com/Muscaw/GitFortress.git" || remote.SshUrl != "" {
+			t.Fatalf("unexpected remote %v: %v", remote, err)
+		}
+	})
+
+	t.Run("ssh url", func(t *testing.T) {
+		remote, err := NewRemote("origin", "git@github.com:Muscaw/GitFortress.git")
+		if err != nil || remote.SshUrl != "git@github.com:Muscaw/GitFortress.git" || remote.HttpUrl != "" {
+			t.Fatalf("unexpected remote %v: %v", remote, err)
+		}
+		if remote.GetUrl() != remote.SshUrl {
+			t.Fatalf("expected ssh url to be used when http url is missing. got %v", remote.GetUrl())
+		}
+	})
+
+	t.Run("local path is rejected", func(t *testing.T) {
+		if _, err := NewRemote("origin", "/some/path/repo.git"); err == nil {
+			t.Fatal("expected an error for a local path")
+		}
+	})
+}
+
+func Test_NewWikiRepository(t *testing.T) {
+	repository := Repository{
+		OwnerName:      OwnerName{Name: "Muscaw"},
+		RepositoryName: RepositoryName{Name: "GitFortress"},
+		Remote:         Remote{Name: "origin", HttpUrl: "https://github.com/Muscaw/GitFortress.git", SshUrl: "git@github.com:Muscaw/GitFortress.git"},
+		LastActivityAt: time.Now(),
+	}
+	wiki := NewWikiRepository(repository)
+	if wiki.GetFullName() != "Muscaw/GitFortress.wiki" || wiki.Kind != KindWiki {
+		t.Fatalf("unexpected wiki %v", wiki)
+	}
+	if wiki.Remote.HttpUrl != "https://github.com/Muscaw/GitFortress.wiki.git" || wiki.Remote.SshUrl != "git@github.com:Muscaw/GitFortress.wiki.git" {
+		t.Fatalf("unexpected wiki remote %v", wiki.Remote)
+	}
+	if !wiki.LastActivityAt.IsZero() {
+		t.Fatalf("expected the last activity of the wiki to be unknown. got %v", wiki.LastActivityAt)
+	}
+
+	// Local wikis are found back from their remote url
+	owner, name, err := ParseRemoteUrl(wiki.Remote.HttpUrl)
+	if err != nil || !IsEqual(Repository{OwnerName: owner, RepositoryName: name}, wiki) {
+		t.Fatalf("unexpected wiki parsed from %v: %v %v %v", wiki.Remote.HttpUrl, owner, name, err)
+	}
+}
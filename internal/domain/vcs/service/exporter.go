@@ -0,0 +1,16 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+// RepositoryExporter backs up what a forge stores outside of the git data of a repository, such as issues or releases
+type RepositoryExporter interface {
+	// Name identifies the exporter in logs
+	Name() string
+	// Export writes the data of the repository into the directory. Exporters keep their own state in the directory
+	// so that only what changed since the previous export is fetched
+	Export(ctx context.Context, repository entity.Repository, directory string) error
+}
@@ -1,9 +1,22 @@
 package service
 
-import "github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+import (
+	"context"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
 
 type LocalVCS interface {
 	VCS
-	CloneRepository(repository entity.Repository) error
-	SynchronizeRepository(repository entity.Repository) error
+	CloneRepository(ctx context.Context, repository entity.Repository) (entity.SynchronizationResult, error)
+	SynchronizeRepository(ctx context.Context, repository entity.Repository) (entity.SynchronizationResult, error)
+	// LastSynchronizedAt returns the start of the last successful clone or synchronization. Zero when unknown
+	LastSynchronizedAt(repository entity.Repository) (time.Time, error)
+	// ArchiveRepository moves the repository out of the synchronized repositories, keeping it with a description of when it vanished
+	ArchiveRepository(repository entity.Repository) error
+	// PurgeArchivedRepositories removes the repositories archived before the given time and returns how many archives were removed
+	PurgeArchivedRepositories(archivedBefore time.Time) (int, error)
+	// GetDataDirectory returns the directory where the data exported from the forge is stored next to the repository
+	GetDataDirectory(repository entity.Repository) (string, error)
 }
@@ -0,0 +1,12 @@
+package service
+
+import "github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+
+// SyncRequester asks for synchronizations outside of the schedule of an input, such as when a forge notifies a push
+type SyncRequester interface {
+	// RequestRepository synchronizes a single repository of the input, cloning it when it is not mirrored yet.
+	// Only the owner and name of the repository are needed
+	RequestRepository(repository entity.Repository)
+	// RequestFullRun synchronizes the whole input, such as when repositories are created or deleted
+	RequestFullRun()
+}
@@ -7,4 +7,5 @@ type VCS interface {
 }
 
 type RemoteAuthenticationProvider interface {
+	GetAuthentication(repository entity.Repository) entity.Auth
 }
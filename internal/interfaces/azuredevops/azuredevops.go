@@ -0,0 +1,132 @@
+package azuredevops
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+)
+
+const apiVersion = "7.0"
+
+type azureRepository struct {
+	Name       string `json:"name"`
+	RemoteUrl  string `json:"remoteUrl"`
+	SshUrl     string `json:"sshUrl"`
+	IsDisabled bool   `json:"isDisabled"`
+}
+
+type azureRepositoryList struct {
+	Value []azureRepository `json:"value"`
+}
+
+type AzureDevOpsOpts struct {
+	// HTTPClient sends the API requests. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type azureDevOpsVCS struct {
+	client          *http.Client
+	organizationUrl string
+	token           string
+	projects        []string
+}
+
+func (a *azureDevOpsVCS) ListOwnedRepositories() ([]entity.Repository, error) {
+	if len(a.projects) == 0 {
+		return a.listRepositories(fmt.Sprintf("%v/_apis/git/repositories?api-version=%v", a.organizationUrl, apiVersion))
+	}
+
+	var allRepos []entity.Repository
+	for _, project := range a.projects {
+		repos, err := a.listRepositories(fmt.Sprintf("%v/%v/_apis/git/repositories?api-version=%v", a.organizationUrl, url.PathEscape(project), apiVersion))
+		if err != nil {
+			return nil, fmt.Errorf("could not list repositories of project %v: %w", project, err)
+		}
+		allRepos = append(allRepos, repos...)
+	}
+	return allRepos, nil
+}
+
+func (a *azureDevOpsVCS) listRepositories(requestUrl string) ([]entity.Repository, error) {
+	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Personal access tokens are sent as the password of a basic authentication with an empty username
+	req.SetBasicAuth("", a.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %v when listing repositories from %v", resp.StatusCode, requestUrl)
+	}
+
+	var repositoryList azureRepositoryList
+	if err := json.NewDecoder(resp.Body).Decode(&repositoryList); err != nil {
+		return nil, fmt.Errorf("could not decode repositories from %v: %w", requestUrl, err)
+	}
+
+	var repos []entity.Repository
+	for _, r := range repositoryList.Value {
+		// Disabled repositories can not be cloned nor fetched
+		if r.IsDisabled {
+			continue
+		}
+		repo, err := azureRepositoryToDomainRepository(r)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+// GetAzureDevOpsVCS lists the repositories of the given projects, or of every project of the organization when none are given.
+// organizationUrl is expected to be https://dev.azure.com/<organization>
+func GetAzureDevOpsVCS(organizationUrl string, token string, projects []string, options AzureDevOpsOpts) (service.VCS, error) {
+	parsedUrl, err := url.Parse(organizationUrl)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse azure devops url %v: %w", organizationUrl, err)
+	}
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &azureDevOpsVCS{
+		client:          httpClient,
+		organizationUrl: strings.TrimSuffix(parsedUrl.String(), "/"),
+		token:           token,
+		projects:        projects,
+	}, nil
+}
+
+// azureRepositoryToDomainRepository uses organization/project as the owner of the repository,
+// as found in remote urls such as https://dev.azure.com/organization/project/_git/repository
+func azureRepositoryToDomainRepository(repo azureRepository) (entity.Repository, error) {
+	remoteUrl, err := url.Parse(repo.RemoteUrl)
+	if err != nil {
+		return entity.Repository{}, fmt.Errorf("could not parse remote url of repository %v: %w", repo.Name, err)
+	}
+	// Remote urls contain the organization as username
+	remoteUrl.User = nil
+
+	owner, _, found := strings.Cut(strings.Trim(remoteUrl.Path, "/"), "/_git/")
+	if !found {
+		return entity.Repository{}, fmt.Errorf("unexpected remote url for repository %v: %v", repo.Name, repo.RemoteUrl)
+	}
+	return entity.Repository{
+		OwnerName:      entity.OwnerName{Name: owner},
+		RepositoryName: entity.RepositoryName{Name: repo.Name},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: remoteUrl.String(), SshUrl: repo.SshUrl},
+	}, nil
+}
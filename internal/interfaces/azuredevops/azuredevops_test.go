@@ -0,0 +1,88 @@
+package azuredevops
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const someRepos string = `
+{
+  "value": [
+    {
+      "id": "5febef5a-833d-4e14-b9c0-14cb638f91e6",
+      "name": "some-repo",
+      "url": "https://dev.azure.com/some-org/_apis/git/repositories/5febef5a-833d-4e14-b9c0-14cb638f91e6",
+      "project": {"id": "6ce954b1-ce1f-45d1-b94d-e6bf2464ba2c", "name": "Some Project"},
+      "remoteUrl": "https://some-org@dev.azure.com/some-org/Some%20Project/_git/some-repo",
+      "sshUrl": "git@ssh.dev.azure.com:v3/some-org/Some%20Project/some-repo",
+      "isDisabled": false
+    },
+    {
+      "id": "2f3d611a-f012-4b39-b157-8db63f380226",
+      "name": "disabled-repo",
+      "project": {"id": "6ce954b1-ce1f-45d1-b94d-e6bf2464ba2c", "name": "Some Project"},
+      "remoteUrl": "https://some-org@dev.azure.com/some-org/Some%20Project/_git/disabled-repo",
+      "isDisabled": true
+    }
+  ],
+  "count": 2
+}
+`
+
+func Test_list_owned_repositories_of_projects(t *testing.T) {
+	var requestedUri string
+	var username, password string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedUri = r.RequestURI
+		username, password, _ = r.BasicAuth()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(someRepos))
+	}))
+	defer testServer.Close()
+
+	azure, err := GetAzureDevOpsVCS(testServer.URL+"/some-org", "some-token", []string{"Some Project"}, AzureDevOpsOpts{})
+	if err != nil {
+		t.FailNow()
+	}
+
+	repos, err := azure.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if requestedUri != "/some-org/Some%20Project/_apis/git/repositories?api-version=7.0" {
+		t.Fatalf("unexpected request %v", requestedUri)
+	}
+	if username != "" || password != "some-token" {
+		t.Fatalf("expected basic authentication with the token as password. got %v:%v", username, password)
+	}
+	if len(repos) != 1 {
+		t.Fatalf("expected disabled repositories to be skipped. got %v repos", len(repos))
+	}
+	if repos[0].GetFullName() != "some-org/Some Project/some-repo" {
+		t.Fatalf("unexpected repository %v", repos[0].GetFullName())
+	}
+	if repos[0].Remote.HttpUrl != "https://dev.azure.com/some-org/Some%20Project/_git/some-repo" {
+		t.Fatalf("unexpected remote url %v", repos[0].Remote.HttpUrl)
+	}
+}
+
+func Test_list_owned_repositories_uses_the_given_http_client(t *testing.T) {
+	stalled := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer testServer.Close()
+	defer close(stalled)
+
+	azure, err := GetAzureDevOpsVCS(testServer.URL+"/some-org", "some-token", nil, AzureDevOpsOpts{HTTPClient: &http.Client{Timeout: 50 * time.Millisecond}})
+	if err != nil {
+		t.FailNow()
+	}
+
+	if _, err := azure.ListOwnedRepositories(); err == nil {
+		t.Fatal("expected the stalled listing to time out")
+	}
+}
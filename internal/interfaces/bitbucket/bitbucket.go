@@ -0,0 +1,107 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type link struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type repositoryLinks struct {
+	Clone []link `json:"clone"`
+}
+
+type BitbucketOpts struct {
+	// HTTPClient sends the API requests. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type apiClient struct {
+	client   *http.Client
+	apiUrl   string
+	username string
+	token    string
+}
+
+func newApiClient(apiUrl string, username string, token string, options BitbucketOpts) (apiClient, error) {
+	parsedUrl, err := url.Parse(apiUrl)
+	if err != nil {
+		return apiClient{}, fmt.Errorf("could not parse bitbucket url %v: %w", apiUrl, err)
+	}
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return apiClient{
+		client:   httpClient,
+		apiUrl:   strings.TrimSuffix(parsedUrl.String(), "/"),
+		username: username,
+		token:    token,
+	}, nil
+}
+
+// getJSON authenticates with basic auth when a username is configured (app passwords),
+// otherwise the token is sent as a bearer token (HTTP access tokens)
+func (a apiClient) getJSON(requestUrl string, target any) error {
+	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return err
+	}
+	if a.username != "" {
+		req.SetBasicAuth(a.username, a.token)
+	} else {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", a.token))
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %v when calling %v", resp.StatusCode, requestUrl)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("could not decode response from %v: %w", requestUrl, err)
+	}
+	return nil
+}
+
+func findCloneLink(links repositoryLinks, names ...string) (string, error) {
+	for _, name := range names {
+		for _, l := range links.Clone {
+			if l.Name == name {
+				return stripUserInfo(l.Href)
+			}
+		}
+	}
+	return "", fmt.Errorf("could not find any %v clone link", names)
+}
+
+// findSshLink returns the ssh clone link as is, the user it contains is the one expected by the ssh server
+func findSshLink(links repositoryLinks) string {
+	for _, l := range links.Clone {
+		if l.Name == "ssh" {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// stripUserInfo removes the username Bitbucket adds to clone links so that the configured credentials are used
+func stripUserInfo(cloneUrl string) (string, error) {
+	parsedUrl, err := url.Parse(cloneUrl)
+	if err != nil {
+		return "", fmt.Errorf("could not parse clone url %v: %w", cloneUrl, err)
+	}
+	parsedUrl.User = nil
+	return parsedUrl.String(), nil
+}
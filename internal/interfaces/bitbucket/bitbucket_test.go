@@ -0,0 +1,125 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_cloud_list_owned_repositories_of_workspaces(t *testing.T) {
+	var requestedUris []string
+	var username, password string
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedUris = append(requestedUris, r.RequestURI)
+		username, password, _ = r.BasicAuth()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "" {
+			fmt.Fprintf(w, `{
+  "values": [{"slug": "some-repo", "workspace": {"slug": "some-workspace"}, "links": {"clone": [
+    {"href": "https://someone@bitbucket.org/some-workspace/some-repo.git", "name": "https"},
+    {"href": "git@bitbucket.org:some-workspace/some-repo.git", "name": "ssh"}
+  ]}}],
+  "next": "%v/repositories/some-workspace?pagelen=100&page=2"
+}`, testServer.URL)
+		} else {
+			w.Write([]byte(`{"values": [{"slug": "other-repo", "workspace": {"slug": "some-workspace"}, "links": {"clone": [
+    {"href": "https://someone@bitbucket.org/some-workspace/other-repo.git", "name": "https"}
+  ]}}]}`))
+		}
+	}))
+	defer testServer.Close()
+
+	bitbucket, err := GetBitbucketCloudVCS(testServer.URL, "someone", "app-password", []string{"some-workspace"}, BitbucketOpts{})
+	if err != nil {
+		t.FailNow()
+	}
+
+	repos, err := bitbucket.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if len(requestedUris) != 2 || requestedUris[0] != "/repositories/some-workspace?pagelen=100" {
+		t.Fatalf("unexpected requests %v", requestedUris)
+	}
+	if username != "someone" || password != "app-password" {
+		t.Fatalf("expected basic authentication with the app password. got %v:%v", username, password)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("expected 2 repos, got %v", len(repos))
+	}
+	if repos[0].GetFullName() != "some-workspace/some-repo" {
+		t.Fatalf("unexpected repository %v", repos[0].GetFullName())
+	}
+	if repos[0].Remote.HttpUrl != "https://bitbucket.org/some-workspace/some-repo.git" {
+		t.Fatalf("username should be removed from clone url. got %v", repos[0].Remote.HttpUrl)
+	}
+}
+
+func Test_server_list_owned_repositories(t *testing.T) {
+	var requestedUris []string
+	var authorization string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedUris = append(requestedUris, r.RequestURI)
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("start") == "0" {
+			w.Write([]byte(`{"values": [{"slug": "some-repo", "project": {"key": "PROJ"}, "links": {"clone": [
+    {"href": "ssh://git@bitbucket.example.com:7999/proj/some-repo.git", "name": "ssh"},
+    {"href": "https://someone@bitbucket.example.com/scm/proj/some-repo.git", "name": "http"}
+  ]}}], "isLastPage": false, "nextPageStart": 1}`))
+		} else {
+			w.Write([]byte(`{"values": [{"slug": "other-repo", "project": {"key": "PROJ"}, "links": {"clone": [
+    {"href": "https://bitbucket.example.com/scm/proj/other-repo.git", "name": "http"}
+  ]}}], "isLastPage": true}`))
+		}
+	}))
+	defer testServer.Close()
+
+	bitbucket, err := GetBitbucketServerVCS(testServer.URL, "", "some-token", []string{"PROJ"}, BitbucketOpts{})
+	if err != nil {
+		t.FailNow()
+	}
+
+	repos, err := bitbucket.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if len(requestedUris) != 2 || requestedUris[1] != "/rest/api/1.0/projects/PROJ/repos?limit=100&start=1" {
+		t.Fatalf("unexpected requests %v", requestedUris)
+	}
+	if authorization != "Bearer some-token" {
+		t.Fatalf("expected bearer authentication. got %v", authorization)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("expected 2 repos, got %v", len(repos))
+	}
+	if repos[0].GetFullName() != "proj/some-repo" {
+		t.Fatalf("unexpected repository %v", repos[0].GetFullName())
+	}
+	if repos[0].Remote.HttpUrl != "https://bitbucket.example.com/scm/proj/some-repo.git" {
+		t.Fatalf("unexpected clone url %v", repos[0].Remote.HttpUrl)
+	}
+}
+
+func Test_list_owned_repositories_uses_the_given_http_client(t *testing.T) {
+	stalled := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer testServer.Close()
+	defer close(stalled)
+
+	bitbucket, err := GetBitbucketServerVCS(testServer.URL, "", "some-token", []string{"PROJ"}, BitbucketOpts{HTTPClient: &http.Client{Timeout: 50 * time.Millisecond}})
+	if err != nil {
+		t.FailNow()
+	}
+
+	if _, err := bitbucket.ListOwnedRepositories(); err == nil {
+		t.Fatal("expected the stalled listing to time out")
+	}
+}
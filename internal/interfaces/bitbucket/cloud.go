@@ -0,0 +1,88 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+)
+
+const cloudPageSize = 100
+
+type cloudWorkspace struct {
+	Slug string `json:"slug"`
+}
+
+type cloudRepository struct {
+	Slug      string          `json:"slug"`
+	Workspace cloudWorkspace  `json:"workspace"`
+	Links     repositoryLinks `json:"links"`
+}
+
+type cloudRepositoryPage struct {
+	Values []cloudRepository `json:"values"`
+	Next   string            `json:"next"`
+}
+
+type bitbucketCloudVCS struct {
+	api        apiClient
+	workspaces []string
+}
+
+func (b *bitbucketCloudVCS) ListOwnedRepositories() ([]entity.Repository, error) {
+	if len(b.workspaces) == 0 {
+		return b.listRepositories(fmt.Sprintf("%v/repositories?role=owner&pagelen=%v", b.api.apiUrl, cloudPageSize))
+	}
+
+	var allRepos []entity.Repository
+	for _, workspace := range b.workspaces {
+		repos, err := b.listRepositories(fmt.Sprintf("%v/repositories/%v?pagelen=%v", b.api.apiUrl, url.PathEscape(workspace), cloudPageSize))
+		if err != nil {
+			return nil, fmt.Errorf("could not list repositories of workspace %v: %w", workspace, err)
+		}
+		allRepos = append(allRepos, repos...)
+	}
+	return allRepos, nil
+}
+
+func (b *bitbucketCloudVCS) listRepositories(firstPageUrl string) ([]entity.Repository, error) {
+	var allRepos []entity.Repository
+	nextPageUrl := firstPageUrl
+	for nextPageUrl != "" {
+		var page cloudRepositoryPage
+		if err := b.api.getJSON(nextPageUrl, &page); err != nil {
+			return nil, err
+		}
+		for _, r := range page.Values {
+			repo, err := cloudRepositoryToDomainRepository(r)
+			if err != nil {
+				return nil, err
+			}
+			allRepos = append(allRepos, repo)
+		}
+		nextPageUrl = page.Next
+	}
+	return allRepos, nil
+}
+
+// GetBitbucketCloudVCS lists repositories of the given workspaces, or the repositories owned by the user when none are given
+func GetBitbucketCloudVCS(bitbucketUrl string, username string, appPassword string, workspaces []string, options BitbucketOpts) (service.VCS, error) {
+	api, err := newApiClient(bitbucketUrl, username, appPassword, options)
+	if err != nil {
+		return nil, err
+	}
+	return &bitbucketCloudVCS{api: api, workspaces: workspaces}, nil
+}
+
+func cloudRepositoryToDomainRepository(repo cloudRepository) (entity.Repository, error) {
+	cloneUrl, err := findCloneLink(repo.Links, "https")
+	if err != nil {
+		return entity.Repository{}, fmt.Errorf("could not map repository %v/%v: %w", repo.Workspace.Slug, repo.Slug, err)
+	}
+	return entity.Repository{
+		OwnerName:      entity.OwnerName{Name: repo.Workspace.Slug},
+		RepositoryName: entity.RepositoryName{Name: repo.Slug},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: cloneUrl, SshUrl: findSshLink(repo.Links)},
+	}, nil
+}
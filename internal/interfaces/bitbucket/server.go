@@ -0,0 +1,94 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+)
+
+const serverPageSize = 100
+
+type serverProject struct {
+	Key string `json:"key"`
+}
+
+type serverRepository struct {
+	Slug    string          `json:"slug"`
+	Project serverProject   `json:"project"`
+	Links   repositoryLinks `json:"links"`
+}
+
+type serverRepositoryPage struct {
+	Values        []serverRepository `json:"values"`
+	IsLastPage    bool               `json:"isLastPage"`
+	NextPageStart int                `json:"nextPageStart"`
+}
+
+type bitbucketServerVCS struct {
+	api      apiClient
+	projects []string
+}
+
+func (b *bitbucketServerVCS) ListOwnedRepositories() ([]entity.Repository, error) {
+	if len(b.projects) == 0 {
+		return b.listRepositories(fmt.Sprintf("%v/rest/api/1.0/repos", b.api.apiUrl))
+	}
+
+	var allRepos []entity.Repository
+	for _, project := range b.projects {
+		repos, err := b.listRepositories(fmt.Sprintf("%v/rest/api/1.0/projects/%v/repos", b.api.apiUrl, url.PathEscape(project)))
+		if err != nil {
+			return nil, fmt.Errorf("could not list repositories of project %v: %w", project, err)
+		}
+		allRepos = append(allRepos, repos...)
+	}
+	return allRepos, nil
+}
+
+func (b *bitbucketServerVCS) listRepositories(baseUrl string) ([]entity.Repository, error) {
+	var allRepos []entity.Repository
+	start := 0
+	for {
+		var page serverRepositoryPage
+		if err := b.api.getJSON(fmt.Sprintf("%v?limit=%v&start=%v", baseUrl, serverPageSize, start), &page); err != nil {
+			return nil, err
+		}
+		for _, r := range page.Values {
+			repo, err := serverRepositoryToDomainRepository(r)
+			if err != nil {
+				return nil, err
+			}
+			allRepos = append(allRepos, repo)
+		}
+		if page.IsLastPage || len(page.Values) == 0 {
+			break
+		}
+		start = page.NextPageStart
+	}
+	return allRepos, nil
+}
+
+// GetBitbucketServerVCS lists repositories of the given projects, or every repository visible to the token when none are given
+func GetBitbucketServerVCS(bitbucketUrl string, username string, token string, projects []string, options BitbucketOpts) (service.VCS, error) {
+	api, err := newApiClient(bitbucketUrl, username, token, options)
+	if err != nil {
+		return nil, err
+	}
+	return &bitbucketServerVCS{api: api, projects: projects}, nil
+}
+
+func serverRepositoryToDomainRepository(repo serverRepository) (entity.Repository, error) {
+	cloneUrl, err := findCloneLink(repo.Links, "http", "https")
+	if err != nil {
+		return entity.Repository{}, fmt.Errorf("could not map repository %v/%v: %w", repo.Project.Key, repo.Slug, err)
+	}
+	return entity.Repository{
+		// Clone urls use the lowercase project key (/scm/proj/repo.git). Matching it keeps local and remote repositories equal
+		OwnerName:      entity.OwnerName{Name: strings.ToLower(repo.Project.Key)},
+		RepositoryName: entity.RepositoryName{Name: repo.Slug},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: cloneUrl, SshUrl: findSshLink(repo.Links)},
+	}, nil
+}
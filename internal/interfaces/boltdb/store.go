@@ -0,0 +1,183 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/state/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/state/service"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultMaxAttemptsPerRepository bounds the history kept for every repository
+const DefaultMaxAttemptsPerRepository = service.KeptAttemptsPerRepository
+
+// boltStateStore keeps one bucket per input, containing one bucket per repository whose keys are increasing sequence numbers
+type boltStateStore struct {
+	db                       *bolt.DB
+	maxAttemptsPerRepository int
+}
+
+func (b *boltStateStore) RecordAttempt(attempt entity.SyncAttempt) error {
+	value, err := json.Marshal(attempt)
+	if err != nil {
+		return fmt.Errorf("could not encode attempt of repository %v: %w", attempt.RepositoryName, err)
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		inputBucket, err := tx.CreateBucketIfNotExists([]byte(attempt.InputName))
+		if err != nil {
+			return fmt.Errorf("could not create bucket of input %v: %w", attempt.InputName, err)
+		}
+		repositoryBucket, err := inputBucket.CreateBucketIfNotExists([]byte(attempt.RepositoryName))
+		if err != nil {
+			return fmt.Errorf("could not create bucket of repository %v: %w", attempt.RepositoryName, err)
+		}
+		sequence, err := repositoryBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := repositoryBucket.Put(sequenceToKey(sequence), value); err != nil {
+			return fmt.Errorf("could not record attempt of repository %v: %w", attempt.RepositoryName, err)
+		}
+		return b.trim(repositoryBucket)
+	})
+}
+
+// trim removes the oldest attempts above the configured maximum
+func (b *boltStateStore) trim(repositoryBucket *bolt.Bucket) error {
+	var keys [][]byte
+	err := repositoryBucket.ForEach(func(key []byte, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(keys)-b.maxAttemptsPerRepository; i++ {
+		if err := repositoryBucket.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *boltStateStore) ListInputs() ([]string, error) {
+	var inputs []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			inputs = append(inputs, string(name))
+			return nil
+		})
+	})
+	return inputs, err
+}
+
+func (b *boltStateStore) ListRepositories(inputName string) ([]string, error) {
+	var repositories []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		inputBucket := tx.Bucket([]byte(inputName))
+		if inputBucket == nil {
+			return nil
+		}
+		return inputBucket.ForEachBucket(func(name []byte) error {
+			repositories = append(repositories, string(name))
+			return nil
+		})
+	})
+	return repositories, err
+}
+
+func (b *boltStateStore) ListAttempts(inputName string, repositoryName string) ([]entity.SyncAttempt, error) {
+	var attempts []entity.SyncAttempt
+	err := b.viewRepository(inputName, repositoryName, func(repositoryBucket *bolt.Bucket) error {
+		return repositoryBucket.ForEach(func(_ []byte, value []byte) error {
+			attempt, err := decodeAttempt(value)
+			if err != nil {
+				return err
+			}
+			attempts = append(attempts, attempt)
+			return nil
+		})
+	})
+	return attempts, err
+}
+
+func (b *boltStateStore) GetLastAttempt(inputName string, repositoryName string) (*entity.SyncAttempt, error) {
+	return b.findLast(inputName, repositoryName, func(entity.SyncAttempt) bool { return true })
+}
+
+func (b *boltStateStore) GetLastSuccess(inputName string, repositoryName string) (*entity.SyncAttempt, error) {
+	return b.findLast(inputName, repositoryName, entity.SyncAttempt.IsSuccess)
+}
+
+// findLast walks the attempts from the newest and returns the first one matching
+func (b *boltStateStore) findLast(inputName string, repositoryName string, matches func(entity.SyncAttempt) bool) (*entity.SyncAttempt, error) {
+	var found *entity.SyncAttempt
+	err := b.viewRepository(inputName, repositoryName, func(repositoryBucket *bolt.Bucket) error {
+		cursor := repositoryBucket.Cursor()
+		for _, value := cursor.Last(); value != nil; _, value = cursor.Prev() {
+			attempt, err := decodeAttempt(value)
+			if err != nil {
+				return err
+			}
+			if matches(attempt) {
+				found = &attempt
+				return nil
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (b *boltStateStore) viewRepository(inputName string, repositoryName string, f func(*bolt.Bucket) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		inputBucket := tx.Bucket([]byte(inputName))
+		if inputBucket == nil {
+			return nil
+		}
+		repositoryBucket := inputBucket.Bucket([]byte(repositoryName))
+		if repositoryBucket == nil {
+			return nil
+		}
+		return f(repositoryBucket)
+	})
+}
+
+func (b *boltStateStore) Close() error {
+	return b.db.Close()
+}
+
+func sequenceToKey(sequence uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+	return key
+}
+
+func decodeAttempt(value []byte) (entity.SyncAttempt, error) {
+	var attempt entity.SyncAttempt
+	if err := json.Unmarshal(value, &attempt); err != nil {
+		return entity.SyncAttempt{}, fmt.Errorf("could not decode attempt: %w", err)
+	}
+	return attempt, nil
+}
+
+type StateStoreOpts struct {
+	Path string
+	// MaxAttemptsPerRepository defaults to DefaultMaxAttemptsPerRepository
+	MaxAttemptsPerRepository int
+}
+
+func OpenStateStore(options StateStoreOpts) (service.StateStore, error) {
+	db, err := bolt.Open(options.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open state store %v: %w", options.Path, err)
+	}
+	maxAttemptsPerRepository := options.MaxAttemptsPerRepository
+	if maxAttemptsPerRepository <= 0 {
+		maxAttemptsPerRepository = DefaultMaxAttemptsPerRepository
+	}
+	return &boltStateStore{db: db, maxAttemptsPerRepository: maxAttemptsPerRepository}, nil
+}
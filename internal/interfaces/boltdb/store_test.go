@@ -0,0 +1,113 @@
+package boltdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/state/entity"
+)
+
+func openTestStore(t *testing.T, maxAttemptsPerRepository int) (*boltStateStore, func()) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	store, err := OpenStateStore(StateStoreOpts{Path: filepath.Join(dirName, "gitfortress.db"), MaxAttemptsPerRepository: maxAttemptsPerRepository})
+	if err != nil {
+		t.Fatalf("could not open state store: %v", err)
+	}
+	return store.(*boltStateStore), func() {
+		store.Close()
+		os.RemoveAll(dirName)
+	}
+}
+
+func someAttempt(repositoryName string, startedAt time.Time, outcome entity.Outcome) entity.SyncAttempt {
+	return entity.SyncAttempt{
+		InputName:      "some-input",
+		RepositoryName: repositoryName,
+		Operation:      entity.OperationSynchronize,
+		StartedAt:      startedAt,
+		EndedAt:        startedAt.Add(time.Second),
+		Outcome:        outcome,
+	}
+}
+
+func Test_RecordAttempt(t *testing.T) {
+	store, cleanup := openTestStore(t, 0)
+	defer cleanup()
+
+	startedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	attempts := []entity.SyncAttempt{
+		someAttempt("some-owner/some-repo", startedAt, entity.OutcomeSuccess),
+		someAttempt("some-owner/some-repo", startedAt.Add(time.Hour), entity.OutcomeFailure),
+		someAttempt("some-owner/other-repo", startedAt, entity.OutcomeSuccess),
+	}
+	attempts[1].Error = "could not fetch"
+	for _, attempt := range attempts {
+		if err := store.RecordAttempt(attempt); err != nil {
+			t.Fatalf("could not record attempt: %v", err)
+		}
+	}
+
+	t.Run("inputs and repositories are listed", func(t *testing.T) {
+		inputs, err := store.ListInputs()
+		if err != nil || len(inputs) != 1 || inputs[0] != "some-input" {
+			t.Fatalf("unexpected inputs %v: %v", inputs, err)
+		}
+		repositories, err := store.ListRepositories("some-input")
+		if err != nil || len(repositories) != 2 {
+			t.Fatalf("unexpected repositories %v: %v", repositories, err)
+		}
+	})
+
+	t.Run("attempts are listed oldest first", func(t *testing.T) {
+		listed, err := store.ListAttempts("some-input", "some-owner/some-repo")
+		if err != nil {
+			t.Fatalf("could not list attempts: %v", err)
+		}
+		if len(listed) != 2 || !listed[0].StartedAt.Equal(startedAt) || listed[1].Error != "could not fetch" {
+			t.Fatalf("unexpected attempts %v", listed)
+		}
+	})
+
+	t.Run("last attempt and last success", func(t *testing.T) {
+		lastAttempt, err := store.GetLastAttempt("some-input", "some-owner/some-repo")
+		if err != nil || lastAttempt == nil || lastAttempt.Outcome != entity.OutcomeFailure {
+			t.Fatalf("unexpected last attempt %v: %v", lastAttempt, err)
+		}
+		lastSuccess, err := store.GetLastSuccess("some-input", "some-owner/some-repo")
+		if err != nil || lastSuccess == nil || !lastSuccess.StartedAt.Equal(startedAt) {
+			t.Fatalf("unexpected last success %v: %v", lastSuccess, err)
+		}
+	})
+
+	t.Run("unknown repository has no attempt", func(t *testing.T) {
+		lastAttempt, err := store.GetLastAttempt("other-input", "some-owner/some-repo")
+		if err != nil || lastAttempt != nil {
+			t.Fatalf("unexpected last attempt %v: %v", lastAttempt, err)
+		}
+	})
+}
+
+func Test_RecordAttempt_keeps_a_bounded_history(t *testing.T) {
+	store, cleanup := openTestStore(t, 3)
+	defer cleanup()
+
+	startedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		if err := store.RecordAttempt(someAttempt("some-owner/some-repo", startedAt.Add(time.Duration(i)*time.Hour), entity.OutcomeSuccess)); err != nil {
+			t.Fatalf("could not record attempt: %v", err)
+		}
+	}
+
+	listed, err := store.ListAttempts("some-input", "some-owner/some-repo")
+	if err != nil {
+		t.Fatalf("could not list attempts: %v", err)
+	}
+	if len(listed) != 3 || !listed[0].StartedAt.Equal(startedAt.Add(2*time.Hour)) {
+		t.Fatalf("expected the 3 newest attempts to be kept. got %v", listed)
+	}
+}
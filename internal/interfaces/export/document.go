@@ -0,0 +1,71 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Version of the documents written by the exporters. It is increased whenever the content of a document changes in an incompatible way
+const Version = 1
+
+// Document wraps every exported file so that readers know which version of the format they read
+type Document struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exportedAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// WriteDocument writes the data wrapped in a document. The previous document is only replaced once the new one is fully written
+func WriteDocument(path string, data any) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	content, err = json.MarshalIndent(Document{Version: Version, ExportedAt: time.Now().UTC(), Data: content}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = StoreFile(bytes.NewReader(content), path)
+	return err
+}
+
+// ReadDocument decodes the data of the document into data. It returns false when the document does not exist
+func ReadDocument(path string, data any) (bool, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var document Document
+	if err := json.Unmarshal(content, &document); err != nil {
+		return false, fmt.Errorf("could not decode %v: %w", path, err)
+	}
+	if document.Version > Version {
+		return false, fmt.Errorf("%v was written with the newer version %v of the format", path, document.Version)
+	}
+	if err := json.Unmarshal(document.Data, data); err != nil {
+		return false, fmt.Errorf("could not decode %v: %w", path, err)
+	}
+	return true, nil
+}
+
+// State tells when the last successful export started, so that the next export only fetches what changed since then
+type State struct {
+	Since time.Time `json:"since"`
+}
+
+// ReadState returns the zero state when nothing was exported yet
+func ReadState(path string) (State, error) {
+	var state State
+	_, err := ReadDocument(path, &state)
+	return state, err
+}
+
+func WriteState(path string, state State) error {
+	return WriteDocument(path, state)
+}
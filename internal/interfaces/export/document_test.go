@@ -0,0 +1,135 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_WriteDocument_ReadDocument(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	path := filepath.Join(dirName, "issues", "1.json")
+	if err := WriteDocument(path, map[string]string{"title": "some issue"}); err != nil {
+		t.Fatalf("could not write document: %v", err)
+	}
+	var data map[string]string
+	found, err := ReadDocument(path, &data)
+	if err != nil || !found || data["title"] != "some issue" {
+		t.Fatalf("unexpected document %v %v: %v", found, data, err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Fatalf("temporary files must be removed. got %v", entries)
+	}
+
+	found, err = ReadDocument(filepath.Join(dirName, "missing.json"), &data)
+	if err != nil || found {
+		t.Fatalf("expected missing documents not to be found. got %v: %v", found, err)
+	}
+}
+
+func Test_ReadDocument_newer_version(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	path := filepath.Join(dirName, "state.json")
+	os.WriteFile(path, []byte(`{"version": 99, "data": {}}`), 0644)
+	if _, err := ReadState(path); err == nil {
+		t.Fatal("expected documents of a newer version to be rejected")
+	}
+}
+
+func Test_ReadState(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	path := filepath.Join(dirName, "state.json")
+	state, err := ReadState(path)
+	if err != nil || !state.Since.IsZero() {
+		t.Fatalf("expected an empty state when nothing was exported. got %v: %v", state, err)
+	}
+	since := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	if err := WriteState(path, State{Since: since}); err != nil {
+		t.Fatalf("could not write state: %v", err)
+	}
+	state, err = ReadState(path)
+	if err != nil || !state.Since.Equal(since) {
+		t.Fatalf("unexpected state %v: %v", state, err)
+	}
+}
+
+func Test_StoreFile(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	path := filepath.Join(dirName, "releases", "v1", "firmware.bin")
+	stored, err := StoreFile(strings.NewReader("some firmware"), path)
+	if err != nil {
+		t.Fatalf("could not store file: %v", err)
+	}
+	if stored.Size != 13 || stored.Sha256 != "93590f6931f6294c3224192cf62967f5ac16ac01f400773aa1defd887c9a4ed4" {
+		t.Fatalf("unexpected stored file %v", stored)
+	}
+	if !IsStored(path, 13) || IsStored(path, 12) {
+		t.Fatal("expected the file to be stored with its size")
+	}
+}
+
+func Test_SafeFileName(t *testing.T) {
+	for name, expected := range map[string]string{"v1.0": "v1.0", "release/v1": "release_v1", "..": "_..", "": "_"} {
+		if safeName := SafeFileName(name); safeName != expected {
+			t.Fatalf("expected %v for %v. got %v", expected, name, safeName)
+		}
+	}
+}
+
+func Test_WriteSnapshot(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	type settings struct {
+		DefaultBranch string `json:"defaultBranch"`
+	}
+	changed, err := WriteSnapshot(dirName, settings{DefaultBranch: "main"})
+	if err != nil || !changed {
+		t.Fatalf("expected the first snapshot to be written. got %v: %v", changed, err)
+	}
+	changed, err = WriteSnapshot(dirName, settings{DefaultBranch: "main"})
+	if err != nil || changed {
+		t.Fatalf("expected unchanged settings not to be written again. got %v: %v", changed, err)
+	}
+	history, _ := os.ReadDir(filepath.Join(dirName, "history"))
+	if len(history) != 1 {
+		t.Fatalf("expected a single snapshot in the history. got %v", history)
+	}
+
+	// Snapshots taken within the same second replace each other in the history
+	changed, err = WriteSnapshot(dirName, settings{DefaultBranch: "develop"})
+	if err != nil || !changed {
+		t.Fatalf("expected changed settings to be written. got %v: %v", changed, err)
+	}
+	var current settings
+	if _, err := ReadDocument(filepath.Join(dirName, "current.json"), &current); err != nil || current.DefaultBranch != "develop" {
+		t.Fatalf("unexpected current snapshot %v: %v", current, err)
+	}
+}
@@ -0,0 +1,57 @@
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StoredFile describes a file written by StoreFile
+type StoredFile struct {
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// StoreFile writes the content of the reader at path and returns its size and checksum.
+// The previous file is only replaced once the content is fully written, so that interrupted downloads never replace a valid file
+func StoreFile(reader io.Reader, path string) (StoredFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return StoredFile{}, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return StoredFile{}, err
+	}
+	defer os.Remove(file.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return StoredFile{}, fmt.Errorf("could not write %v: %w", path, err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return StoredFile{}, err
+	}
+	return StoredFile{Size: size, Sha256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// IsStored tells whether the file exists with the given size
+func IsStored(path string, size int64) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Size() == size
+}
+
+// SafeFileName turns names coming from the forge, such as tags or asset names, into a single path component
+func SafeFileName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_" + name
+	}
+	return name
+}
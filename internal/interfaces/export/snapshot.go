@@ -0,0 +1,37 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"time"
+)
+
+const snapshotTimestampFormat = "20060102T150405Z"
+
+// WriteSnapshot keeps the data in <directory>/current.json and, whenever it changes, a copy in <directory>/history/<time>.json.
+// It returns whether the data changed since the previous snapshot
+func WriteSnapshot(directory string, data any) (bool, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+	currentPath := filepath.Join(directory, "current.json")
+	var previous json.RawMessage
+	found, err := ReadDocument(currentPath, &previous)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		// Documents are indented, the previous data is compacted to be compared
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, previous); err == nil && bytes.Equal(compacted.Bytes(), content) {
+			return false, nil
+		}
+	}
+	historyPath := filepath.Join(directory, "history", time.Now().UTC().Format(snapshotTimestampFormat)+".json")
+	if err := WriteDocument(historyPath, json.RawMessage(content)); err != nil {
+		return false, err
+	}
+	return true, WriteDocument(currentPath, json.RawMessage(content))
+}
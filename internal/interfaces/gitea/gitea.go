@@ -0,0 +1,122 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+)
+
+const pageSize = 50
+
+type giteaOwner struct {
+	Login string `json:"login"`
+}
+
+type giteaRepository struct {
+	Name     string     `json:"name"`
+	Owner    giteaOwner `json:"owner"`
+	CloneURL string     `json:"clone_url"`
+	SshURL   string     `json:"ssh_url"`
+}
+
+type GiteaOpts struct {
+	// HTTPClient sends the API requests. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type giteaVCS struct {
+	client *http.Client
+	apiUrl string
+	token  string
+}
+
+func (g *giteaVCS) ListOwnedRepositories() ([]entity.Repository, error) {
+	var allRepos []entity.Repository
+	page := 1
+	for {
+		repos, hasNextPage, err := g.listUserRepositories(page)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range repos {
+			allRepos = append(allRepos, giteaRepositoryToDomainRepository(r))
+		}
+		if !hasNextPage || len(repos) == 0 {
+			break
+		}
+		page += 1
+	}
+	return allRepos, nil
+}
+
+func (g *giteaVCS) listUserRepositories(page int) ([]giteaRepository, bool, error) {
+	requestUrl := fmt.Sprintf("%v/user/repos?page=%v&limit=%v", g.apiUrl, page, pageSize)
+	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("token %v", g.token))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("unexpected status code %v when listing repositories from %v", resp.StatusCode, requestUrl)
+	}
+
+	var repos []giteaRepository
+	if err := json.NewDecoder(resp.Body).Decode(&repos); err != nil {
+		return nil, false, fmt.Errorf("could not decode repositories from %v: %w", requestUrl, err)
+	}
+	return repos, hasNextLink(resp.Header.Get("Link")), nil
+}
+
+func hasNextLink(linkHeader string) bool {
+	for _, link := range strings.Split(linkHeader, ",") {
+		if strings.Contains(link, `rel="next"`) {
+			return true
+		}
+	}
+	return false
+}
+
+func GetGiteaVCS(giteaUrl string, giteaToken string, options GiteaOpts) (service.VCS, error) {
+	apiUrl, err := getApiUrl(giteaUrl)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &giteaVCS{client: httpClient, apiUrl: apiUrl, token: giteaToken}, nil
+}
+
+func getApiUrl(giteaUrl string) (string, error) {
+	parsedUrl, err := url.Parse(giteaUrl)
+	if err != nil {
+		return "", fmt.Errorf("could not parse gitea url %v: %w", giteaUrl, err)
+	}
+	apiUrl := strings.TrimSuffix(parsedUrl.String(), "/")
+	if !strings.HasSuffix(apiUrl, "/api/v1") {
+		apiUrl = apiUrl + "/api/v1"
+	}
+	return apiUrl, nil
+}
+
+func giteaRepositoryToDomainRepository(repo giteaRepository) entity.Repository {
+	return entity.Repository{
+		OwnerName:      entity.OwnerName{Name: repo.Owner.Login},
+		RepositoryName: entity.RepositoryName{Name: repo.Name},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: repo.CloneURL, SshUrl: repo.SshURL},
+	}
+}
@@ -0,0 +1,148 @@
+package gitea
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const firstPage string = `
+[
+  {
+    "id": 1,
+    "name": "some-repo",
+    "full_name": "octocat/some-repo",
+    "owner": {"id": 1, "login": "octocat"},
+    "private": false,
+    "clone_url": "https://forgejo.example.com/octocat/some-repo.git",
+    "ssh_url": "git@forgejo.example.com:octocat/some-repo.git"
+  }
+]
+`
+
+const secondPage string = `
+[
+  {
+    "id": 2,
+    "name": "other-repo",
+    "full_name": "octocat/other-repo",
+    "owner": {"id": 1, "login": "octocat"},
+    "private": true,
+    "clone_url": "https://forgejo.example.com/octocat/other-repo.git",
+    "ssh_url": "git@forgejo.example.com:octocat/other-repo.git"
+  }
+]
+`
+
+func Test_list_owned_repositories_no_repositories_available(t *testing.T) {
+	var authorization string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("[]"))
+	}))
+	defer testServer.Close()
+
+	gitea, err := GetGiteaVCS(testServer.URL, "some-token", GiteaOpts{})
+	if err != nil {
+		t.FailNow()
+	}
+
+	repos, err := gitea.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if len(repos) != 0 {
+		t.Fatalf("expected 0 repos, got %v", len(repos))
+	}
+
+	if authorization != "token some-token" {
+		t.Fatalf("expected authorization header token some-token. got %v", authorization)
+	}
+}
+
+func Test_list_owned_repositories_follows_pagination(t *testing.T) {
+	var requestedUris []string
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedUris = append(requestedUris, r.RequestURI)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("Link", fmt.Sprintf(`<%v/api/v1/user/repos?page=2&limit=50>; rel="next",<%v/api/v1/user/repos?page=2&limit=50>; rel="last"`, testServer.URL, testServer.URL))
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(firstPage))
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(secondPage))
+		}
+	}))
+	defer testServer.Close()
+
+	gitea, err := GetGiteaVCS(testServer.URL, "some-token", GiteaOpts{})
+	if err != nil {
+		t.FailNow()
+	}
+
+	repos, err := gitea.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if len(requestedUris) != 2 {
+		t.Fatalf("expected 2 requests, got %v", requestedUris)
+	}
+	if requestedUris[0] != "/api/v1/user/repos?page=1&limit=50" {
+		t.Fatalf("unexpected first request %v", requestedUris[0])
+	}
+
+	if len(repos) != 2 {
+		t.Fatalf("expected 2 repos, got %v", len(repos))
+	}
+	if repos[1].GetFullName() != "octocat/other-repo" {
+		t.Fatalf("unexpected repository %v", repos[1].GetFullName())
+	}
+	if repos[1].Remote.HttpUrl != "https://forgejo.example.com/octocat/other-repo.git" {
+		t.Fatalf("unexpected remote url %v", repos[1].Remote.HttpUrl)
+	}
+	if repos[1].Remote.SshUrl != "git@forgejo.example.com:octocat/other-repo.git" {
+		t.Fatalf("unexpected ssh url %v", repos[1].Remote.SshUrl)
+	}
+}
+
+func Test_list_owned_repositories_error_status(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer testServer.Close()
+
+	gitea, err := GetGiteaVCS(testServer.URL, "some-token", GiteaOpts{})
+	if err != nil {
+		t.FailNow()
+	}
+
+	_, err = gitea.ListOwnedRepositories()
+	if err == nil {
+		t.Fatal("expected an error when the server answers with 401")
+	}
+}
+
+func Test_list_owned_repositories_uses_the_given_http_client(t *testing.T) {
+	stalled := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer testServer.Close()
+	defer close(stalled)
+
+	gitea, err := GetGiteaVCS(testServer.URL, "some-token", GiteaOpts{HTTPClient: &http.Client{Timeout: 50 * time.Millisecond}})
+	if err != nil {
+		t.FailNow()
+	}
+
+	if _, err := gitea.ListOwnedRepositories(); err == nil {
+		t.Fatal("expected the stalled listing to time out")
+	}
+}
@@ -2,52 +2,226 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
 	"github.com/google/go-github/v58/github"
 )
 
+type GithubOpts struct {
+	// Affiliations of the authenticated user to the listed repositories: owner, collaborator and/or organization_member
+	Affiliations []string
+	// Organizations whose repositories are all listed
+	Organizations []string
+	// Teams in the organization/team-slug format whose repositories are listed
+	Teams []string
+	// Wikis also lists the wiki of every repository having the wiki feature enabled
+	Wikis bool
+	// Gists also lists the public and secret gists of the authenticated user
+	Gists bool
+	// HTTPClient sends the API requests. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
 type githubVCS struct {
-	client *github.Client
+	client        *github.Client
+	affiliations  []string
+	organizations []string
+	teams         []string
+	wikis         bool
+	gists         bool
 }
 
 func (v *githubVCS) ListOwnedRepositories() ([]entity.Repository, error) {
 	var allRepos []entity.Repository
-	options := &github.RepositoryListByAuthenticatedUserOptions{Affiliation: "owner"}
+	listedRepos := map[string]bool{}
+	addRepositories := func(repos []*github.Repository) {
+		for _, r := range repos {
+			repo := githubRepositoryToDomainRepository(r)
+			// The same repository can be reached through an affiliation, its organization and a team
+			if !listedRepos[repo.GetFullName()] {
+				listedRepos[repo.GetFullName()] = true
+				allRepos = append(allRepos, repo)
+				if v.wikis && r.GetHasWiki() {
+					allRepos = append(allRepos, entity.NewWikiRepository(repo))
+				}
+			}
+		}
+	}
+
+	if len(v.affiliations) > 0 {
+		repos, err := v.listAuthenticatedUserRepositories()
+		if err != nil {
+			return nil, err
+		}
+		addRepositories(repos)
+	}
+	for _, organization := range v.organizations {
+		repos, err := v.listOrganizationRepositories(organization)
+		if err != nil {
+			return nil, fmt.Errorf("could not list repositories of organization %v: %w", organization, err)
+		}
+		addRepositories(repos)
+	}
+	for _, team := range v.teams {
+		repos, err := v.listTeamRepositories(team)
+		if err != nil {
+			return nil, fmt.Errorf("could not list repositories of team %v: %w", team, err)
+		}
+		addRepositories(repos)
+	}
+	if v.gists {
+		gists, err := v.listGists()
+		if err != nil {
+			return nil, fmt.Errorf("could not list gists: %w", err)
+		}
+		for _, g := range gists {
+			allRepos = append(allRepos, githubGistToDomainRepository(g))
+		}
+	}
+
+	return allRepos, nil
+}
+
+func (v *githubVCS) listAuthenticatedUserRepositories() ([]*github.Repository, error) {
+	var allRepos []*github.Repository
+	options := &github.RepositoryListByAuthenticatedUserOptions{Affiliation: strings.Join(v.affiliations, ",")}
 	for {
 		repos, resp, err := v.client.Repositories.ListByAuthenticatedUser(context.Background(), options)
 		if err != nil {
 			return nil, err
 		}
-		for _, r := range repos {
-			allRepos = append(allRepos, githubRepositoryToDomainRepository(r))
+		allRepos = append(allRepos, repos...)
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	return allRepos, nil
+}
+
+func (v *githubVCS) listOrganizationRepositories(organization string) ([]*github.Repository, error) {
+	var allRepos []*github.Repository
+	options := &github.RepositoryListByOrgOptions{Type: "all"}
+	for {
+		repos, resp, err := v.client.Repositories.ListByOrg(context.Background(), organization, options)
+		if err != nil {
+			return nil, err
 		}
+		allRepos = append(allRepos, repos...)
 		if resp.NextPage == 0 {
 			break
 		}
 		options.Page = resp.NextPage
 	}
+	return allRepos, nil
+}
 
+func (v *githubVCS) listTeamRepositories(team string) ([]*github.Repository, error) {
+	organization, teamSlug, found := strings.Cut(team, "/")
+	if !found {
+		return nil, fmt.Errorf("team must be in the organization/team-slug format: %v", team)
+	}
+	var allRepos []*github.Repository
+	options := &github.ListOptions{}
+	for {
+		repos, resp, err := v.client.Teams.ListTeamReposBySlug(context.Background(), organization, teamSlug, options)
+		if err != nil {
+			return nil, err
+		}
+		allRepos = append(allRepos, repos...)
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
 	return allRepos, nil
 }
 
-func GetGithubVCS(githubUrl string, githubToken string) (service.VCS, error) {
-	client, err := getGithubClient(githubUrl, githubToken)
+func (v *githubVCS) listGists() ([]*github.Gist, error) {
+	var allGists []*github.Gist
+	options := &github.GistListOptions{}
+	for {
+		// The gists of the authenticated user include the secret ones
+		gists, resp, err := v.client.Gists.List(context.Background(), "", options)
+		if err != nil {
+			return nil, err
+		}
+		allGists = append(allGists, gists...)
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	return allGists, nil
+}
+
+// GetGithubVCS lists the repositories owned by the authenticated user unless affiliations, organizations or teams are given
+func GetGithubVCS(githubUrl string, githubToken string, options GithubOpts) (service.VCS, error) {
+	client, err := getGithubClient(githubUrl, githubToken, options.HTTPClient)
 	if err != nil {
 		return nil, err
 	}
-	return &githubVCS{client: client}, nil
+	affiliations := options.Affiliations
+	if len(affiliations) == 0 && len(options.Organizations) == 0 && len(options.Teams) == 0 {
+		affiliations = []string{"owner"}
+	}
+	return &githubVCS{client: client, affiliations: affiliations, organizations: options.Organizations, teams: options.Teams, wikis: options.Wikis, gists: options.Gists}, nil
 }
 
-func getGithubClient(githubUrl string, githubToken string) (*github.Client, error) {
-	return github.NewClient(nil).WithAuthToken(githubToken).WithEnterpriseURLs(githubUrl, githubUrl)
+func getGithubClient(githubUrl string, githubToken string, httpClient *http.Client) (*github.Client, error) {
+	return github.NewClient(httpClient).WithAuthToken(githubToken).WithEnterpriseURLs(githubUrl, githubUrl)
 }
 
 func githubRepositoryToDomainRepository(repo *github.Repository) entity.Repository {
 	return entity.Repository{
 		OwnerName:      entity.OwnerName{Name: *repo.Owner.Login},
 		RepositoryName: entity.RepositoryName{Name: *repo.Name},
-		Remote:         entity.Remote{Name: "origin", HttpUrl: *repo.CloneURL},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: *repo.CloneURL, SshUrl: repo.GetSSHURL()},
+		LastActivityAt: repo.GetPushedAt().Time,
+		Fork:           repo.GetFork(),
+		Archived:       repo.GetArchived(),
+		Visibility:     getVisibility(repo),
+		SizeKB:         int64(repo.GetSize()),
+		Topics:         repo.Topics,
+		Language:       repo.GetLanguage(),
+	}
+}
+
+// getVisibility falls back to the private flag, as older GitHub Enterprise Server instances do not report the visibility
+func getVisibility(repo *github.Repository) entity.Visibility {
+	if repo.GetVisibility() != "" {
+		return entity.Visibility(repo.GetVisibility())
+	}
+	if repo.GetPrivate() {
+		return entity.VisibilityPrivate
+	}
+	return entity.VisibilityPublic
+}
+
+// gistSshHost serves the gists of github.com over SSH. The SSH url of gists is not reported by the API
+const gistSshHost = "gist.github.com"
+
+// githubGistToDomainRepository names gists gists/<id> within their owner, as gist urls such as
+// https://gist.github.com/<id>.git do not contain any owner nor name
+func githubGistToDomainRepository(gist *github.Gist) entity.Repository {
+	remote := entity.Remote{Name: "origin", HttpUrl: gist.GetGitPullURL()}
+	if host, err := entity.GetUrlHost(remote.HttpUrl); err == nil && host == gistSshHost {
+		remote.SshUrl = fmt.Sprintf("git@%v:%v.git", gistSshHost, gist.GetID())
+	}
+	visibility := entity.VisibilityPrivate
+	if gist.GetPublic() {
+		visibility = entity.VisibilityPublic
+	}
+	return entity.Repository{
+		OwnerName:      entity.OwnerName{Name: gist.GetOwner().GetLogin()},
+		RepositoryName: entity.RepositoryName{Name: "gists/" + gist.GetID()},
+		Remote:         remote,
+		LastActivityAt: gist.GetUpdatedAt().Time,
+		Kind:           entity.KindGist,
+		Visibility:     visibility,
 	}
 }
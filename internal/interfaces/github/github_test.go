@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
 )
 
 type requestInformation struct {
@@ -19,7 +22,7 @@ func Test_list_owned_repositories_no_repositories_available(t *testing.T) {
 	}))
 	defer testServer.Close()
 
-	github, err := GetGithubVCS(testServer.URL, "some-token")
+	github, err := GetGithubVCS(testServer.URL, "some-token", GithubOpts{})
 	if err != nil {
 		t.FailNow()
 	}
@@ -303,7 +306,7 @@ func Test_list_owned_repositories_some_repositories_available(t *testing.T) {
 	}))
 	defer testServer.Close()
 
-	github, err := GetGithubVCS(testServer.URL, "some-token")
+	github, err := GetGithubVCS(testServer.URL, "some-token", GithubOpts{})
 	if err != nil {
 		t.FailNow()
 	}
@@ -321,7 +324,139 @@ func Test_list_owned_repositories_some_repositories_available(t *testing.T) {
 		t.Fatalf("expected 0 repos, got %v", len(repos))
 	}
 
+	if !repos[0].LastActivityAt.Equal(time.Date(2011, 1, 26, 19, 6, 43, 0, time.UTC)) {
+		t.Fatalf("expected last activity to be the last push. got %v", repos[0].LastActivityAt)
+	}
+
+	if repos[0].Fork || repos[0].Archived || repos[0].Visibility != entity.VisibilityPublic || repos[0].SizeKB != 108 || len(repos[0].Topics) == 0 {
+		t.Fatalf("expected the attributes of the repository to be reported. got %v", repos[0])
+	}
+
 	if ri.headers.Get("Authorization") != "Bearer some-token" {
 		t.Fatalf("expected authorization header Bearer some-token. got %v", ri.headers.Get("Authorization"))
 	}
 }
+
+func Test_list_owned_repositories_of_organizations_and_teams(t *testing.T) {
+	var requestedPaths []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPaths = append(requestedPaths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(someRepos))
+	}))
+	defer testServer.Close()
+
+	github, err := GetGithubVCS(testServer.URL, "some-token", GithubOpts{Organizations: []string{"some-org"}, Teams: []string{"some-org/some-team"}})
+	if err != nil {
+		t.FailNow()
+	}
+
+	repos, err := github.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	expectedPaths := []string{"/api/v3/orgs/some-org/repos", "/api/v3/orgs/some-org/teams/some-team/repos"}
+	if len(requestedPaths) != len(expectedPaths) || requestedPaths[0] != expectedPaths[0] || requestedPaths[1] != expectedPaths[1] {
+		t.Fatalf("expected requests %v, got %v", expectedPaths, requestedPaths)
+	}
+
+	if len(repos) != 2 {
+		t.Fatalf("repositories listed twice must be deduplicated. expected 2 repos, got %v", len(repos))
+	}
+}
+
+func Test_list_owned_repositories_with_affiliations(t *testing.T) {
+	var ri *requestInformation
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ri = &requestInformation{requestUri: r.RequestURI, headers: r.Header}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("[]"))
+	}))
+	defer testServer.Close()
+
+	github, err := GetGithubVCS(testServer.URL, "some-token", GithubOpts{Affiliations: []string{"owner", "organization_member"}})
+	if err != nil {
+		t.FailNow()
+	}
+
+	if _, err := github.ListOwnedRepositories(); err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if ri == nil || ri.requestUri != "/api/v3/user/repos?affiliation=owner%2Corganization_member" {
+		t.Fatalf("unexpected request %v", ri)
+	}
+}
+
+func Test_list_owned_repositories_with_wikis(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(someRepos))
+	}))
+	defer testServer.Close()
+
+	github, err := GetGithubVCS(testServer.URL, "some-token", GithubOpts{Wikis: true})
+	if err != nil {
+		t.FailNow()
+	}
+
+	repos, err := github.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if len(repos) != 4 {
+		t.Fatalf("expected every repository to be listed with its wiki. got %v", repos)
+	}
+	if repos[1].Kind != entity.KindWiki || repos[1].GetFullName() != repos[0].GetFullName()+".wiki" {
+		t.Fatalf("expected the wiki to follow its repository. got %v", repos[1])
+	}
+}
+
+func Test_list_owned_repositories_with_gists(t *testing.T) {
+	var requestedPaths []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPaths = append(requestedPaths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Path == "/api/v3/gists" {
+			w.Write([]byte(`[{"id": "aa5a315d61ae9438b18d", "public": false, "owner": {"login": "octocat"}, "git_pull_url": "https://gist.github.com/aa5a315d61ae9438b18d.git", "updated_at": "2010-04-14T02:15:15Z"}]`))
+		} else {
+			w.Write([]byte("[]"))
+		}
+	}))
+	defer testServer.Close()
+
+	github, err := GetGithubVCS(testServer.URL, "some-token", GithubOpts{Gists: true})
+	if err != nil {
+		t.FailNow()
+	}
+
+	repos, err := github.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if len(requestedPaths) != 2 || requestedPaths[1] != "/api/v3/gists" {
+		t.Fatalf("expected the gists of the authenticated user to be listed. got %v", requestedPaths)
+	}
+	if len(repos) != 1 {
+		t.Fatalf("expected 1 gist, got %v", repos)
+	}
+	gist := repos[0]
+	if gist.GetFullName() != "octocat/gists/aa5a315d61ae9438b18d" || gist.Kind != entity.KindGist {
+		t.Fatalf("unexpected gist %v", gist)
+	}
+	if gist.Remote.HttpUrl != "https://gist.github.com/aa5a315d61ae9438b18d.git" || gist.Remote.SshUrl != "git@gist.github.com:aa5a315d61ae9438b18d.git" {
+		t.Fatalf("unexpected gist remote %v", gist.Remote)
+	}
+	if !gist.LastActivityAt.Equal(time.Date(2010, 4, 14, 2, 15, 15, 0, time.UTC)) {
+		t.Fatalf("expected last activity to be the last update. got %v", gist.LastActivityAt)
+	}
+	if gist.Visibility != entity.VisibilityPrivate {
+		t.Fatalf("expected secret gists to be private. got %v", gist.Visibility)
+	}
+}
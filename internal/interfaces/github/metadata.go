@@ -0,0 +1,154 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+	"github.com/google/go-github/v58/github"
+)
+
+const metadataFolder = "metadata"
+
+const metadataPageSize = 100
+
+type issueDocument struct {
+	Issue    *github.Issue          `json:"issue"`
+	Comments []*github.IssueComment `json:"comments"`
+}
+
+type pullRequestDocument struct {
+	PullRequest    *github.PullRequest          `json:"pullRequest"`
+	Comments       []*github.IssueComment       `json:"comments"`
+	ReviewComments []*github.PullRequestComment `json:"reviewComments"`
+	Reviews        []*github.PullRequestReview  `json:"reviews"`
+}
+
+// listAllPages calls list until the last page is reached
+func listAllPages[T any](list func(options github.ListOptions) ([]T, *github.Response, error)) ([]T, error) {
+	var all []T
+	options := github.ListOptions{PerPage: metadataPageSize}
+	for {
+		items, resp, err := list(options)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+// githubMetadataExporter exports the issues, pull requests, comments, labels and milestones of repositories.
+// Issues and pull requests are only fetched again once updated, which includes new comments and reviews
+type githubMetadataExporter struct {
+	client *github.Client
+}
+
+func (e *githubMetadataExporter) Name() string {
+	return "github-metadata"
+}
+
+func (e *githubMetadataExporter) Export(ctx context.Context, repository entity.Repository, directory string) error {
+	if repository.Kind != entity.KindCode {
+		return nil
+	}
+	owner, repo := repository.OwnerName.Name, repository.RepositoryName.Name
+	metadataDirectory := filepath.Join(directory, metadataFolder)
+	statePath := filepath.Join(metadataDirectory, "state.json")
+	state, err := export.ReadState(statePath)
+	if err != nil {
+		return err
+	}
+	startedAt := time.Now()
+
+	labels, err := listAllPages(func(options github.ListOptions) ([]*github.Label, *github.Response, error) {
+		return e.client.Issues.ListLabels(ctx, owner, repo, &options)
+	})
+	if err != nil {
+		return fmt.Errorf("could not list labels: %w", err)
+	}
+	if err := export.WriteDocument(filepath.Join(metadataDirectory, "labels.json"), labels); err != nil {
+		return err
+	}
+
+	milestones, err := listAllPages(func(options github.ListOptions) ([]*github.Milestone, *github.Response, error) {
+		return e.client.Issues.ListMilestones(ctx, owner, repo, &github.MilestoneListOptions{State: "all", ListOptions: options})
+	})
+	if err != nil {
+		return fmt.Errorf("could not list milestones: %w", err)
+	}
+	if err := export.WriteDocument(filepath.Join(metadataDirectory, "milestones.json"), milestones); err != nil {
+		return err
+	}
+
+	// The issues endpoint also returns the pull requests
+	issues, err := listAllPages(func(options github.ListOptions) ([]*github.Issue, *github.Response, error) {
+		return e.client.Issues.ListByRepo(ctx, owner, repo, &github.IssueListByRepoOptions{State: "all", Since: state.Since, Sort: "updated", Direction: "asc", ListOptions: options})
+	})
+	if err != nil {
+		return fmt.Errorf("could not list issues: %w", err)
+	}
+	for _, issue := range issues {
+		if err := e.exportIssue(ctx, owner, repo, metadataDirectory, issue); err != nil {
+			return fmt.Errorf("could not export issue %v: %w", issue.GetNumber(), err)
+		}
+	}
+
+	// Issues updated during the export are fetched again next time
+	return export.WriteState(statePath, export.State{Since: startedAt})
+}
+
+func (e *githubMetadataExporter) exportIssue(ctx context.Context, owner string, repo string, metadataDirectory string, issue *github.Issue) error {
+	number := issue.GetNumber()
+	comments, err := listAllPages(func(options github.ListOptions) ([]*github.IssueComment, *github.Response, error) {
+		return e.client.Issues.ListComments(ctx, owner, repo, number, &github.IssueListCommentsOptions{ListOptions: options})
+	})
+	if err != nil {
+		return fmt.Errorf("could not list comments: %w", err)
+	}
+	if !issue.IsPullRequest() {
+		return export.WriteDocument(filepath.Join(metadataDirectory, "issues", strconv.Itoa(number)+".json"), issueDocument{Issue: issue, Comments: comments})
+	}
+
+	pullRequest, _, err := e.client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return fmt.Errorf("could not get pull request: %w", err)
+	}
+	reviewComments, err := listAllPages(func(options github.ListOptions) ([]*github.PullRequestComment, *github.Response, error) {
+		return e.client.PullRequests.ListComments(ctx, owner, repo, number, &github.PullRequestListCommentsOptions{ListOptions: options})
+	})
+	if err != nil {
+		return fmt.Errorf("could not list review comments: %w", err)
+	}
+	reviews, err := listAllPages(func(options github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
+		return e.client.PullRequests.ListReviews(ctx, owner, repo, number, &options)
+	})
+	if err != nil {
+		return fmt.Errorf("could not list reviews: %w", err)
+	}
+	return export.WriteDocument(filepath.Join(metadataDirectory, "pulls", strconv.Itoa(number)+".json"), pullRequestDocument{
+		PullRequest:    pullRequest,
+		Comments:       comments,
+		ReviewComments: reviewComments,
+		Reviews:        reviews,
+	})
+}
+
+// GetGithubMetadataExporter exports the issues and pull requests of the repositories listed by a github input
+func GetGithubMetadataExporter(githubUrl string, githubToken string, httpClient *http.Client) (service.RepositoryExporter, error) {
+	client, err := getGithubClient(githubUrl, githubToken, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return &githubMetadataExporter{client: client}, nil
+}
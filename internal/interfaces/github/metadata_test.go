@@ -0,0 +1,105 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+)
+
+const someIssues string = `
+[
+  {"number": 1, "title": "some issue", "state": "open"},
+  {"number": 2, "title": "some pull request", "state": "closed", "pull_request": {"url": "https://api.github.com/repos/octocat/Hello-World/pulls/2"}}
+]
+`
+
+func Test_export_metadata(t *testing.T) {
+	var issuesQueries []string
+	mux := http.NewServeMux()
+	writeJson := func(content string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(content))
+		}
+	}
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/labels", writeJson(`[{"name": "bug"}]`))
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/milestones", writeJson(`[{"number": 1, "title": "v1.0"}]`))
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/issues", func(w http.ResponseWriter, r *http.Request) {
+		issuesQueries = append(issuesQueries, r.URL.Query().Get("since"))
+		writeJson(someIssues)(w, r)
+	})
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/issues/1/comments", writeJson(`[{"id": 10, "body": "some comment"}]`))
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/issues/2/comments", writeJson(`[]`))
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/pulls/2", writeJson(`{"number": 2, "title": "some pull request", "merged": true}`))
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/pulls/2/comments", writeJson(`[{"id": 20, "body": "some review comment", "path": "README.md"}]`))
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/pulls/2/reviews", writeJson(`[{"id": 30, "state": "APPROVED"}]`))
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	exporter, err := GetGithubMetadataExporter(testServer.URL, "some-token", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: "octocat"}, RepositoryName: entity.RepositoryName{Name: "Hello-World"}}
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export metadata: %v", err)
+	}
+
+	var issue issueDocument
+	if found, err := export.ReadDocument(filepath.Join(dirName, "metadata", "issues", "1.json"), &issue); err != nil || !found {
+		t.Fatalf("expected issue 1 to be exported: %v", err)
+	}
+	if issue.Issue.GetTitle() != "some issue" || len(issue.Comments) != 1 {
+		t.Fatalf("unexpected issue %v", issue)
+	}
+	var pullRequest pullRequestDocument
+	if found, err := export.ReadDocument(filepath.Join(dirName, "metadata", "pulls", "2.json"), &pullRequest); err != nil || !found {
+		t.Fatalf("expected pull request 2 to be exported: %v", err)
+	}
+	if !pullRequest.PullRequest.GetMerged() || len(pullRequest.ReviewComments) != 1 || len(pullRequest.Reviews) != 1 {
+		t.Fatalf("unexpected pull request %v", pullRequest)
+	}
+	if _, err := os.Stat(filepath.Join(dirName, "metadata", "issues", "2.json")); !os.IsNotExist(err) {
+		t.Fatal("pull requests must not be exported as issues")
+	}
+	for _, name := range []string{"labels.json", "milestones.json"} {
+		if _, err := os.Stat(filepath.Join(dirName, "metadata", name)); err != nil {
+			t.Fatalf("expected %v to be exported: %v", name, err)
+		}
+	}
+
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export metadata: %v", err)
+	}
+	if len(issuesQueries) != 2 || issuesQueries[0] != "" || issuesQueries[1] == "" {
+		t.Fatalf("expected the second export to only list the issues updated since the first one. got since %v", issuesQueries)
+	}
+}
+
+func Test_export_metadata_skips_wikis(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("unexpected request %v", r.URL)
+	}))
+	defer testServer.Close()
+
+	exporter, err := GetGithubMetadataExporter(testServer.URL, "some-token", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	wiki := entity.NewWikiRepository(entity.Repository{OwnerName: entity.OwnerName{Name: "octocat"}, RepositoryName: entity.RepositoryName{Name: "Hello-World"}})
+	if err := exporter.Export(context.Background(), wiki, t.TempDir()); err != nil {
+		t.Fatalf("could not export metadata: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+	"github.com/google/go-github/v58/github"
+)
+
+const releasesFolder = "releases"
+
+type releaseDocument struct {
+	Release *github.RepositoryRelease `json:"release"`
+	// Assets are the downloaded assets by name
+	Assets map[string]export.StoredFile `json:"assets"`
+}
+
+// githubReleasesExporter downloads the releases of repositories with their notes and assets.
+// Assets already stored with the size reported by GitHub are not downloaded again
+type githubReleasesExporter struct {
+	client *github.Client
+}
+
+func (e *githubReleasesExporter) Name() string {
+	return "github-releases"
+}
+
+// getReleaseFolderName names the folder of a release after its tag. Draft releases may not have any tag yet, so they are
+// named after their id instead of sharing the same folder
+func getReleaseFolderName(release *github.RepositoryRelease) string {
+	if release.GetTagName() == "" {
+		return fmt.Sprintf("draft-%v", release.GetID())
+	}
+	return export.SafeFileName(release.GetTagName())
+}
+
+func (e *githubReleasesExporter) Export(ctx context.Context, repository entity.Repository, directory string) error {
+	if repository.Kind != entity.KindCode {
+		return nil
+	}
+	owner, repo := repository.OwnerName.Name, repository.RepositoryName.Name
+	releases, err := listAllPages(func(options github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error) {
+		return e.client.Repositories.ListReleases(ctx, owner, repo, &options)
+	})
+	if err != nil {
+		return fmt.Errorf("could not list releases: %w", err)
+	}
+	for _, release := range releases {
+		folderName := getReleaseFolderName(release)
+		if err := e.exportRelease(ctx, owner, repo, filepath.Join(directory, releasesFolder, folderName), release); err != nil {
+			return fmt.Errorf("could not export release %v: %w", folderName, err)
+		}
+	}
+	return nil
+}
+
+func (e *githubReleasesExporter) exportRelease(ctx context.Context, owner string, repo string, releaseDirectory string, release *github.RepositoryRelease) error {
+	documentPath := filepath.Join(releaseDirectory, "release.json")
+	var previous releaseDocument
+	if _, err := export.ReadDocument(documentPath, &previous); err != nil {
+		return err
+	}
+	document := releaseDocument{Release: release, Assets: map[string]export.StoredFile{}}
+	for _, asset := range release.Assets {
+		name := export.SafeFileName(asset.GetName())
+		assetPath := filepath.Join(releaseDirectory, "assets", name)
+		if stored, ok := previous.Assets[name]; ok && stored.Size == int64(asset.GetSize()) && export.IsStored(assetPath, stored.Size) {
+			document.Assets[name] = stored
+			continue
+		}
+		reader, _, err := e.client.Repositories.DownloadReleaseAsset(ctx, owner, repo, asset.GetID(), http.DefaultClient)
+		if err != nil {
+			return fmt.Errorf("could not download asset %v: %w", asset.GetName(), err)
+		}
+		stored, err := export.StoreFile(reader, assetPath)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("could not store asset %v: %w", asset.GetName(), err)
+		}
+		document.Assets[name] = stored
+	}
+	return export.WriteDocument(documentPath, document)
+}
+
+// GetGithubReleasesExporter archives the releases of the repositories listed by a github input
+func GetGithubReleasesExporter(githubUrl string, githubToken string, httpClient *http.Client) (service.RepositoryExporter, error) {
+	client, err := getGithubClient(githubUrl, githubToken, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return &githubReleasesExporter{client: client}, nil
+}
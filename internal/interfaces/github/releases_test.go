@@ -0,0 +1,83 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+)
+
+func Test_export_releases(t *testing.T) {
+	assetDownloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/releases", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id": 1, "tag_name": "v1.0.0", "name": "v1.0.0", "body": "Description of the release", "assets": [{"id": 10, "name": "firmware.bin", "size": 13}]}, {"id": 2, "name": "Next", "draft": true}, {"id": 3, "name": "Later", "draft": true}]`)
+	})
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/releases/assets/10", func(w http.ResponseWriter, r *http.Request) {
+		assetDownloads += 1
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			t.Errorf("unexpected accept header %v", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("some firmware"))
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	exporter, err := GetGithubReleasesExporter(testServer.URL, "some-token", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: "octocat"}, RepositoryName: entity.RepositoryName{Name: "Hello-World"}}
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export releases: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dirName, "releases", "v1.0.0", "assets", "firmware.bin"))
+	if err != nil || string(content) != "some firmware" {
+		t.Fatalf("expected the asset to be stored. got %v: %v", string(content), err)
+	}
+	var release releaseDocument
+	if found, err := export.ReadDocument(filepath.Join(dirName, "releases", "v1.0.0", "release.json"), &release); err != nil || !found {
+		t.Fatalf("expected the release to be exported: %v", err)
+	}
+	if release.Release.GetBody() != "Description of the release" || release.Assets["firmware.bin"].Size != 13 {
+		t.Fatalf("unexpected release %v", release)
+	}
+
+	// Draft releases without tag are kept apart
+	for id, name := range map[string]string{"draft-2": "Next", "draft-3": "Later"} {
+		var draft releaseDocument
+		if found, err := export.ReadDocument(filepath.Join(dirName, "releases", id, "release.json"), &draft); err != nil || !found || draft.Release.GetName() != name {
+			t.Fatalf("expected the draft release %v to be exported. got %v %v", name, draft.Release, err)
+		}
+	}
+
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export releases: %v", err)
+	}
+	if assetDownloads != 1 {
+		t.Fatalf("expected stored assets not to be downloaded again. got %v downloads", assetDownloads)
+	}
+
+	os.WriteFile(filepath.Join(dirName, "releases", "v1.0.0", "assets", "firmware.bin"), []byte("truncated"), 0644)
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export releases: %v", err)
+	}
+	if assetDownloads != 2 {
+		t.Fatalf("expected assets with an unexpected size to be downloaded again. got %v downloads", assetDownloads)
+	}
+}
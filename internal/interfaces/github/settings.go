@@ -0,0 +1,231 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+	"github.com/google/go-github/v58/github"
+	"golang.org/x/crypto/ssh"
+)
+
+const settingsFolder = "settings"
+
+type githubCollaborator struct {
+	Login       string          `json:"login"`
+	RoleName    string          `json:"roleName"`
+	Permissions map[string]bool `json:"permissions"`
+}
+
+type githubTeamPermission struct {
+	Slug       string `json:"slug"`
+	Permission string `json:"permission"`
+}
+
+type githubWebhook struct {
+	ID     int64          `json:"id"`
+	Name   string         `json:"name"`
+	Active bool           `json:"active"`
+	Events []string       `json:"events"`
+	Config map[string]any `json:"config"`
+}
+
+type githubDeployKey struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	ReadOnly    bool   `json:"readOnly"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// githubSettings only holds what is configured on the repository, so that snapshots do not change on every push
+type githubSettings struct {
+	Description         string                        `json:"description"`
+	Homepage            string                        `json:"homepage"`
+	Topics              []string                      `json:"topics"`
+	Visibility          string                        `json:"visibility"`
+	DefaultBranch       string                        `json:"defaultBranch"`
+	Archived            bool                          `json:"archived"`
+	HasIssues           bool                          `json:"hasIssues"`
+	HasProjects         bool                          `json:"hasProjects"`
+	HasWiki             bool                          `json:"hasWiki"`
+	HasDiscussions      bool                          `json:"hasDiscussions"`
+	AllowMergeCommit    bool                          `json:"allowMergeCommit"`
+	AllowSquashMerge    bool                          `json:"allowSquashMerge"`
+	AllowRebaseMerge    bool                          `json:"allowRebaseMerge"`
+	DeleteBranchOnMerge bool                          `json:"deleteBranchOnMerge"`
+	BranchProtections   map[string]*github.Protection `json:"branchProtections"`
+	Collaborators       []githubCollaborator          `json:"collaborators"`
+	Teams               []githubTeamPermission        `json:"teams"`
+	Webhooks            []githubWebhook               `json:"webhooks"`
+	DeployKeys          []githubDeployKey             `json:"deployKeys"`
+	// Unavailable lists the settings the token is not allowed to read, such as webhooks without admin access
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+func isPermissionError(err error) bool {
+	var errorResponse *github.ErrorResponse
+	return errors.As(err, &errorResponse) && (errorResponse.Response.StatusCode == http.StatusForbidden || errorResponse.Response.StatusCode == http.StatusNotFound)
+}
+
+// getDeployKeyFingerprint returns the SHA256 fingerprint of the key, as displayed by GitHub and ssh-keygen
+func getDeployKeyFingerprint(key string) string {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(publicKey)
+}
+
+// githubSettingsExporter snapshots the settings of repositories, keeping a new version in the history whenever they change
+type githubSettingsExporter struct {
+	client *github.Client
+}
+
+func (e *githubSettingsExporter) Name() string {
+	return "github-settings"
+}
+
+func (e *githubSettingsExporter) Export(ctx context.Context, repository entity.Repository, directory string) error {
+	if repository.Kind != entity.KindCode {
+		return nil
+	}
+	owner, repo := repository.OwnerName.Name, repository.RepositoryName.Name
+	githubRepository, _, err := e.client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return fmt.Errorf("could not get repository: %w", err)
+	}
+	settings := githubSettings{
+		Description:         githubRepository.GetDescription(),
+		Homepage:            githubRepository.GetHomepage(),
+		Topics:              githubRepository.Topics,
+		Visibility:          githubRepository.GetVisibility(),
+		DefaultBranch:       githubRepository.GetDefaultBranch(),
+		Archived:            githubRepository.GetArchived(),
+		HasIssues:           githubRepository.GetHasIssues(),
+		HasProjects:         githubRepository.GetHasProjects(),
+		HasWiki:             githubRepository.GetHasWiki(),
+		HasDiscussions:      githubRepository.GetHasDiscussions(),
+		AllowMergeCommit:    githubRepository.GetAllowMergeCommit(),
+		AllowSquashMerge:    githubRepository.GetAllowSquashMerge(),
+		AllowRebaseMerge:    githubRepository.GetAllowRebaseMerge(),
+		DeleteBranchOnMerge: githubRepository.GetDeleteBranchOnMerge(),
+	}
+
+	sections := []struct {
+		name   string
+		export func() error
+	}{
+		{"branchProtections", func() error { return e.exportBranchProtections(ctx, owner, repo, &settings) }},
+		{"collaborators", func() error { return e.exportCollaborators(ctx, owner, repo, &settings) }},
+		{"teams", func() error { return e.exportTeams(ctx, owner, repo, &settings) }},
+		{"webhooks", func() error { return e.exportWebhooks(ctx, owner, repo, &settings) }},
+		{"deployKeys", func() error { return e.exportDeployKeys(ctx, owner, repo, &settings) }},
+	}
+	for _, section := range sections {
+		if err := section.export(); err != nil {
+			if !isPermissionError(err) {
+				return fmt.Errorf("could not export %v: %w", section.name, err)
+			}
+			settings.Unavailable = append(settings.Unavailable, section.name)
+		}
+	}
+
+	_, err = export.WriteSnapshot(filepath.Join(directory, settingsFolder), settings)
+	return err
+}
+
+func (e *githubSettingsExporter) exportBranchProtections(ctx context.Context, owner string, repo string, settings *githubSettings) error {
+	branches, err := listAllPages(func(options github.ListOptions) ([]*github.Branch, *github.Response, error) {
+		return e.client.Repositories.ListBranches(ctx, owner, repo, &github.BranchListOptions{Protected: github.Bool(true), ListOptions: options})
+	})
+	if err != nil {
+		return err
+	}
+	settings.BranchProtections = map[string]*github.Protection{}
+	for _, branch := range branches {
+		protection, _, err := e.client.Repositories.GetBranchProtection(ctx, owner, repo, branch.GetName())
+		if err != nil {
+			return err
+		}
+		settings.BranchProtections[branch.GetName()] = protection
+	}
+	return nil
+}
+
+func (e *githubSettingsExporter) exportCollaborators(ctx context.Context, owner string, repo string, settings *githubSettings) error {
+	collaborators, err := listAllPages(func(options github.ListOptions) ([]*github.User, *github.Response, error) {
+		return e.client.Repositories.ListCollaborators(ctx, owner, repo, &github.ListCollaboratorsOptions{ListOptions: options})
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range collaborators {
+		settings.Collaborators = append(settings.Collaborators, githubCollaborator{Login: c.GetLogin(), RoleName: c.GetRoleName(), Permissions: c.Permissions})
+	}
+	sort.Slice(settings.Collaborators, func(i, j int) bool { return settings.Collaborators[i].Login < settings.Collaborators[j].Login })
+	return nil
+}
+
+func (e *githubSettingsExporter) exportTeams(ctx context.Context, owner string, repo string, settings *githubSettings) error {
+	teams, err := listAllPages(func(options github.ListOptions) ([]*github.Team, *github.Response, error) {
+		return e.client.Repositories.ListTeams(ctx, owner, repo, &options)
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range teams {
+		settings.Teams = append(settings.Teams, githubTeamPermission{Slug: t.GetSlug(), Permission: t.GetPermission()})
+	}
+	sort.Slice(settings.Teams, func(i, j int) bool { return settings.Teams[i].Slug < settings.Teams[j].Slug })
+	return nil
+}
+
+func (e *githubSettingsExporter) exportWebhooks(ctx context.Context, owner string, repo string, settings *githubSettings) error {
+	hooks, err := listAllPages(func(options github.ListOptions) ([]*github.Hook, *github.Response, error) {
+		return e.client.Repositories.ListHooks(ctx, owner, repo, &options)
+	})
+	if err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		config := map[string]any{}
+		for key, value := range h.Config {
+			// GitHub obfuscates secrets, they are not kept anyway
+			if key != "secret" {
+				config[key] = value
+			}
+		}
+		settings.Webhooks = append(settings.Webhooks, githubWebhook{ID: h.GetID(), Name: h.GetName(), Active: h.GetActive(), Events: h.Events, Config: config})
+	}
+	sort.Slice(settings.Webhooks, func(i, j int) bool { return settings.Webhooks[i].ID < settings.Webhooks[j].ID })
+	return nil
+}
+
+func (e *githubSettingsExporter) exportDeployKeys(ctx context.Context, owner string, repo string, settings *githubSettings) error {
+	keys, err := listAllPages(func(options github.ListOptions) ([]*github.Key, *github.Response, error) {
+		return e.client.Repositories.ListKeys(ctx, owner, repo, &options)
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		settings.DeployKeys = append(settings.DeployKeys, githubDeployKey{ID: k.GetID(), Title: k.GetTitle(), ReadOnly: k.GetReadOnly(), Fingerprint: getDeployKeyFingerprint(k.GetKey())})
+	}
+	sort.Slice(settings.DeployKeys, func(i, j int) bool { return settings.DeployKeys[i].ID < settings.DeployKeys[j].ID })
+	return nil
+}
+
+// GetGithubSettingsExporter snapshots the settings of the repositories listed by a github input
+func GetGithubSettingsExporter(githubUrl string, githubToken string, httpClient *http.Client) (service.RepositoryExporter, error) {
+	client, err := getGithubClient(githubUrl, githubToken, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return &githubSettingsExporter{client: client}, nil
+}
@@ -0,0 +1,96 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+)
+
+func Test_export_settings(t *testing.T) {
+	description := "My first repository"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": 1, "name": "Hello-World", "description": "%v", "default_branch": "main", "topics": ["octocat"], "visibility": "public", "has_issues": true}`, description)
+	})
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/branches", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("protected") != "true" {
+			t.Errorf("expected only protected branches to be listed")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"name": "main", "protected": true}]`)
+	})
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"required_linear_history": {"enabled": true}}`)
+	})
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/collaborators", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"login": "octocat", "role_name": "admin", "permissions": {"admin": true}}]`)
+	})
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/teams", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"slug": "maintainers", "permission": "push"}]`)
+	})
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/hooks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+	mux.HandleFunc("/api/v3/repos/octocat/Hello-World/keys", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id": 1, "title": "deploy", "read_only": true, "key": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGB8X+p4SXrnCIIEG0kQDx8SASdSpAjvF0qNDS3KrVNk"}]`)
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	exporter, err := GetGithubSettingsExporter(testServer.URL, "some-token", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: "octocat"}, RepositoryName: entity.RepositoryName{Name: "Hello-World"}}
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export settings: %v", err)
+	}
+
+	var settings githubSettings
+	if found, err := export.ReadDocument(filepath.Join(dirName, "settings", "current.json"), &settings); err != nil || !found {
+		t.Fatalf("expected the settings to be exported: %v", err)
+	}
+	if settings.Description != description || settings.DefaultBranch != "main" || !settings.HasIssues {
+		t.Fatalf("unexpected settings %v", settings)
+	}
+	if protection := settings.BranchProtections["main"]; protection == nil || !protection.GetRequireLinearHistory().Enabled {
+		t.Fatalf("expected the branch protection to be exported. got %v", settings.BranchProtections)
+	}
+	if len(settings.Collaborators) != 1 || settings.Collaborators[0].RoleName != "admin" || len(settings.Teams) != 1 {
+		t.Fatalf("unexpected access %v %v", settings.Collaborators, settings.Teams)
+	}
+	if len(settings.DeployKeys) != 1 || settings.DeployKeys[0].Fingerprint == "" {
+		t.Fatalf("expected the deploy key fingerprint to be exported. got %v", settings.DeployKeys)
+	}
+	if len(settings.Unavailable) != 1 || settings.Unavailable[0] != "webhooks" {
+		t.Fatalf("expected webhooks to be unavailable. got %v", settings.Unavailable)
+	}
+
+	description = "Renamed"
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export settings: %v", err)
+	}
+	if _, err := export.ReadDocument(filepath.Join(dirName, "settings", "current.json"), &settings); err != nil || settings.Description != description {
+		t.Fatalf("expected the new settings to be exported. got %v: %v", settings, err)
+	}
+}
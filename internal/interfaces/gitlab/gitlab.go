@@ -1,7 +1,10 @@
 package gitlab
 
 import (
+	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
@@ -9,13 +12,35 @@ import (
 	"github.com/xanzy/go-gitlab"
 )
 
+type GitlabOpts struct {
+	// Groups, by id or full path, whose projects are listed including the ones of their subgroups
+	Groups []string
+	// Wikis also lists the wiki of every project having the wiki feature enabled
+	Wikis bool
+	// HTTPClient sends the API requests. Defaults to the retrying client of go-gitlab
+	HTTPClient *http.Client
+}
+
 type gitlabVCS struct {
 	client *gitlab.Client
 	userId int
+	groups []string
+	wikis  bool
 }
 
-func (g *gitlabVCS) ListOwnedRepositories() ([]entity.Repository, error) {
-	var allRepos []entity.Repository
+// withStatistics requests the statistics of projects, which hold their size. GitLab only returns them for
+// projects the user is at least reporter of. The group projects options of the client do not support them
+func withStatistics(req *retryablehttp.Request) error {
+	query := req.URL.Query()
+	query.Set("statistics", "true")
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+type listProjectsFunc func(options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error)
+
+func listAllProjects(listProjects listProjectsFunc) ([]*gitlab.Project, error) {
+	var allProjects []*gitlab.Project
 	var nextPageUrl *string = nil
 	for {
 		nextPageOption := func(req *retryablehttp.Request) error {
@@ -28,24 +53,59 @@ func (g *gitlabVCS) ListOwnedRepositories() ([]entity.Repository, error) {
 			}
 			return nil
 		}
-		projects, resp, err := g.client.Projects.ListUserProjects(g.userId, nil, nextPageOption)
+		projects, resp, err := listProjects(nextPageOption, withStatistics)
 		if err != nil {
 			return nil, err
 		}
-		for _, r := range projects {
-			allRepos = append(allRepos, gitlabProjectToDomainRepository(r))
-		}
+		allProjects = append(allProjects, projects...)
 		if resp.NextLink == "" {
 			break
 		} else {
 			nextPageUrl = &resp.NextLink
 		}
 	}
+	return allProjects, nil
+}
+
+func (g *gitlabVCS) ListOwnedRepositories() ([]entity.Repository, error) {
+	var allRepos []entity.Repository
+	listedProjects := map[int]bool{}
+	addProjects := func(projects []*gitlab.Project) {
+		for _, p := range projects {
+			if !listedProjects[p.ID] {
+				listedProjects[p.ID] = true
+				repo := gitlabProjectToDomainRepository(p)
+				allRepos = append(allRepos, repo)
+				if g.wikis && hasWiki(p) {
+					allRepos = append(allRepos, entity.NewWikiRepository(repo))
+				}
+			}
+		}
+	}
+
+	userProjects, err := listAllProjects(func(options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
+		return g.client.Projects.ListUserProjects(g.userId, nil, options...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	addProjects(userProjects)
+
+	for _, group := range g.groups {
+		groupProjects, err := listAllProjects(func(options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
+			return g.client.Groups.ListGroupProjects(group, &gitlab.ListGroupProjectsOptions{IncludeSubGroups: gitlab.Ptr(true)}, options...)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not list projects of group %v: %w", group, err)
+		}
+		addProjects(groupProjects)
+	}
 	return allRepos, nil
 }
 
-func GetGitlabVCS(gitlabUrl string, gitlabToken string) (service.VCS, error) {
-	client, err := getGitlabClient(gitlabUrl, gitlabToken)
+// GetGitlabVCS lists the projects owned by the authenticated user as well as the projects of the given groups
+func GetGitlabVCS(gitlabUrl string, gitlabToken string, options GitlabOpts) (service.VCS, error) {
+	client, err := getGitlabClient(gitlabUrl, gitlabToken, options.HTTPClient)
 	if err != nil {
 		return nil, err
 	}
@@ -53,17 +113,57 @@ func GetGitlabVCS(gitlabUrl string, gitlabToken string) (service.VCS, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &gitlabVCS{client: client, userId: user.ID}, nil
+	return &gitlabVCS{client: client, userId: user.ID, groups: options.Groups, wikis: options.Wikis}, nil
+}
+
+// getGitlabClient disables the retries of go-gitlab when given an http client, which is expected to retry on its own
+func getGitlabClient(gitlabUrl string, gitlabToken string, httpClient *http.Client) (*gitlab.Client, error) {
+	if httpClient == nil {
+		return gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabUrl))
+	}
+	return gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabUrl), gitlab.WithHTTPClient(httpClient), gitlab.WithoutRetries())
 }
 
-func getGitlabClient(gitlabUrl string, gitlabToken string) (*gitlab.Client, error) {
-	return gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabUrl))
+// getNamespacePath returns the full path of the namespace of the project (user or group/subgroup).
+// Group projects do not have an owner, so the namespace is used instead
+func getNamespacePath(project *gitlab.Project) string {
+	if project.Namespace != nil && project.Namespace.FullPath != "" {
+		return project.Namespace.FullPath
+	}
+	return strings.TrimSuffix(project.PathWithNamespace, "/"+project.Path)
+}
+
+// getTopics falls back to tag_list, which older instances return instead of topics
+func getTopics(project *gitlab.Project) []string {
+	if len(project.Topics) > 0 {
+		return project.Topics
+	}
+	return project.TagList
+}
+
+// hasWiki relies on wiki_access_level, wiki_enabled being deprecated and only kept for older instances
+func hasWiki(project *gitlab.Project) bool {
+	if project.WikiAccessLevel != "" {
+		return project.WikiAccessLevel != gitlab.DisabledAccessControl
+	}
+	return project.WikiEnabled
 }
 
 func gitlabProjectToDomainRepository(project *gitlab.Project) entity.Repository {
-	return entity.Repository{
-		OwnerName:      entity.OwnerName{Name: project.Owner.Username},
+	repository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: getNamespacePath(project)},
 		RepositoryName: entity.RepositoryName{Name: project.Path},
-		Remote:         entity.Remote{Name: "origin", HttpUrl: project.HTTPURLToRepo},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: project.HTTPURLToRepo, SshUrl: project.SSHURLToRepo},
+		Fork:           project.ForkedFromProject != nil,
+		Archived:       project.Archived,
+		Visibility:     entity.Visibility(project.Visibility),
+		Topics:         getTopics(project),
+	}
+	if project.LastActivityAt != nil {
+		repository.LastActivityAt = *project.LastActivityAt
+	}
+	if project.Statistics != nil {
+		repository.SizeKB = project.Statistics.RepositorySize / 1024
 	}
+	return repository
 }
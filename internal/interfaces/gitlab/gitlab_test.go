@@ -0,0 +1,130 @@
+package gitlab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+const userProjects string = `
+[
+  {
+    "id": 1,
+    "path": "some-project",
+    "path_with_namespace": "someone/some-project",
+    "http_url_to_repo": "https://gitlab.example.com/someone/some-project.git",
+    "owner": {"id": 1, "username": "someone"},
+    "namespace": {"id": 1, "path": "someone", "kind": "user", "full_path": "someone"}
+  }
+]
+`
+
+const groupProjects string = `
+[
+  {
+    "id": 2,
+    "path": "group-project",
+    "path_with_namespace": "some-group/some-subgroup/group-project",
+    "http_url_to_repo": "https://gitlab.example.com/some-group/some-subgroup/group-project.git",
+    "wiki_access_level": "enabled",
+    "last_activity_at": "2024-03-01T10:00:00.000Z",
+    "visibility": "internal",
+    "archived": true,
+    "topics": ["firmware"],
+    "forked_from_project": {"id": 4},
+    "statistics": {"repository_size": 2097152},
+    "namespace": {"id": 3, "path": "some-subgroup", "kind": "group", "full_path": "some-group/some-subgroup"}
+  },
+  {
+    "id": 1,
+    "path": "some-project",
+    "path_with_namespace": "someone/some-project",
+    "http_url_to_repo": "https://gitlab.example.com/someone/some-project.git",
+    "owner": {"id": 1, "username": "someone"},
+    "namespace": {"id": 1, "path": "someone", "kind": "user", "full_path": "someone"}
+  }
+]
+`
+
+func Test_list_owned_repositories_with_groups(t *testing.T) {
+	var groupProjectsQuery string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "username": "someone"}`))
+	})
+	mux.HandleFunc("/api/v4/users/1/projects", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(userProjects))
+	})
+	mux.HandleFunc("/api/v4/groups/some-group/projects", func(w http.ResponseWriter, r *http.Request) {
+		groupProjectsQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(groupProjects))
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	gitlab, err := GetGitlabVCS(testServer.URL, "some-token", GitlabOpts{Groups: []string{"some-group"}})
+	if err != nil {
+		t.Fatalf("could not create gitlab client: %v", err)
+	}
+
+	repos, err := gitlab.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if groupProjectsQuery != "include_subgroups=true&statistics=true" {
+		t.Fatalf("group projects must include subgroups. got query %v", groupProjectsQuery)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("projects listed twice must be deduplicated. expected 2 repos, got %v", len(repos))
+	}
+	if repos[1].GetFullName() != "some-group/some-subgroup/group-project" {
+		t.Fatalf("group projects must keep their namespace path. got %v", repos[1].GetFullName())
+	}
+	if !repos[1].LastActivityAt.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected last activity to be reported. got %v", repos[1].LastActivityAt)
+	}
+	if !repos[1].Fork || !repos[1].Archived || repos[1].Visibility != entity.VisibilityInternal || repos[1].SizeKB != 2048 || len(repos[1].Topics) != 1 {
+		t.Fatalf("expected the attributes of the project to be reported. got %v", repos[1])
+	}
+	if repos[0].Fork || repos[0].Archived || repos[0].SizeKB != 0 {
+		t.Fatalf("unexpected attributes %v", repos[0])
+	}
+}
+
+func Test_list_owned_repositories_with_wikis(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "username": "someone"}`))
+	})
+	mux.HandleFunc("/api/v4/users/1/projects", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(groupProjects))
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	gitlab, err := GetGitlabVCS(testServer.URL, "some-token", GitlabOpts{Wikis: true})
+	if err != nil {
+		t.Fatalf("could not create gitlab client: %v", err)
+	}
+
+	repos, err := gitlab.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if len(repos) != 3 {
+		t.Fatalf("expected only the project with an enabled wiki to have its wiki listed. got %v", repos)
+	}
+	if repos[1].GetFullName() != "some-group/some-subgroup/group-project.wiki" || repos[1].Remote.HttpUrl != "https://gitlab.example.com/some-group/some-subgroup/group-project.wiki.git" {
+		t.Fatalf("unexpected wiki %v", repos[1])
+	}
+}
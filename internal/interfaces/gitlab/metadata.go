@@ -0,0 +1,167 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+	"github.com/xanzy/go-gitlab"
+)
+
+const metadataFolder = "metadata"
+
+const metadataPageSize = 100
+
+type issueDocument struct {
+	Issue *gitlab.Issue  `json:"issue"`
+	Notes []*gitlab.Note `json:"notes"`
+}
+
+type mergeRequestDocument struct {
+	MergeRequest *gitlab.MergeRequest `json:"mergeRequest"`
+	Notes        []*gitlab.Note       `json:"notes"`
+}
+
+type snippetDocument struct {
+	Snippet *gitlab.Snippet `json:"snippet"`
+	Content string          `json:"content"`
+}
+
+// listAllPages calls list until the last page is reached
+func listAllPages[T any](list func(options gitlab.ListOptions) ([]T, *gitlab.Response, error)) ([]T, error) {
+	var all []T
+	options := gitlab.ListOptions{PerPage: metadataPageSize}
+	for {
+		items, resp, err := list(options)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+// gitlabMetadataExporter exports the issues and merge requests with their notes, labels, milestones and snippets of projects.
+// Issues and merge requests are only fetched again once updated, which includes new notes
+type gitlabMetadataExporter struct {
+	client *gitlab.Client
+}
+
+func (e *gitlabMetadataExporter) Name() string {
+	return "gitlab-metadata"
+}
+
+func (e *gitlabMetadataExporter) Export(ctx context.Context, repository entity.Repository, directory string) error {
+	if repository.Kind != entity.KindCode {
+		return nil
+	}
+	project := repository.GetFullName()
+	withContext := gitlab.WithContext(ctx)
+	metadataDirectory := filepath.Join(directory, metadataFolder)
+	statePath := filepath.Join(metadataDirectory, "state.json")
+	state, err := export.ReadState(statePath)
+	if err != nil {
+		return err
+	}
+	var updatedAfter *time.Time
+	if !state.Since.IsZero() {
+		updatedAfter = &state.Since
+	}
+	startedAt := time.Now()
+
+	labels, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.Label, *gitlab.Response, error) {
+		return e.client.Labels.ListLabels(project, &gitlab.ListLabelsOptions{ListOptions: options}, withContext)
+	})
+	if err != nil {
+		return fmt.Errorf("could not list labels: %w", err)
+	}
+	if err := export.WriteDocument(filepath.Join(metadataDirectory, "labels.json"), labels); err != nil {
+		return err
+	}
+
+	milestones, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.Milestone, *gitlab.Response, error) {
+		return e.client.Milestones.ListMilestones(project, &gitlab.ListMilestonesOptions{ListOptions: options}, withContext)
+	})
+	if err != nil {
+		return fmt.Errorf("could not list milestones: %w", err)
+	}
+	if err := export.WriteDocument(filepath.Join(metadataDirectory, "milestones.json"), milestones); err != nil {
+		return err
+	}
+
+	issues, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.Issue, *gitlab.Response, error) {
+		return e.client.Issues.ListProjectIssues(project, &gitlab.ListProjectIssuesOptions{ListOptions: options, UpdatedAfter: updatedAfter}, withContext)
+	})
+	if err != nil {
+		return fmt.Errorf("could not list issues: %w", err)
+	}
+	for _, issue := range issues {
+		notes, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.Note, *gitlab.Response, error) {
+			return e.client.Notes.ListIssueNotes(project, issue.IID, &gitlab.ListIssueNotesOptions{ListOptions: options}, withContext)
+		})
+		if err != nil {
+			return fmt.Errorf("could not list notes of issue %v: %w", issue.IID, err)
+		}
+		if err := export.WriteDocument(filepath.Join(metadataDirectory, "issues", strconv.Itoa(issue.IID)+".json"), issueDocument{Issue: issue, Notes: notes}); err != nil {
+			return err
+		}
+	}
+
+	mergeRequests, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.MergeRequest, *gitlab.Response, error) {
+		return e.client.MergeRequests.ListProjectMergeRequests(project, &gitlab.ListProjectMergeRequestsOptions{ListOptions: options, UpdatedAfter: updatedAfter}, withContext)
+	})
+	if err != nil {
+		return fmt.Errorf("could not list merge requests: %w", err)
+	}
+	for _, mergeRequest := range mergeRequests {
+		notes, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.Note, *gitlab.Response, error) {
+			return e.client.Notes.ListMergeRequestNotes(project, mergeRequest.IID, &gitlab.ListMergeRequestNotesOptions{ListOptions: options}, withContext)
+		})
+		if err != nil {
+			return fmt.Errorf("could not list notes of merge request %v: %w", mergeRequest.IID, err)
+		}
+		if err := export.WriteDocument(filepath.Join(metadataDirectory, "merge_requests", strconv.Itoa(mergeRequest.IID)+".json"), mergeRequestDocument{MergeRequest: mergeRequest, Notes: notes}); err != nil {
+			return err
+		}
+	}
+
+	// Snippets can not be filtered by update time. They are usually few, so they are all exported again
+	snippets, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.Snippet, *gitlab.Response, error) {
+		snippetOptions := gitlab.ListProjectSnippetsOptions(options)
+		return e.client.ProjectSnippets.ListSnippets(project, &snippetOptions, withContext)
+	})
+	if err != nil {
+		return fmt.Errorf("could not list snippets: %w", err)
+	}
+	for _, snippet := range snippets {
+		content, _, err := e.client.ProjectSnippets.SnippetContent(project, snippet.ID, withContext)
+		if err != nil {
+			return fmt.Errorf("could not get content of snippet %v: %w", snippet.ID, err)
+		}
+		if err := export.WriteDocument(filepath.Join(metadataDirectory, "snippets", strconv.Itoa(snippet.ID)+".json"), snippetDocument{Snippet: snippet, Content: string(content)}); err != nil {
+			return err
+		}
+	}
+
+	// Issues and merge requests updated during the export are fetched again next time
+	return export.WriteState(statePath, export.State{Since: startedAt})
+}
+
+// GetGitlabMetadataExporter exports the issues, merge requests and snippets of the projects listed by a gitlab input
+func GetGitlabMetadataExporter(gitlabUrl string, gitlabToken string, httpClient *http.Client) (service.RepositoryExporter, error) {
+	client, err := getGitlabClient(gitlabUrl, gitlabToken, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return &gitlabMetadataExporter{client: client}, nil
+}
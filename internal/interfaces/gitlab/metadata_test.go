@@ -0,0 +1,85 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+)
+
+func Test_export_metadata(t *testing.T) {
+	var updatedAfterQueries []string
+	responses := map[string]string{
+		"/api/v4/projects/some-group/some-project/labels":                 `[{"id": 1, "name": "bug"}]`,
+		"/api/v4/projects/some-group/some-project/milestones":             `[{"id": 1, "iid": 1, "title": "v1.0"}]`,
+		"/api/v4/projects/some-group/some-project/issues":                 `[{"id": 10, "iid": 1, "title": "some issue"}]`,
+		"/api/v4/projects/some-group/some-project/issues/1/notes":         `[{"id": 100, "body": "some note"}]`,
+		"/api/v4/projects/some-group/some-project/merge_requests":         `[{"id": 20, "iid": 2, "title": "some merge request"}]`,
+		"/api/v4/projects/some-group/some-project/merge_requests/2/notes": `[{"id": 200, "body": "some review"}, {"id": 201, "body": "some reply"}]`,
+		"/api/v4/projects/some-group/some-project/snippets":               `[{"id": 30, "title": "some snippet", "file_name": "script.sh"}]`,
+		"/api/v4/projects/some-group/some-project/snippets/30/raw":        `echo hello`,
+	}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/projects/some-group/some-project/issues" || r.URL.Path == "/api/v4/projects/some-group/some-project/merge_requests" {
+			updatedAfterQueries = append(updatedAfterQueries, r.URL.Query().Get("updated_after"))
+		}
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %v", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	defer testServer.Close()
+
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	exporter, err := GetGitlabMetadataExporter(testServer.URL, "some-token", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: "some-group"}, RepositoryName: entity.RepositoryName{Name: "some-project"}}
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export metadata: %v", err)
+	}
+
+	var issue issueDocument
+	if found, err := export.ReadDocument(filepath.Join(dirName, "metadata", "issues", "1.json"), &issue); err != nil || !found {
+		t.Fatalf("expected issue 1 to be exported: %v", err)
+	}
+	if issue.Issue.Title != "some issue" || len(issue.Notes) != 1 {
+		t.Fatalf("unexpected issue %v", issue)
+	}
+	var mergeRequest mergeRequestDocument
+	if found, err := export.ReadDocument(filepath.Join(dirName, "metadata", "merge_requests", "2.json"), &mergeRequest); err != nil || !found {
+		t.Fatalf("expected merge request 2 to be exported: %v", err)
+	}
+	if len(mergeRequest.Notes) != 2 {
+		t.Fatalf("unexpected merge request %v", mergeRequest)
+	}
+	var snippet snippetDocument
+	if found, err := export.ReadDocument(filepath.Join(dirName, "metadata", "snippets", "30.json"), &snippet); err != nil || !found {
+		t.Fatalf("expected snippet 30 to be exported: %v", err)
+	}
+	if snippet.Content != "echo hello" {
+		t.Fatalf("unexpected snippet content %v", snippet.Content)
+	}
+
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export metadata: %v", err)
+	}
+	if len(updatedAfterQueries) != 4 || updatedAfterQueries[0] != "" || updatedAfterQueries[2] == "" || updatedAfterQueries[3] == "" {
+		t.Fatalf("expected the second export to only list what was updated since the first one. got updated_after %v", updatedAfterQueries)
+	}
+}
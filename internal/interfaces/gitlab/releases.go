@@ -0,0 +1,112 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+	"github.com/xanzy/go-gitlab"
+)
+
+const releasesFolder = "releases"
+
+type releaseDocument struct {
+	Release *gitlab.Release `json:"release"`
+	// Assets are the downloaded asset links by name
+	Assets map[string]export.StoredFile `json:"assets"`
+}
+
+// gitlabReleasesExporter downloads the releases of projects with their notes and asset links.
+// The source archives generated by GitLab are not downloaded, as they can be rebuilt from the mirror.
+// GitLab does not report the size of assets, so assets already stored with their recorded size are not downloaded again
+type gitlabReleasesExporter struct {
+	client     *gitlab.Client
+	httpClient *http.Client
+	token      string
+}
+
+func (e *gitlabReleasesExporter) Name() string {
+	return "gitlab-releases"
+}
+
+func (e *gitlabReleasesExporter) Export(ctx context.Context, repository entity.Repository, directory string) error {
+	if repository.Kind != entity.KindCode {
+		return nil
+	}
+	project := repository.GetFullName()
+	releases, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.Release, *gitlab.Response, error) {
+		return e.client.Releases.ListReleases(project, &gitlab.ListReleasesOptions{ListOptions: options}, gitlab.WithContext(ctx))
+	})
+	if err != nil {
+		return fmt.Errorf("could not list releases: %w", err)
+	}
+	for _, release := range releases {
+		if err := e.exportRelease(ctx, filepath.Join(directory, releasesFolder, export.SafeFileName(release.TagName)), release); err != nil {
+			return fmt.Errorf("could not export release %v: %w", release.TagName, err)
+		}
+	}
+	return nil
+}
+
+func (e *gitlabReleasesExporter) exportRelease(ctx context.Context, releaseDirectory string, release *gitlab.Release) error {
+	documentPath := filepath.Join(releaseDirectory, "release.json")
+	var previous releaseDocument
+	if _, err := export.ReadDocument(documentPath, &previous); err != nil {
+		return err
+	}
+	document := releaseDocument{Release: release, Assets: map[string]export.StoredFile{}}
+	for _, link := range release.Assets.Links {
+		name := export.SafeFileName(link.Name)
+		assetPath := filepath.Join(releaseDirectory, "assets", name)
+		if stored, ok := previous.Assets[name]; ok && export.IsStored(assetPath, stored.Size) {
+			document.Assets[name] = stored
+			continue
+		}
+		assetUrl := link.DirectAssetURL
+		if assetUrl == "" {
+			assetUrl = link.URL
+		}
+		stored, err := e.downloadAsset(ctx, assetUrl, assetPath)
+		if err != nil {
+			return fmt.Errorf("could not download asset %v: %w", link.Name, err)
+		}
+		document.Assets[name] = stored
+	}
+	return export.WriteDocument(documentPath, document)
+}
+
+// downloadAsset only sends the token to the GitLab instance, as asset links can point to any host
+func (e *gitlabReleasesExporter) downloadAsset(ctx context.Context, assetUrl string, path string) (export.StoredFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetUrl, nil)
+	if err != nil {
+		return export.StoredFile{}, err
+	}
+	if req.URL.Host == e.client.BaseURL().Host {
+		req.Header.Set("PRIVATE-TOKEN", e.token)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return export.StoredFile{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return export.StoredFile{}, fmt.Errorf("unexpected status code %v when downloading %v", resp.StatusCode, req.URL.Host+req.URL.Path)
+	}
+	return export.StoreFile(resp.Body, path)
+}
+
+// GetGitlabReleasesExporter archives the releases of the projects listed by a gitlab input
+func GetGitlabReleasesExporter(gitlabUrl string, gitlabToken string, httpClient *http.Client) (service.RepositoryExporter, error) {
+	client, err := getGitlabClient(gitlabUrl, gitlabToken, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &gitlabReleasesExporter{client: client, httpClient: httpClient, token: gitlabToken}, nil
+}
@@ -0,0 +1,57 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+func Test_export_releases(t *testing.T) {
+	var assetTokens []string
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/some-group/some-project/releases":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `[{"tag_name": "v1.0.0", "name": "v1.0.0", "description": "Description of the release", "assets": {"links": [{"id": 1, "name": "firmware.bin", "url": "%v/some-group/some-project/-/package_files/1/download"}]}}]`, testServer.URL)
+		case "/some-group/some-project/-/package_files/1/download":
+			assetTokens = append(assetTokens, r.Header.Get("PRIVATE-TOKEN"))
+			w.Write([]byte("some firmware"))
+		default:
+			t.Errorf("unexpected request %v", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer testServer.Close()
+
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	exporter, err := GetGitlabReleasesExporter(testServer.URL, "some-token", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: "some-group"}, RepositoryName: entity.RepositoryName{Name: "some-project"}}
+	for i := 0; i < 2; i++ {
+		if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+			t.Fatalf("could not export releases: %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(dirName, "releases", "v1.0.0", "assets", "firmware.bin"))
+	if err != nil || string(content) != "some firmware" {
+		t.Fatalf("expected the asset to be stored. got %v: %v", string(content), err)
+	}
+	if len(assetTokens) != 1 || assetTokens[0] != "some-token" {
+		t.Fatalf("expected the asset to be downloaded once with the token of the instance. got %v", assetTokens)
+	}
+}
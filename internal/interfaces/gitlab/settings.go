@@ -0,0 +1,196 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+	"github.com/xanzy/go-gitlab"
+	"golang.org/x/crypto/ssh"
+)
+
+const settingsFolder = "settings"
+
+type gitlabSharedGroup struct {
+	FullPath    string `json:"fullPath"`
+	AccessLevel int    `json:"accessLevel"`
+}
+
+type gitlabMember struct {
+	Username    string                  `json:"username"`
+	AccessLevel gitlab.AccessLevelValue `json:"accessLevel"`
+}
+
+type gitlabDeployKey struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	CanPush     bool   `json:"canPush"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// gitlabSettings only holds what is configured on the project, so that snapshots do not change on every push
+type gitlabSettings struct {
+	Description                               string                    `json:"description"`
+	Topics                                    []string                  `json:"topics"`
+	Visibility                                gitlab.VisibilityValue    `json:"visibility"`
+	DefaultBranch                             string                    `json:"defaultBranch"`
+	Archived                                  bool                      `json:"archived"`
+	IssuesAccessLevel                         gitlab.AccessControlValue `json:"issuesAccessLevel"`
+	MergeRequestsAccessLevel                  gitlab.AccessControlValue `json:"mergeRequestsAccessLevel"`
+	WikiAccessLevel                           gitlab.AccessControlValue `json:"wikiAccessLevel"`
+	MergeMethod                               gitlab.MergeMethodValue   `json:"mergeMethod"`
+	SquashOption                              gitlab.SquashOptionValue  `json:"squashOption"`
+	OnlyAllowMergeIfPipelineSucceeds          bool                      `json:"onlyAllowMergeIfPipelineSucceeds"`
+	OnlyAllowMergeIfAllDiscussionsAreResolved bool                      `json:"onlyAllowMergeIfAllDiscussionsAreResolved"`
+	RemoveSourceBranchAfterMerge              bool                      `json:"removeSourceBranchAfterMerge"`
+	SharedWithGroups                          []gitlabSharedGroup       `json:"sharedWithGroups"`
+	ProtectedBranches                         []*gitlab.ProtectedBranch `json:"protectedBranches"`
+	Members                                   []gitlabMember            `json:"members"`
+	// Webhooks are kept without their secret token, which GitLab never returns
+	Webhooks   []*gitlab.ProjectHook `json:"webhooks"`
+	DeployKeys []gitlabDeployKey     `json:"deployKeys"`
+	// Unavailable lists the settings the token is not allowed to read, such as webhooks without maintainer access
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+func isPermissionError(err error) bool {
+	var errorResponse *gitlab.ErrorResponse
+	return errors.As(err, &errorResponse) && (errorResponse.Response.StatusCode == http.StatusForbidden || errorResponse.Response.StatusCode == http.StatusNotFound)
+}
+
+// getDeployKeyFingerprint returns the SHA256 fingerprint of the key, as displayed by GitLab and ssh-keygen
+func getDeployKeyFingerprint(key string) string {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(publicKey)
+}
+
+// gitlabSettingsExporter snapshots the settings of projects, keeping a new version in the history whenever they change
+type gitlabSettingsExporter struct {
+	client *gitlab.Client
+}
+
+func (e *gitlabSettingsExporter) Name() string {
+	return "gitlab-settings"
+}
+
+func (e *gitlabSettingsExporter) Export(ctx context.Context, repository entity.Repository, directory string) error {
+	if repository.Kind != entity.KindCode {
+		return nil
+	}
+	pid := repository.GetFullName()
+	project, _, err := e.client.Projects.GetProject(pid, nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("could not get project: %w", err)
+	}
+	settings := gitlabSettings{
+		Description:                      project.Description,
+		Topics:                           project.Topics,
+		Visibility:                       project.Visibility,
+		DefaultBranch:                    project.DefaultBranch,
+		Archived:                         project.Archived,
+		IssuesAccessLevel:                project.IssuesAccessLevel,
+		MergeRequestsAccessLevel:         project.MergeRequestsAccessLevel,
+		WikiAccessLevel:                  project.WikiAccessLevel,
+		MergeMethod:                      project.MergeMethod,
+		SquashOption:                     project.SquashOption,
+		OnlyAllowMergeIfPipelineSucceeds: project.OnlyAllowMergeIfPipelineSucceeds,
+		OnlyAllowMergeIfAllDiscussionsAreResolved: project.OnlyAllowMergeIfAllDiscussionsAreResolved,
+		RemoveSourceBranchAfterMerge:              project.RemoveSourceBranchAfterMerge,
+	}
+	for _, group := range project.SharedWithGroups {
+		settings.SharedWithGroups = append(settings.SharedWithGroups, gitlabSharedGroup{FullPath: group.GroupFullPath, AccessLevel: group.GroupAccessLevel})
+	}
+
+	sections := []struct {
+		name   string
+		export func() error
+	}{
+		{"protectedBranches", func() error { return e.exportProtectedBranches(ctx, pid, &settings) }},
+		{"members", func() error { return e.exportMembers(ctx, pid, &settings) }},
+		{"webhooks", func() error { return e.exportWebhooks(ctx, pid, &settings) }},
+		{"deployKeys", func() error { return e.exportDeployKeys(ctx, pid, &settings) }},
+	}
+	for _, section := range sections {
+		if err := section.export(); err != nil {
+			if !isPermissionError(err) {
+				return fmt.Errorf("could not export %v: %w", section.name, err)
+			}
+			settings.Unavailable = append(settings.Unavailable, section.name)
+		}
+	}
+
+	_, err = export.WriteSnapshot(filepath.Join(directory, settingsFolder), settings)
+	return err
+}
+
+func (e *gitlabSettingsExporter) exportProtectedBranches(ctx context.Context, pid string, settings *gitlabSettings) error {
+	branches, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.ProtectedBranch, *gitlab.Response, error) {
+		return e.client.ProtectedBranches.ListProtectedBranches(pid, &gitlab.ListProtectedBranchesOptions{ListOptions: options}, gitlab.WithContext(ctx))
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+	settings.ProtectedBranches = branches
+	return nil
+}
+
+func (e *gitlabSettingsExporter) exportMembers(ctx context.Context, pid string, settings *gitlabSettings) error {
+	members, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.ProjectMember, *gitlab.Response, error) {
+		return e.client.ProjectMembers.ListProjectMembers(pid, &gitlab.ListProjectMembersOptions{ListOptions: options}, gitlab.WithContext(ctx))
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		settings.Members = append(settings.Members, gitlabMember{Username: m.Username, AccessLevel: m.AccessLevel})
+	}
+	sort.Slice(settings.Members, func(i, j int) bool { return settings.Members[i].Username < settings.Members[j].Username })
+	return nil
+}
+
+func (e *gitlabSettingsExporter) exportWebhooks(ctx context.Context, pid string, settings *gitlabSettings) error {
+	hooks, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.ProjectHook, *gitlab.Response, error) {
+		hookOptions := gitlab.ListProjectHooksOptions(options)
+		return e.client.Projects.ListProjectHooks(pid, &hookOptions, gitlab.WithContext(ctx))
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+	settings.Webhooks = hooks
+	return nil
+}
+
+func (e *gitlabSettingsExporter) exportDeployKeys(ctx context.Context, pid string, settings *gitlabSettings) error {
+	keys, err := listAllPages(func(options gitlab.ListOptions) ([]*gitlab.ProjectDeployKey, *gitlab.Response, error) {
+		keyOptions := gitlab.ListProjectDeployKeysOptions(options)
+		return e.client.DeployKeys.ListProjectDeployKeys(pid, &keyOptions, gitlab.WithContext(ctx))
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		settings.DeployKeys = append(settings.DeployKeys, gitlabDeployKey{ID: k.ID, Title: k.Title, CanPush: k.CanPush, Fingerprint: getDeployKeyFingerprint(k.Key)})
+	}
+	sort.Slice(settings.DeployKeys, func(i, j int) bool { return settings.DeployKeys[i].ID < settings.DeployKeys[j].ID })
+	return nil
+}
+
+// GetGitlabSettingsExporter snapshots the settings of the projects listed by a gitlab input
+func GetGitlabSettingsExporter(gitlabUrl string, gitlabToken string, httpClient *http.Client) (service.RepositoryExporter, error) {
+	client, err := getGitlabClient(gitlabUrl, gitlabToken, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return &gitlabSettingsExporter{client: client}, nil
+}
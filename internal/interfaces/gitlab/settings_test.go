@@ -0,0 +1,77 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/interfaces/export"
+)
+
+func Test_export_settings(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v4/projects/some-group/some-project":
+			fmt.Fprint(w, `{"id": 1, "description": "Some project", "default_branch": "main", "visibility": "private", "merge_method": "ff", "shared_with_groups": [{"group_id": 2, "group_full_path": "other-group", "group_access_level": 30}]}`)
+		case "/api/v4/projects/some-group/some-project/protected_branches":
+			fmt.Fprint(w, `[{"id": 1, "name": "main", "push_access_levels": [{"access_level": 40}]}]`)
+		case "/api/v4/projects/some-group/some-project/members":
+			fmt.Fprint(w, `[{"id": 1, "username": "some-user", "access_level": 50}]`)
+		case "/api/v4/projects/some-group/some-project/hooks":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "403 Forbidden"}`)
+		case "/api/v4/projects/some-group/some-project/deploy_keys":
+			fmt.Fprint(w, `[{"id": 1, "title": "deploy", "can_push": false, "key": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGB8X+p4SXrnCIIEG0kQDx8SASdSpAjvF0qNDS3KrVNk"}]`)
+		default:
+			t.Errorf("unexpected request %v", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer testServer.Close()
+
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	exporter, err := GetGitlabSettingsExporter(testServer.URL, "some-token", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: "some-group"}, RepositoryName: entity.RepositoryName{Name: "some-project"}}
+	if err := exporter.Export(context.Background(), repository, dirName); err != nil {
+		t.Fatalf("could not export settings: %v", err)
+	}
+
+	var settings gitlabSettings
+	if found, err := export.ReadDocument(filepath.Join(dirName, "settings", "current.json"), &settings); err != nil || !found {
+		t.Fatalf("expected the settings to be exported: %v", err)
+	}
+	if settings.DefaultBranch != "main" || settings.MergeMethod != "ff" || len(settings.SharedWithGroups) != 1 {
+		t.Fatalf("unexpected settings %v", settings)
+	}
+	if len(settings.ProtectedBranches) != 1 || len(settings.ProtectedBranches[0].PushAccessLevels) != 1 {
+		t.Fatalf("expected the protected branches to be exported. got %v", settings.ProtectedBranches)
+	}
+	if len(settings.Members) != 1 || settings.Members[0].AccessLevel != 50 {
+		t.Fatalf("expected the members to be exported. got %v", settings.Members)
+	}
+	if len(settings.DeployKeys) != 1 || settings.DeployKeys[0].Fingerprint == "" {
+		t.Fatalf("expected the deploy key fingerprint to be exported. got %v", settings.DeployKeys)
+	}
+	if len(settings.Unavailable) != 1 || settings.Unavailable[0] != "webhooks" {
+		t.Fatalf("expected webhooks to be unavailable. got %v", settings.Unavailable)
+	}
+
+	changed, err := export.WriteSnapshot(filepath.Join(dirName, "settings"), settings)
+	if err != nil || changed {
+		t.Fatalf("expected exported settings to be unchanged. got %v: %v", changed, err)
+	}
+}
@@ -0,0 +1,218 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	metricsEntity "github.com/Muscaw/GitFortress/internal/domain/metrics/entity"
+	"github.com/rs/zerolog/log"
+)
+
+type TransportOpts struct {
+	// Base sends the requests. Defaults to http.DefaultTransport with a ResponseHeaderTimeout of 1m
+	Base http.RoundTripper
+	// MaxRetries of rate limited and failed requests. Defaults to 5
+	MaxRetries int
+	// InitialBackoff is doubled after every failed attempt, up to MaxBackoff. Defaults to 1s and 1m
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxWait bounds the wait for the quota to reset. Responses are returned as is when it resets later. Defaults to 1h
+	MaxWait time.Duration
+	// Gauge publishes the remaining quota and its limit, if any
+	Gauge metricsEntity.Gauge
+	// Now and Sleep default to the system clock
+	Now   func() time.Time
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// transport waits for the quota of the forge API to reset once exhausted, and retries rate limited requests and
+// server errors with an exponential backoff. The quota is shared by the requests sent through the same transport
+type transport struct {
+	options TransportOpts
+	mutex   sync.Mutex
+	// resetAt is when the exhausted quota resets. Zero while quota remains
+	resetAt time.Time
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewTransport returns a rate limit aware transport for the forge API clients
+func NewTransport(options TransportOpts) http.RoundTripper {
+	if options.Base == nil {
+		// Bounding the wait for responses keeps a stalled forge from blocking a run forever, while the waits for the
+		// quota to reset and the download of large bodies remain unbounded
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		base.ResponseHeaderTimeout = time.Minute
+		options.Base = base
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = 5
+	}
+	if options.InitialBackoff == 0 {
+		options.InitialBackoff = time.Second
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = time.Minute
+	}
+	if options.MaxWait == 0 {
+		options.MaxWait = time.Hour
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	if options.Sleep == nil {
+		options.Sleep = sleep
+	}
+	return &transport{options: options}
+}
+
+// NewClient returns an http client sending its requests through a rate limit aware transport
+func NewClient(options TransportOpts) *http.Client {
+	return &http.Client{Transport: NewTransport(options)}
+}
+
+// getHeader reads the GitHub X-RateLimit-* headers as well as the GitLab RateLimit-* headers
+func getHeader(header http.Header, name string) (int64, bool) {
+	value := header.Get("X-RateLimit-" + name)
+	if value == "" {
+		value = header.Get("RateLimit-" + name)
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	return parsed, err == nil
+}
+
+// getRetryAfter reads the Retry-After header, given in seconds or as a date
+func (t *transport) getRetryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(t.options.Now()), true
+	}
+	return 0, false
+}
+
+// track records the quota reported by the response and returns when it resets if exhausted
+func (t *transport) track(header http.Header) time.Time {
+	remaining, hasRemaining := getHeader(header, "Remaining")
+	if !hasRemaining {
+		return time.Time{}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.options.Gauge != nil {
+		values := map[string]int{"remaining": int(remaining)}
+		if limit, found := getHeader(header, "Limit"); found {
+			values["limit"] = int(limit)
+		}
+		t.options.Gauge.SetInts(values)
+	}
+	t.resetAt = time.Time{}
+	if reset, found := getHeader(header, "Reset"); found && remaining == 0 {
+		t.resetAt = time.Unix(reset, 0)
+	}
+	return t.resetAt
+}
+
+func (t *transport) getResetAt() time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.resetAt
+}
+
+// waitForReset waits for the exhausted quota to reset. Returns false when it resets after MaxWait
+func (t *transport) waitForReset(ctx context.Context, host string, resetAt time.Time) (bool, error) {
+	wait := resetAt.Sub(t.options.Now())
+	if wait <= 0 {
+		return true, nil
+	}
+	if wait > t.options.MaxWait {
+		return false, nil
+	}
+	log.Warn().Msgf("API rate limit of %v exhausted. waiting %v for it to reset", host, wait.Round(time.Second))
+	return true, t.options.Sleep(ctx, wait)
+}
+
+func isRetryable(resp *http.Response, resetAt time.Time, hasRetryAfter bool) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		// GitHub answers 403 to exhausted quotas and secondary rate limits
+		return !resetAt.IsZero() || hasRetryAfter
+	}
+	return false
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if _, err := t.waitForReset(ctx, req.URL.Host, t.getResetAt()); err != nil {
+		return nil, err
+	}
+	backoff := t.options.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("could not replay request body: %w", err)
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		resp, err := t.options.Base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		resetAt := t.track(resp.Header)
+		retryAfter, hasRetryAfter := t.getRetryAfter(resp.Header)
+		canReplay := req.Body == nil || req.GetBody != nil
+		if !isRetryable(resp, resetAt, hasRetryAfter) || attempt >= t.options.MaxRetries || !canReplay {
+			if resp.StatusCode < 400 && !resetAt.IsZero() {
+				// Clients such as go-github refuse to send requests once the quota is exhausted. Wait for it to reset
+				// before handing back the response, so that the next request goes through
+				if _, err := t.waitForReset(ctx, req.URL.Host, resetAt); err != nil {
+					resp.Body.Close()
+					return nil, err
+				}
+			}
+			return resp, nil
+		}
+
+		wait := backoff
+		if hasRetryAfter {
+			wait = retryAfter
+		} else if now := t.options.Now(); resetAt.After(now) {
+			wait = resetAt.Sub(now)
+		}
+		if wait > t.options.MaxWait {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		log.Warn().Msgf("request to %v failed with status %v. retrying in %v", req.URL.Host, resp.StatusCode, wait.Round(time.Second))
+		if wait > 0 {
+			if err := t.options.Sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+		backoff = min(2*backoff, t.options.MaxBackoff)
+	}
+}
@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metricsEntity "github.com/Muscaw/GitFortress/internal/domain/metrics/entity"
+)
+
+type fakeRegistry struct{}
+
+func (fakeRegistry) Push(metric metricsEntity.MetricInformation, valueNames []string) {}
+
+// fakeSleeper records the waits instead of sleeping
+type fakeSleeper struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (f *fakeSleeper) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeSleeper) Sleep(ctx context.Context, d time.Duration) error {
+	f.waits = append(f.waits, d)
+	f.now = f.now.Add(d)
+	return nil
+}
+
+func get(t *testing.T, client *http.Client, url string) int {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func Test_transport(t *testing.T) {
+	startTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("retries server errors with an exponential backoff", func(t *testing.T) {
+		calls := 0
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls += 1
+			if calls <= 3 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		defer testServer.Close()
+		sleeper := &fakeSleeper{now: startTime}
+		client := NewClient(TransportOpts{Now: sleeper.Now, Sleep: sleeper.Sleep})
+
+		if status := get(t, client, testServer.URL); status != http.StatusOK {
+			t.Fatalf("expected the request to succeed once retried. got %v", status)
+		}
+		expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+		if fmt.Sprint(sleeper.waits) != fmt.Sprint(expected) {
+			t.Fatalf("expected waits %v. got %v", expected, sleeper.waits)
+		}
+	})
+
+	t.Run("gives up after the maximum number of retries", func(t *testing.T) {
+		calls := 0
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls += 1
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer testServer.Close()
+		sleeper := &fakeSleeper{now: startTime}
+		client := NewClient(TransportOpts{MaxRetries: 2, Now: sleeper.Now, Sleep: sleeper.Sleep})
+
+		if status := get(t, client, testServer.URL); status != http.StatusServiceUnavailable || calls != 3 {
+			t.Fatalf("expected the error to be returned after 3 attempts. got %v after %v attempts", status, calls)
+		}
+	})
+
+	t.Run("honors Retry-After of secondary rate limits", func(t *testing.T) {
+		calls := 0
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls += 1
+			if calls == 1 {
+				w.Header().Set("Retry-After", "30")
+				w.WriteHeader(http.StatusForbidden)
+			}
+		}))
+		defer testServer.Close()
+		sleeper := &fakeSleeper{now: startTime}
+		client := NewClient(TransportOpts{Now: sleeper.Now, Sleep: sleeper.Sleep})
+
+		if status := get(t, client, testServer.URL); status != http.StatusOK {
+			t.Fatalf("expected the request to succeed once retried. got %v", status)
+		}
+		if len(sleeper.waits) != 1 || sleeper.waits[0] != 30*time.Second {
+			t.Fatalf("expected to wait 30s. got %v", sleeper.waits)
+		}
+	})
+
+	t.Run("does not retry other client errors", func(t *testing.T) {
+		calls := 0
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls += 1
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer testServer.Close()
+		client := NewClient(TransportOpts{Sleep: func(ctx context.Context, d time.Duration) error {
+			t.Fatalf("unexpected wait of %v", d)
+			return nil
+		}})
+
+		if status := get(t, client, testServer.URL); status != http.StatusForbidden || calls != 1 {
+			t.Fatalf("expected a single attempt. got %v after %v attempts", status, calls)
+		}
+	})
+
+	t.Run("waits for the exhausted quota to reset and publishes it", func(t *testing.T) {
+		resetAt := startTime.Add(10 * time.Minute)
+		remaining := 1
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remaining -= 1
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(remaining))
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(resetAt.Unix()))
+		}))
+		defer testServer.Close()
+		sleeper := &fakeSleeper{now: startTime}
+		gauge := metricsEntity.NewGauge("api_rate_limit_some_input", fakeRegistry{})
+		client := NewClient(TransportOpts{Gauge: gauge, Now: sleeper.Now, Sleep: sleeper.Sleep})
+
+		if status := get(t, client, testServer.URL); status != http.StatusOK {
+			t.Fatalf("unexpected status %v", status)
+		}
+		if len(sleeper.waits) != 1 || sleeper.waits[0] != 10*time.Minute {
+			t.Fatalf("expected to wait for the quota to reset. got %v", sleeper.waits)
+		}
+		if gauge.Values()["remaining"] != 0 || gauge.Values()["limit"] != 5000 {
+			t.Fatalf("unexpected quota metric %v", gauge.Values())
+		}
+	})
+
+	t.Run("returns responses when the quota resets after the maximum wait", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("RateLimit-Remaining", "0")
+			w.Header().Set("RateLimit-Reset", fmt.Sprint(startTime.Add(2*time.Hour).Unix()))
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer testServer.Close()
+		sleeper := &fakeSleeper{now: startTime}
+		client := NewClient(TransportOpts{Now: sleeper.Now, Sleep: sleeper.Sleep})
+
+		if status := get(t, client, testServer.URL); status != http.StatusTooManyRequests || len(sleeper.waits) != 0 {
+			t.Fatalf("expected the rate limited response without waiting. got %v after waiting %v", status, sleeper.waits)
+		}
+	})
+
+	t.Run("stops waiting when the request is cancelled", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer testServer.Close()
+		client := NewClient(TransportOpts{InitialBackoff: time.Hour})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, testServer.URL, nil)
+
+		if _, err := client.Do(req); err == nil {
+			t.Fatal("expected an error once the request is cancelled")
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package static
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+)
+
+type Repository struct {
+	Url            string
+	Authentication *entity.Auth
+}
+
+// staticVCS serves a fixed list of repositories for git servers without any API, such as cgit or gitweb
+type staticVCS struct {
+	repositories          []entity.Repository
+	authentications       map[string]entity.Auth
+	defaultAuthentication entity.Auth
+}
+
+func (s *staticVCS) ListOwnedRepositories() ([]entity.Repository, error) {
+	return s.repositories, nil
+}
+
+// GetAuthentication returns the credentials configured for the repository url, or the default ones otherwise
+func (s *staticVCS) GetAuthentication(repository entity.Repository) entity.Auth {
+	if auth, ok := s.authentications[repository.Remote.GetUrl()]; ok {
+		return auth
+	}
+	return s.defaultAuthentication
+}
+
+// getRepositoryIdentity uses the host and the full path of the url, so that repositories with the same name on different
+// servers or under different paths of a server are distinct. https://git.example.com/cgit/some-repo.git is owned by
+// git.example.com/cgit
+func getRepositoryIdentity(remoteUrl string) (entity.OwnerName, entity.RepositoryName, error) {
+	host, err := entity.GetUrlHost(remoteUrl)
+	if err != nil {
+		return entity.OwnerName{}, entity.RepositoryName{}, err
+	}
+	remotePath, err := entity.GetUrlPath(remoteUrl)
+	if err != nil {
+		return entity.OwnerName{}, entity.RepositoryName{}, err
+	}
+	parts := strings.Split(strings.Trim(remotePath, "/"), "/")
+	repositoryName := strings.TrimSuffix(parts[len(parts)-1], ".git")
+	if host == "" || repositoryName == "" {
+		return entity.OwnerName{}, entity.RepositoryName{}, fmt.Errorf("could not find host and repository in remote url: %v", remoteUrl)
+	}
+	owner := path.Join(append([]string{host}, parts[:len(parts)-1]...)...)
+	return entity.OwnerName{Name: owner}, entity.RepositoryName{Name: repositoryName}, nil
+}
+
+// GetStaticVCS returns a VCS that also implements service.RemoteAuthenticationProvider
+func GetStaticVCS(repositories []Repository, defaultAuthentication entity.Auth) (service.VCS, error) {
+	vcs := &staticVCS{authentications: map[string]entity.Auth{}, defaultAuthentication: defaultAuthentication}
+	for _, r := range repositories {
+		remote, err := entity.NewRemote("origin", r.Url)
+		if err != nil {
+			return nil, err
+		}
+		owner, repositoryName, err := getRepositoryIdentity(r.Url)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse static repository %v: %w", r.Url, err)
+		}
+		vcs.repositories = append(vcs.repositories, entity.Repository{
+			OwnerName:      owner,
+			RepositoryName: repositoryName,
+			Remote:         remote,
+		})
+		if r.Authentication != nil {
+			vcs.authentications[r.Url] = *r.Authentication
+		}
+	}
+	return vcs, nil
+}
@@ -0,0 +1,93 @@
+package static
+
+import (
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+)
+
+func Test_list_owned_repositories(t *testing.T) {
+	static, err := GetStaticVCS([]Repository{
+		{Url: "https://git.example.com/cgit/some-repo.git"},
+		{Url: "https://mirror.example.com/vendor/other-repo", Authentication: &entity.Auth{Username: "someone", Token: "secret"}},
+		{Url: "git@git.example.com:vendor/ssh-repo.git", Authentication: &entity.Auth{SSHKey: &entity.SSHKey{PrivateKeyPath: "/some/key"}}},
+	}, entity.Auth{Token: "default-token"})
+	if err != nil {
+		t.Fatalf("could not create static vcs: %v", err)
+	}
+
+	repos, err := static.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+
+	if len(repos) != 3 {
+		t.Fatalf("expected 3 repos, got %v", len(repos))
+	}
+	if repos[0].GetFullName() != "git.example.com/cgit/some-repo" || repos[1].GetFullName() != "mirror.example.com/vendor/other-repo" {
+		t.Fatalf("unexpected repositories %v and %v", repos[0].GetFullName(), repos[1].GetFullName())
+	}
+
+	authenticationProvider, ok := static.(service.RemoteAuthenticationProvider)
+	if !ok {
+		t.Fatal("static vcs must provide repository authentications")
+	}
+
+	t.Run("repository specific authentication", func(t *testing.T) {
+		auth := authenticationProvider.GetAuthentication(repos[1])
+		if auth.Username != "someone" || auth.Token != "secret" {
+			t.Fatalf("unexpected authentication %v", auth)
+		}
+	})
+
+	t.Run("ssh repository authentication", func(t *testing.T) {
+		if repos[2].Remote.SshUrl != "git@git.example.com:vendor/ssh-repo.git" {
+			t.Fatalf("unexpected remote %v", repos[2].Remote)
+		}
+		auth := authenticationProvider.GetAuthentication(repos[2])
+		if auth.SSHKey == nil || auth.SSHKey.PrivateKeyPath != "/some/key" {
+			t.Fatalf("unexpected authentication %v", auth)
+		}
+	})
+
+	t.Run("default authentication", func(t *testing.T) {
+		auth := authenticationProvider.GetAuthentication(repos[0])
+		if auth.Token != "default-token" {
+			t.Fatalf("unexpected authentication %v", auth)
+		}
+	})
+}
+
+func Test_repositories_are_identified_by_host_and_full_path(t *testing.T) {
+	static, err := GetStaticVCS([]Repository{
+		{Url: "https://a.example/x/team/repo.git"},
+		{Url: "https://b.example/team/repo.git"},
+		{Url: "https://git.example.com/some-repo.git"},
+		{Url: "git@git.example.com:ssh-repo.git"},
+	}, entity.Auth{})
+	if err != nil {
+		t.Fatalf("could not create static vcs: %v", err)
+	}
+
+	repos, err := static.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+	expected := []string{"a.example/x/team/repo", "b.example/team/repo", "git.example.com/some-repo", "git.example.com/ssh-repo"}
+	for i, name := range expected {
+		if repos[i].GetFullName() != name {
+			t.Fatalf("expected %v. got %v", name, repos[i].GetFullName())
+		}
+	}
+	if entity.IsEqual(repos[0], repos[1]) {
+		t.Fatal("repositories with the same owner and name on different servers must be distinct")
+	}
+}
+
+func Test_invalid_repository_url(t *testing.T) {
+	_, err := GetStaticVCS([]Repository{{Url: "https://git.example.com/"}}, entity.Auth{})
+	if err == nil {
+		t.Fatal("expected an error for an url without repository")
+	}
+}
@@ -0,0 +1,108 @@
+package system_git
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// archiveFolder holds the repositories which disappeared from the remote, under <archiveFolder>/<archive time>/<layout path>.
+// Owners and groups can not start with a dot, so it never collides with a layout
+const archiveFolder = ".archive"
+
+const archiveTimestampFormat = "20060102T150405Z"
+
+const tombstoneFileName = "tombstone.json"
+
+// tombstone describes an archived repository. It is stored inside the archived repository folder
+type tombstone struct {
+	Owner              string    `json:"owner"`
+	Repository         string    `json:"repository"`
+	RemoteUrl          string    `json:"remoteUrl"`
+	OriginalPath       string    `json:"originalPath"`
+	VanishedAt         time.Time `json:"vanishedAt"`
+	LastSynchronizedAt time.Time `json:"lastSynchronizedAt"`
+}
+
+func (l localGitVCS) getArchiveDirectory() string {
+	return filepath.Join(l.cloneDirectory, archiveFolder)
+}
+
+func (l localGitVCS) ArchiveRepository(repository entity.Repository) error {
+	repositoryPath, err := l.getRepositoryPath(repository)
+	if err != nil {
+		return err
+	}
+	repo, err := git.PlainOpen(repositoryPath)
+	if err != nil {
+		return fmt.Errorf("could not open repository %v. %w", repository.GetFullName(), err)
+	}
+	lastSynchronizedAt, err := getLastSynchronizedAt(repo)
+	if err != nil {
+		return fmt.Errorf("could not read last synchronization of repository %v: %w", repository.GetFullName(), err)
+	}
+
+	vanishedAt := time.Now().UTC()
+	relativePath, err := filepath.Rel(l.cloneDirectory, repositoryPath)
+	if err != nil {
+		return err
+	}
+	archivePath := filepath.Join(l.getArchiveDirectory(), vanishedAt.Format(archiveTimestampFormat), relativePath)
+	if err := os.MkdirAll(filepath.Dir(archivePath), os.ModePerm); err != nil {
+		return fmt.Errorf("could not create archive folder for repository %v: %w", repository.GetFullName(), err)
+	}
+	if err := os.Rename(repositoryPath, archivePath); err != nil {
+		return fmt.Errorf("could not move repository %v to %v: %w", repository.GetFullName(), archivePath, err)
+	}
+	if err := moveDataDirectory(repositoryPath, archivePath); err != nil {
+		return err
+	}
+	l.removeEmptyParents(repositoryPath)
+
+	content, err := json.MarshalIndent(tombstone{
+		Owner:              repository.OwnerName.Name,
+		Repository:         repository.RepositoryName.Name,
+		RemoteUrl:          repository.Remote.GetUrl(),
+		OriginalPath:       filepath.ToSlash(relativePath),
+		VanishedAt:         vanishedAt,
+		LastSynchronizedAt: lastSynchronizedAt,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(archivePath, tombstoneFileName), content, 0644); err != nil {
+		return fmt.Errorf("could not write tombstone of repository %v: %w", repository.GetFullName(), err)
+	}
+	log.Info().Msgf("archived repository %v to %v", repository.GetFullName(), archivePath)
+	return nil
+}
+
+// PurgeArchivedRepositories removes the repositories archived before the given time and returns how many archives were removed
+func (l localGitVCS) PurgeArchivedRepositories(archivedBefore time.Time) (int, error) {
+	entries, err := os.ReadDir(l.getArchiveDirectory())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not list archived repositories: %w", err)
+	}
+	purged := 0
+	for _, entry := range entries {
+		archivedAt, err := time.Parse(archiveTimestampFormat, entry.Name())
+		if err != nil || !entry.IsDir() || !archivedAt.Before(archivedBefore) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(l.getArchiveDirectory(), entry.Name())); err != nil {
+			return purged, fmt.Errorf("could not purge archive %v: %w", entry.Name(), err)
+		}
+		log.Info().Msgf("purged repositories archived at %v", archivedAt)
+		purged += 1
+	}
+	return purged, nil
+}
@@ -0,0 +1,84 @@
+package system_git
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+func Test_ArchiveRepository(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	repository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some-group/some-subgroup"},
+		RepositoryName: entity.RepositoryName{Name: "some-project"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://gitlab.com/some-group/some-subgroup/some-project.git"},
+	}
+	createBareRepository(t, filepath.Join(dirName, "some-group", "some-subgroup", "some-project.git"), &repository, repository.Remote.HttpUrl)
+	localGit := newLocalGitVCS(LocalGitOpts{CloneDirectory: dirName})
+	dataDirectory, err := localGit.GetDataDirectory(repository)
+	if err != nil || dataDirectory != filepath.Join(dirName, "some-group", "some-subgroup", "some-project.data") {
+		t.Fatalf("unexpected data directory %v: %v", dataDirectory, err)
+	}
+	os.MkdirAll(filepath.Join(dataDirectory, "issues"), os.ModePerm)
+
+	if err := localGit.ArchiveRepository(repository); err != nil {
+		t.Fatalf("could not archive repository: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dirName, "some-group")); !os.IsNotExist(err) {
+		t.Fatal("archived repository and its empty parents must be removed from the synchronized repositories")
+	}
+	repos, err := localGit.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list repositories: %v", err)
+	}
+	if len(repos) != 0 {
+		t.Fatalf("archived repositories must not be listed. got %v", repos)
+	}
+
+	archives, err := os.ReadDir(filepath.Join(dirName, archiveFolder))
+	if err != nil || len(archives) != 1 {
+		t.Fatalf("expected one archive, got %v: %v", archives, err)
+	}
+	archivePath := filepath.Join(dirName, archiveFolder, archives[0].Name(), "some-group", "some-subgroup", "some-project.git")
+	content, err := os.ReadFile(filepath.Join(archivePath, tombstoneFileName))
+	if err != nil {
+		t.Fatalf("could not read tombstone: %v", err)
+	}
+	var archived tombstone
+	if err := json.Unmarshal(content, &archived); err != nil {
+		t.Fatalf("could not decode tombstone: %v", err)
+	}
+	if archived.RemoteUrl != repository.Remote.HttpUrl || archived.OriginalPath != "some-group/some-subgroup/some-project.git" || archived.VanishedAt.IsZero() {
+		t.Fatalf("unexpected tombstone %v", archived)
+	}
+	if _, err := os.Stat(filepath.Join(dirName, archiveFolder, archives[0].Name(), "some-group", "some-subgroup", "some-project.data", "issues")); err != nil {
+		t.Fatalf("expected the data of the repository to be archived with it: %v", err)
+	}
+
+	t.Run("recent archives are kept", func(t *testing.T) {
+		purged, err := localGit.PurgeArchivedRepositories(time.Now().Add(-time.Hour))
+		if err != nil || purged != 0 {
+			t.Fatalf("expected no archive to be purged. got %v: %v", purged, err)
+		}
+	})
+
+	t.Run("old archives are purged", func(t *testing.T) {
+		purged, err := localGit.PurgeArchivedRepositories(time.Now().Add(time.Hour))
+		if err != nil || purged != 1 {
+			t.Fatalf("expected the archive to be purged. got %v: %v", purged, err)
+		}
+		if _, err := os.Stat(archivePath); !os.IsNotExist(err) {
+			t.Fatal("purged archive still exists")
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package system_git
+
+import (
+	"fmt"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// getCloneUrl uses the SSH url of the repository when an SSH key is configured, its HTTP url otherwise
+func getCloneUrl(repository entity.Repository, authentication entity.Auth) (string, error) {
+	if authentication.SSHKey != nil {
+		if repository.Remote.SshUrl == "" {
+			return "", fmt.Errorf("an ssh key is configured but repository %v has no ssh url", repository.GetFullName())
+		}
+		return repository.Remote.SshUrl, nil
+	}
+	if repository.Remote.HttpUrl == "" {
+		return "", fmt.Errorf("repository %v only has an ssh url but no ssh key is configured", repository.GetFullName())
+	}
+	return repository.Remote.HttpUrl, nil
+}
+
+// getAuthMethod returns the authentication matching the transport of the remote url
+func getAuthMethod(remoteUrl string, authentication entity.Auth) (transport.AuthMethod, error) {
+	if entity.IsSshUrl(remoteUrl) {
+		return getSshAuthMethod(remoteUrl, authentication.SSHKey)
+	}
+	username := authentication.Username
+	if username == "" {
+		username = "git"
+	}
+	return &http.BasicAuth{Username: username, Password: authentication.Token}, nil
+}
+
+func getSshAuthMethod(remoteUrl string, sshKey *entity.SSHKey) (transport.AuthMethod, error) {
+	if sshKey == nil {
+		return nil, fmt.Errorf("an ssh key must be configured to use ssh remote %v", remoteUrl)
+	}
+	endpoint, err := transport.NewEndpoint(remoteUrl)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ssh remote %v: %w", remoteUrl, err)
+	}
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+	publicKeys, err := ssh.NewPublicKeysFromFile(user, sshKey.PrivateKeyPath, sshKey.Passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("could not load ssh key %v: %w", sshKey.PrivateKeyPath, err)
+	}
+	if sshKey.KnownHostsPath != "" {
+		hostKeyCallback, err := ssh.NewKnownHostsCallback(sshKey.KnownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not load known hosts %v: %w", sshKey.KnownHostsPath, err)
+		}
+		publicKeys.HostKeyCallback = hostKeyCallback
+	}
+	return publicKeys, nil
+}
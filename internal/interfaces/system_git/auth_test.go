@@ -0,0 +1,104 @@
+package system_git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+func writePrivateKey(t *testing.T, folder string) string {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	block, err := cryptossh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+	keyPath := filepath.Join(folder, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("could not write key: %v", err)
+	}
+	return keyPath
+}
+
+var sshRepository = entity.Repository{
+	OwnerName:      entity.OwnerName{Name: "Muscaw"},
+	RepositoryName: entity.RepositoryName{Name: "GitFortress"},
+	Remote:         entity.Remote{Name: "origin", HttpUrl: "https://github.com/Muscaw/GitFortress.git", SshUrl: "git@github.com:Muscaw/GitFortress.git"},
+}
+
+func Test_getCloneUrl(t *testing.T) {
+	t.Run("http url is used without ssh key", func(t *testing.T) {
+		cloneUrl, err := getCloneUrl(sshRepository, entity.Auth{Token: "some-token"})
+		if err != nil || cloneUrl != sshRepository.Remote.HttpUrl {
+			t.Fatalf("unexpected clone url %v: %v", cloneUrl, err)
+		}
+	})
+
+	t.Run("ssh url is used with ssh key", func(t *testing.T) {
+		cloneUrl, err := getCloneUrl(sshRepository, entity.Auth{SSHKey: &entity.SSHKey{PrivateKeyPath: "some-key"}})
+		if err != nil || cloneUrl != sshRepository.Remote.SshUrl {
+			t.Fatalf("unexpected clone url %v: %v", cloneUrl, err)
+		}
+	})
+
+	t.Run("ssh key does not fall back to http", func(t *testing.T) {
+		repository := sshRepository
+		repository.Remote.SshUrl = ""
+		if _, err := getCloneUrl(repository, entity.Auth{SSHKey: &entity.SSHKey{PrivateKeyPath: "some-key"}}); err == nil {
+			t.Fatal("expected an error when the repository has no ssh url")
+		}
+	})
+}
+
+func Test_getAuthMethod(t *testing.T) {
+	t.Run("http url uses basic auth", func(t *testing.T) {
+		auth, err := getAuthMethod(sshRepository.Remote.HttpUrl, entity.Auth{Token: "some-token"})
+		if err != nil {
+			t.Fatalf("could not get auth method: %v", err)
+		}
+		basicAuth, ok := auth.(*http.BasicAuth)
+		if !ok || basicAuth.Username != "git" || basicAuth.Password != "some-token" {
+			t.Fatalf("unexpected auth method %v", auth)
+		}
+	})
+
+	t.Run("ssh url requires an ssh key", func(t *testing.T) {
+		if _, err := getAuthMethod(sshRepository.Remote.SshUrl, entity.Auth{Token: "some-token"}); err == nil {
+			t.Fatal("expected an error when no ssh key is configured")
+		}
+	})
+
+	t.Run("ssh url uses the ssh key", func(t *testing.T) {
+		dirName, err := os.MkdirTemp("", "test")
+		if err != nil {
+			t.FailNow()
+		}
+		defer os.RemoveAll(dirName)
+		keyPath := writePrivateKey(t, dirName)
+
+		auth, err := getAuthMethod("ssh://backup@git.example.com/some-owner/some-repo.git", entity.Auth{SSHKey: &entity.SSHKey{PrivateKeyPath: keyPath}})
+		if err != nil {
+			t.Fatalf("could not get auth method: %v", err)
+		}
+		publicKeys, ok := auth.(*ssh.PublicKeys)
+		if !ok || publicKeys.User != "backup" {
+			t.Fatalf("unexpected auth method %v", auth)
+		}
+	})
+
+	t.Run("missing ssh key is an error", func(t *testing.T) {
+		if _, err := getAuthMethod(sshRepository.Remote.SshUrl, entity.Auth{SSHKey: &entity.SSHKey{PrivateKeyPath: "/non-existing-key"}}); err == nil {
+			t.Fatal("expected an error for a missing key")
+		}
+	})
+}
@@ -1,19 +1,22 @@
 package system_git
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
 func isDir(path string) (bool, error) {
@@ -24,121 +27,260 @@ func isDir(path string) (bool, error) {
 	return info.IsDir(), nil
 }
 
-func isHttpUrl(url string) bool {
-	return strings.HasPrefix(url, "http") || strings.HasPrefix(url, "https")
-}
-
-func parseRepositoryName(name string) string {
-	return strings.TrimSuffix(name, ".git")
-}
-
-func parseGithubHttpUrl(url string) (string, string, error) {
-	parts := strings.Split(url, "/")
-	ownerRepo := parts[len(parts)-2:]
-	if len(ownerRepo) != 2 {
-		return "", "", fmt.Errorf("could not parse Github HTTP url: %v", url)
-	}
-	return ownerRepo[0], parseRepositoryName(ownerRepo[1]), nil
-}
+var supportedRemoteGitProviders = []string{"github.com", "gitlab.com", "bitbucket.org"}
 
-var supportedRemoteGitProviders = []string{"github.com", "gitlab.com"}
-
-func isRemoteGitProviderSupported(remote entity.Remote) bool {
-	for _, v := range supportedRemoteGitProviders {
-		if strings.Contains(remote.HttpUrl, v) {
+func isRemoteGitProviderSupported(remote entity.Remote, additionalRemoteHosts []string) bool {
+	for _, v := range append(supportedRemoteGitProviders, additionalRemoteHosts...) {
+		if v != "" && strings.Contains(remote.GetUrl(), v) {
 			return true
 		}
 	}
 	return false
 }
 
-func parseOwnerRepositoryNameFromRemote(remote entity.Remote) (string, string, error) {
-	if isRemoteGitProviderSupported(remote) {
-		if isHttpUrl(remote.HttpUrl) {
-			return parseGithubHttpUrl(remote.HttpUrl)
-		} else {
-			return "", "", fmt.Errorf("SSH urls are not supported %v", remote.HttpUrl)
-		}
+func parseOwnerRepositoryNameFromRemote(remote entity.Remote, additionalRemoteHosts []string) (string, string, error) {
+	if isRemoteGitProviderSupported(remote, additionalRemoteHosts) {
+		owner, repo, err := entity.ParseRemoteUrl(remote.GetUrl())
+		return owner.Name, repo.Name, err
 	}
-	return "", "", fmt.Errorf("remote git provider unsupported %v", remote.HttpUrl)
+	return "", "", fmt.Errorf("remote git provider unsupported %v", remote.GetUrl())
 }
 
 func gitRemoteToDomainRemote(remote *git.Remote) (entity.Remote, error) {
 	cfg := remote.Config()
 	if len(cfg.URLs) != 1 {
-		return entity.Remote{
-			Name:    "",
-			HttpUrl: "",
-		}, fmt.Errorf("Remote contains too many URLs: %v", cfg.URLs)
+		return entity.Remote{}, fmt.Errorf("Remote contains too many URLs: %v", cfg.URLs)
 	}
 	return entity.NewRemote(cfg.Name, cfg.URLs[0])
 }
 
 type localGitVCS struct {
-	cloneDirectory string
-	authentication entity.Auth
+	cloneDirectory         string
+	authentication         service.RemoteAuthenticationProvider
+	remoteHosts            []string
+	layout                 string
+	preservedRefsRetention time.Duration
+	lfs                    bool
+	httpClient             *http.Client
+}
+
+type localRepository struct {
+	path       string
+	repository entity.Repository
 }
 
 func (l localGitVCS) ListOwnedRepositories() ([]entity.Repository, error) {
-	cloneFolder := os.DirFS(l.cloneDirectory)
-	possibleRepos, err := fs.ReadDir(cloneFolder, ".")
+	localRepos, err := l.listLocalRepositories()
 	if err != nil {
-		return nil, fmt.Errorf("could not list all possible repos from folder %v: %w", cloneFolder, err)
+		return nil, err
 	}
-
 	var foundRepos []entity.Repository
-	for _, folder := range possibleRepos {
-		possibleRepo := filepath.Join(l.cloneDirectory, folder.Name())
-		if validPath, err := isDir(possibleRepo); err == nil && validPath {
-			repo, err := git.PlainOpen(possibleRepo)
-			if err != nil {
-				return nil, fmt.Errorf("could not open repository %v: %w", possibleRepo, err)
-			}
-			remotes, err := repo.Remotes()
-			if err != nil {
-				return nil, fmt.Errorf("could not list all remotes for repository %v: %w", possibleRepo, err)
-			}
+	for _, localRepo := range localRepos {
+		foundRepos = append(foundRepos, localRepo.repository)
+	}
+	return foundRepos, nil
+}
 
-			var originRemote *entity.Remote = nil
-			for _, remote := range remotes {
-				domainRemote, err := gitRemoteToDomainRemote(remote)
-				if err != nil {
-					return nil, fmt.Errorf("could not convert remote to domain %v: %w", remote.String(), err)
-				}
-				if domainRemote.Name == "origin" {
-					originRemote = &domainRemote
-					break
-				}
-			}
+func (l localGitVCS) listLocalRepositories() ([]localRepository, error) {
+	cloneFolder := os.DirFS(l.cloneDirectory)
+	if _, err := fs.ReadDir(cloneFolder, "."); err != nil {
+		return nil, fmt.Errorf("could not list all possible repos from folder %v: %w", cloneFolder, err)
+	}
+	return l.findRepositories(l.cloneDirectory)
+}
 
-			if originRemote == nil {
-				return nil, fmt.Errorf("could not find 'origin' remote for %v", possibleRepo)
-			}
+// findRepositories walks down the folder until it finds repositories, as they can be nested in owner folders depending on the layout
+func (l localGitVCS) findRepositories(folder string) ([]localRepository, error) {
+	possibleRepos, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, fmt.Errorf("could not list all possible repos from folder %v: %w", folder, err)
+	}
 
-			owner, repoName, err := parseOwnerRepositoryNameFromRemote(*originRemote)
+	var foundRepos []localRepository
+	for _, entry := range possibleRepos {
+		possibleRepo := filepath.Join(folder, entry.Name())
+		if possibleRepo == l.getArchiveDirectory() {
+			continue
+		}
+		if validPath, err := isDir(possibleRepo); err != nil || !validPath {
+			continue
+		}
+		repo, err := git.PlainOpen(possibleRepo)
+		if errors.Is(err, git.ErrRepositoryNotExists) {
+			nestedRepos, err := l.findRepositories(possibleRepo)
 			if err != nil {
-				return nil, fmt.Errorf("could not parse owner and repo from remote %v: %w", originRemote.Name, err)
+				return nil, err
 			}
-			foundRepos = append(foundRepos, entity.Repository{
-				OwnerName:      entity.OwnerName{Name: owner},
-				RepositoryName: entity.RepositoryName{Name: repoName},
-				Remote:         *originRemote,
-			})
+			foundRepos = append(foundRepos, nestedRepos...)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not open repository %v: %w", possibleRepo, err)
 		}
+		repository, err := l.getLocalRepository(possibleRepo, repo)
+		if err != nil {
+			return nil, err
+		}
+		foundRepos = append(foundRepos, localRepository{path: possibleRepo, repository: repository})
 	}
 	return foundRepos, nil
 }
 
-func (l localGitVCS) CloneRepository(repository entity.Repository) error {
-	_, err := git.PlainClone(l.getRepositoryPath(repository), false, &git.CloneOptions{
-		URL:    repository.Remote.HttpUrl,
-		Auth:   l.getAuthentication(),
+func (l localGitVCS) getLocalRepository(repoPath string, repo *git.Repository) (entity.Repository, error) {
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return entity.Repository{}, fmt.Errorf("could not list all remotes for repository %v: %w", repoPath, err)
+	}
+
+	var originRemote *entity.Remote = nil
+	for _, remote := range remotes {
+		domainRemote, err := gitRemoteToDomainRemote(remote)
+		if err != nil {
+			return entity.Repository{}, fmt.Errorf("could not convert remote to domain %v: %w", remote.String(), err)
+		}
+		if domainRemote.Name == "origin" {
+			originRemote = &domainRemote
+			break
+		}
+	}
+
+	if originRemote == nil {
+		return entity.Repository{}, fmt.Errorf("could not find 'origin' remote for %v", repoPath)
+	}
+
+	owner, repoName, err := getRepositoryIdentity(repo)
+	if err != nil {
+		return entity.Repository{}, fmt.Errorf("could not read identity of repository %v: %w", repoPath, err)
+	}
+	if owner == "" || repoName == "" {
+		owner, repoName, err = parseOwnerRepositoryNameFromRemote(*originRemote, l.remoteHosts)
+		if err != nil {
+			return entity.Repository{}, fmt.Errorf("could not parse owner and repo from remote %v: %w", originRemote.Name, err)
+		}
+	}
+	return entity.Repository{
+		OwnerName:      entity.OwnerName{Name: owner},
+		RepositoryName: entity.RepositoryName{Name: repoName},
+		Remote:         *originRemote,
+	}, nil
+}
+
+const identitySection = "gitfortress"
+
+// setRepositoryIdentity records owner and repository names in the repository configuration.
+// Owners can not always be deduced from remote urls, such as nested Gitlab groups
+func setRepositoryIdentity(repo *git.Repository, repository entity.Repository) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	cfg.Raw.Section(identitySection).
+		SetOption("owner", repository.OwnerName.Name).
+		SetOption("name", repository.RepositoryName.Name)
+	return repo.Storer.SetConfig(cfg)
+}
+
+func getRepositoryIdentity(repo *git.Repository) (string, string, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", "", err
+	}
+	section := cfg.Raw.Section(identitySection)
+	return section.Option("owner"), section.Option("name"), nil
+}
+
+const lastSynchronizedAtOption = "lastSynchronizedAt"
+
+// setLastSynchronizedAt records the start of a successful synchronization, so that pushes happening during it are not missed
+func setLastSynchronizedAt(repo *git.Repository, synchronizedAt time.Time) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	cfg.Raw.Section(identitySection).SetOption(lastSynchronizedAtOption, synchronizedAt.UTC().Format(time.RFC3339))
+	return repo.Storer.SetConfig(cfg)
+}
+
+func getLastSynchronizedAt(repo *git.Repository) (time.Time, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return time.Time{}, err
+	}
+	value := cfg.Raw.Section(identitySection).Option(lastSynchronizedAtOption)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (l localGitVCS) LastSynchronizedAt(repository entity.Repository) (time.Time, error) {
+	repositoryPath, err := l.getRepositoryPath(repository)
+	if err != nil {
+		return time.Time{}, err
+	}
+	repo, err := git.PlainOpen(repositoryPath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not open repository %v. %w", repository.GetFullName(), err)
+	}
+	synchronizedAt, err := getLastSynchronizedAt(repo)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not read last synchronization of repository %v: %w", repository.GetFullName(), err)
+	}
+	return synchronizedAt, nil
+}
+
+// isAccessDenied tells whether the remote rejected the credentials
+func isAccessDenied(err error) bool {
+	return errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed) || errors.Is(err, transport.ErrInvalidAuthMethod)
+}
+
+func (l localGitVCS) CloneRepository(ctx context.Context, repository entity.Repository) (entity.SynchronizationResult, error) {
+	repositoryPath, err := l.getRepositoryPath(repository)
+	if err != nil {
+		return entity.SynchronizationResult{}, err
+	}
+	startedAt := time.Now()
+	authentication := l.authentication.GetAuthentication(repository)
+	cloneUrl, err := getCloneUrl(repository, authentication)
+	if err != nil {
+		return entity.SynchronizationResult{}, err
+	}
+	auth, err := getAuthMethod(cloneUrl, authentication)
+	if err != nil {
+		return entity.SynchronizationResult{}, err
+	}
+	repo, err := git.PlainCloneContext(ctx, repositoryPath, false, &git.CloneOptions{
+		URL:    cloneUrl,
+		Auth:   auth,
 		Mirror: true,
 	})
 	if err != nil {
-		return fmt.Errorf("could not clone repository. %w", err)
+		if errors.Is(err, transport.ErrRepositoryNotFound) || errors.Is(err, transport.ErrEmptyRemoteRepository) {
+			return entity.SynchronizationResult{}, fmt.Errorf("could not clone repository. %w: %w", entity.ErrRepositoryNotFound, err)
+		}
+		if isAccessDenied(err) {
+			return entity.SynchronizationResult{}, fmt.Errorf("could not clone repository. %w: %w", entity.ErrAccessDenied, err)
+		}
+		return entity.SynchronizationResult{}, fmt.Errorf("could not clone repository. %w", err)
 	}
-	return nil
+	if err := removeGitfortressReferences(repo); err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not remove references of repository %v cloned from the remote into %v: %w", repository.GetFullName(), gitfortressReferencesPrefix, err)
+	}
+	if err := setRepositoryIdentity(repo, repository); err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not record identity of repository %v: %w", repository.GetFullName(), err)
+	}
+	references, err := getReferences(repo)
+	if err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not list references of repository %v: %w", repository.GetFullName(), err)
+	}
+	lfsSize, lfsObjectsFailed, lfsComplete := l.fetchLfsObjectsOrWarn(ctx, repo, repositoryPath, repository, cloneUrl)
+	// Repositories missing LFS objects are not marked as synchronized, so that they are not skipped as unchanged
+	if lfsComplete {
+		if err := setLastSynchronizedAt(repo, startedAt); err != nil {
+			return entity.SynchronizationResult{}, fmt.Errorf("could not record synchronization of repository %v: %w", repository.GetFullName(), err)
+		}
+	}
+	return entity.SynchronizationResult{RefsUpdated: len(references), BytesFetched: getObjectsSize(repositoryPath) + lfsSize, LfsObjectsFailed: lfsObjectsFailed}, nil
 }
 
 func contains(references []*plumbing.Reference, item *plumbing.Reference) bool {
@@ -150,25 +292,28 @@ func contains(references []*plumbing.Reference, item *plumbing.Reference) bool {
 	return false
 }
 
-func (l localGitVCS) prune(repo *git.Repository, targetRemote entity.Remote) error {
+func listRemoteReferences(ctx context.Context, repo *git.Repository, targetRemote entity.Remote, auth transport.AuthMethod) ([]*plumbing.Reference, error) {
 	remote, err := repo.Remote(targetRemote.Name)
 	if err != nil {
-		return fmt.Errorf("could not open remote %v: %w", targetRemote.Name, err)
+		return nil, fmt.Errorf("could not open remote %v: %w", targetRemote.Name, err)
 	}
-
-	remoteReferences, err := remote.List(&git.ListOptions{
-		Auth: l.getAuthentication(),
+	remoteReferences, err := remote.ListContext(ctx, &git.ListOptions{
+		Auth: auth,
 	})
 	if err != nil {
-		return fmt.Errorf("could not list remote references for %v: %w", targetRemote.Name, err)
+		return nil, fmt.Errorf("could not list remote references for %v: %w", targetRemote.Name, err)
 	}
+	return remoteReferences, nil
+}
 
+// prune removes the local references which do not exist on the remote anymore
+func (l localGitVCS) prune(repo *git.Repository, targetRemote entity.Remote, remoteReferences []*plumbing.Reference) error {
 	localReferences, err := repo.References()
 	if err != nil {
 		return fmt.Errorf("could not list local references for %v: %w", targetRemote.Name, err)
 	}
 	err = localReferences.ForEach(func(reference *plumbing.Reference) error {
-		if !contains(remoteReferences, reference) {
+		if !isGitfortressReference(reference.Name()) && !contains(remoteReferences, reference) {
 			err := repo.Storer.RemoveReference(reference.Name())
 			if err != nil {
 				return fmt.Errorf("could not delete reference %v for remote %v: %w", reference.String(), targetRemote.Name, err)
@@ -182,39 +327,121 @@ func (l localGitVCS) prune(repo *git.Repository, targetRemote entity.Remote) err
 	return nil
 }
 
-func (l localGitVCS) SynchronizeRepository(repository entity.Repository) error {
-	localRepo, err := git.PlainOpen(l.getRepositoryPath(repository))
+func (l localGitVCS) SynchronizeRepository(ctx context.Context, repository entity.Repository) (entity.SynchronizationResult, error) {
+	repositoryPath, err := l.getRepositoryPath(repository)
 	if err != nil {
-		return fmt.Errorf("could not open repository %v. %w", repository.GetFullName(), err)
+		return entity.SynchronizationResult{}, err
+	}
+	localRepo, err := git.PlainOpen(repositoryPath)
+	if err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not open repository %v. %w", repository.GetFullName(), err)
 	}
 
-	err = localRepo.Fetch(&git.FetchOptions{
-		Auth: l.getAuthentication(),
-	})
+	remote, err := localRepo.Remote(repository.Remote.Name)
+	if err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not open remote %v of repository %v: %w", repository.Remote.Name, repository.GetFullName(), err)
+	}
+	originRemote, err := gitRemoteToDomainRemote(remote)
+	if err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not read remote of repository %v: %w", repository.GetFullName(), err)
+	}
+	startedAt := time.Now()
+	// Existing clones keep the transport they were cloned with
+	auth, err := getAuthMethod(originRemote.GetUrl(), l.authentication.GetAuthentication(repository))
+	if err != nil {
+		return entity.SynchronizationResult{}, err
+	}
+
+	referencesBefore, err := getReferences(localRepo)
+	if err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not list references of repository %v: %w", repository.GetFullName(), err)
+	}
+	objectsSizeBefore := getObjectsSize(repositoryPath)
+
+	remoteReferences, err := listRemoteReferences(ctx, localRepo, originRemote, auth)
+	if err == nil {
+		err = fetchReferences(ctx, localRepo, originRemote, auth, remoteReferences)
+	}
 	if err != nil {
 		if errors.Is(err, git.NoErrAlreadyUpToDate) {
 			log.Info().Msgf("repository %v is already up to date", repository.GetFullName())
+		} else if errors.Is(err, transport.ErrRepositoryNotFound) {
+			return entity.SynchronizationResult{}, fmt.Errorf("could not fetch repository %v. %w: %w", repository.GetFullName(), entity.ErrRepositoryNotFound, err)
+		} else if isAccessDenied(err) {
+			return entity.SynchronizationResult{}, fmt.Errorf("could not fetch repository %v. %w: %w", repository.GetFullName(), entity.ErrAccessDenied, err)
 		} else {
-			return fmt.Errorf("could not fetch repository %v: %w", repository.GetFullName(), err)
+			return entity.SynchronizationResult{}, fmt.Errorf("could not fetch repository %v: %w", repository.GetFullName(), err)
 		}
 	}
 
-	err = l.prune(localRepo, repository.Remote)
+	err = l.prune(localRepo, originRemote, remoteReferences)
 	if err != nil {
-		return fmt.Errorf("could not prune repository %v: %w", repository.GetFullName(), err)
+		return entity.SynchronizationResult{}, fmt.Errorf("could not prune repository %v: %w", repository.GetFullName(), err)
 	}
 
-	return nil
+	referencesAfter, err := getReferences(localRepo)
+	if err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not list references of repository %v: %w", repository.GetFullName(), err)
+	}
+	preservedReferences, err := preserveReferences(localRepo, referencesBefore, referencesAfter, startedAt)
+	if err != nil {
+		return entity.SynchronizationResult{}, fmt.Errorf("could not preserve references of repository %v: %w", repository.GetFullName(), err)
+	}
+	if l.preservedRefsRetention > 0 {
+		if err := purgePreservedReferences(localRepo, time.Now().Add(-l.preservedRefsRetention)); err != nil {
+			return entity.SynchronizationResult{}, fmt.Errorf("could not purge preserved references of repository %v: %w", repository.GetFullName(), err)
+		}
+	}
+	lfsSize, lfsObjectsFailed, lfsComplete := l.fetchLfsObjectsOrWarn(ctx, localRepo, repositoryPath, repository, originRemote.GetUrl())
+	// Repositories missing LFS objects are not marked as synchronized, so that they are not skipped as unchanged
+	if lfsComplete {
+		if err := setLastSynchronizedAt(localRepo, startedAt); err != nil {
+			return entity.SynchronizationResult{}, fmt.Errorf("could not record synchronization of repository %v: %w", repository.GetFullName(), err)
+		}
+	}
+	return entity.SynchronizationResult{
+		RefsUpdated:      countUpdatedReferences(referencesBefore, referencesAfter),
+		BytesFetched:     max(getObjectsSize(repositoryPath)-objectsSizeBefore, 0) + lfsSize,
+		PreservedRefs:    preservedReferences,
+		LfsObjectsFailed: lfsObjectsFailed,
+	}, nil
 }
 
-func GetLocalGit(cloneDirectory string, remoteAuthentication entity.Auth) service.LocalVCS {
-	return &localGitVCS{cloneDirectory: cloneDirectory, authentication: remoteAuthentication}
+type LocalGitOpts struct {
+	CloneDirectory string
+	Authentication service.RemoteAuthenticationProvider
+	// RemoteHosts are accepted on top of github.com and gitlab.com when parsing remotes of local repositories
+	RemoteHosts []string
+	// Layout of the repositories in the clone directory. DefaultLayout is used when empty
+	Layout string
+	// PreservedRefsRetention is how long the previous tips of rewritten or deleted references are kept. They are kept forever when 0
+	PreservedRefsRetention time.Duration
+	// LFS downloads the Git LFS objects referenced by the mirrored references into the lfs/objects folder of the mirror
+	LFS bool
+	// HTTPClient sends the requests of the LFS batch API and downloads the LFS objects. Defaults to http.DefaultClient
+	HTTPClient *http.Client
 }
 
-func (l localGitVCS) getAuthentication() *http.BasicAuth {
-	return &http.BasicAuth{Username: "git", Password: l.authentication.Token}
+func newLocalGitVCS(options LocalGitOpts) *localGitVCS {
+	layout := options.Layout
+	if layout == "" {
+		layout = DefaultLayout
+	}
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &localGitVCS{
+		cloneDirectory:         filepath.Clean(options.CloneDirectory),
+		authentication:         options.Authentication,
+		remoteHosts:            options.RemoteHosts,
+		layout:                 layout,
+		preservedRefsRetention: options.PreservedRefsRetention,
+		lfs:                    options.LFS,
+		httpClient:             httpClient,
+	}
 }
 
-func (l localGitVCS) getRepositoryPath(repo entity.Repository) string {
-	return filepath.Join(l.cloneDirectory, repo.RepositoryName.Name)
+func GetLocalGit(options LocalGitOpts) service.LocalVCS {
+	return newLocalGitVCS(options)
 }
@@ -1,13 +1,18 @@
 package system_git
 
 import (
+	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5"
 )
 
 func Test_isDir_is_directory(t *testing.T) {
@@ -54,7 +59,7 @@ func Test_CloneListAndSynchronizeRepositoriesIntegration(t *testing.T) {
 	defer os.RemoveAll(dirName)
 
 	// Create some git repos
-	localGit := GetLocalGit(dirName, entity.Auth{Token: os.Getenv("GITFORTRESS_GITHUB_TOKEN")})
+	localGit := GetLocalGit(LocalGitOpts{CloneDirectory: dirName, Authentication: entity.Auth{Token: os.Getenv("GITFORTRESS_GITHUB_TOKEN")}})
 	repos, err := localGit.ListOwnedRepositories()
 	if err != nil {
 		t.Fatal("could not list owned repositories")
@@ -69,12 +74,12 @@ func Test_CloneListAndSynchronizeRepositoriesIntegration(t *testing.T) {
 		RepositoryName: entity.RepositoryName{Name: "GitFortress"},
 		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://github.com/Muscaw/Gitfortress"},
 	}
-	err = localGit.CloneRepository(gitFortressRepo)
+	_, err = localGit.CloneRepository(context.Background(), gitFortressRepo)
 	if err != nil {
 		t.Fatalf("could not clone repository: %v", err)
 	}
 
-	err = localGit.CloneRepository(
+	_, err = localGit.CloneRepository(context.Background(),
 		entity.Repository{
 			OwnerName:      entity.OwnerName{Name: "Muscaw"},
 			RepositoryName: entity.RepositoryName{Name: "gitea-github-sync"},
@@ -94,7 +99,7 @@ func Test_CloneListAndSynchronizeRepositoriesIntegration(t *testing.T) {
 		t.Fatalf("expected 2 repositories, found %v", len(repos))
 	}
 
-	localGit.SynchronizeRepository(gitFortressRepo)
+	localGit.SynchronizeRepository(context.Background(), gitFortressRepo)
 }
 
 func Test_SynchronizeRepository_local_repository_has_references_not_present_on_remote(t *testing.T) {
@@ -105,18 +110,18 @@ func Test_SynchronizeRepository_local_repository_has_references_not_present_on_r
 	defer os.RemoveAll(dirName)
 
 	// Create some git repos
-	localGit := GetLocalGit(dirName, entity.Auth{Token: os.Getenv("GITFORTRESS_GITHUB_TOKEN")})
+	localGit := GetLocalGit(LocalGitOpts{CloneDirectory: dirName, Authentication: entity.Auth{Token: os.Getenv("GITFORTRESS_GITHUB_TOKEN")}})
 	gitFortressRepo := entity.Repository{
 		OwnerName:      entity.OwnerName{Name: "Muscaw"},
 		RepositoryName: entity.RepositoryName{Name: "GitFortress"},
 		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://github.com/Muscaw/Gitfortress"},
 	}
-	err = localGit.CloneRepository(gitFortressRepo)
+	_, err = localGit.CloneRepository(context.Background(), gitFortressRepo)
 	if err != nil {
 		t.Fatalf("could not clone repository: %v", err)
 	}
 
-	repoPath := path.Join(dirName, "GitFortress")
+	repoPath := path.Join(dirName, "Muscaw", "GitFortress.git")
 	createTagCmd := exec.Command("git", "tag", "some-non-existing-tag")
 	createTagCmd.Dir = repoPath
 	if err := createTagCmd.Run(); err != nil {
@@ -133,7 +138,7 @@ func Test_SynchronizeRepository_local_repository_has_references_not_present_on_r
 		t.Fatalf("repository should contain tag 'some-non-existing-tag', got %v", string(output))
 	}
 
-	localGit.SynchronizeRepository(gitFortressRepo)
+	localGit.SynchronizeRepository(context.Background(), gitFortressRepo)
 
 	listTagCmd = exec.Command("git", "tag")
 	listTagCmd.Dir = repoPath
@@ -147,7 +152,7 @@ func Test_SynchronizeRepository_local_repository_has_references_not_present_on_r
 }
 
 func Test_ListReposInNonExistingFolder(t *testing.T) {
-	localGit := GetLocalGit("/non-existing-folder", entity.Auth{Token: "not-important"})
+	localGit := GetLocalGit(LocalGitOpts{CloneDirectory: "/non-existing-folder", Authentication: entity.Auth{Token: "not-important"}})
 	_, err := localGit.ListOwnedRepositories()
 	if err == nil {
 		t.Fatal("should return err when folder does not exist")
@@ -156,3 +161,134 @@ func Test_ListReposInNonExistingFolder(t *testing.T) {
 		t.Fatalf("error does not match expected: %v", err)
 	}
 }
+
+func Test_parseOwnerRepositoryNameFromRemote(t *testing.T) {
+	t.Run("public provider is supported", func(t *testing.T) {
+		owner, repo, err := parseOwnerRepositoryNameFromRemote(entity.Remote{Name: "origin", HttpUrl: "https://github.com/Muscaw/GitFortress.git"}, nil)
+		if err != nil {
+			t.Fatalf("could not parse remote: %v", err)
+		}
+		if owner != "Muscaw" || repo != "GitFortress" {
+			t.Fatalf("unexpected owner and repository %v/%v", owner, repo)
+		}
+	})
+
+	t.Run("self-hosted provider is unsupported by default", func(t *testing.T) {
+		_, _, err := parseOwnerRepositoryNameFromRemote(entity.Remote{Name: "origin", HttpUrl: "https://forgejo.example.com/octocat/some-repo.git"}, nil)
+		if err == nil {
+			t.Fatal("expected an error for an unknown remote host")
+		}
+	})
+
+	t.Run("self-hosted provider is supported when its host is configured", func(t *testing.T) {
+		owner, repo, err := parseOwnerRepositoryNameFromRemote(entity.Remote{Name: "origin", HttpUrl: "https://forgejo.example.com/octocat/some-repo.git"}, []string{"forgejo.example.com"})
+		if err != nil {
+			t.Fatalf("could not parse remote: %v", err)
+		}
+		if owner != "octocat" || repo != "some-repo" {
+			t.Fatalf("unexpected owner and repository %v/%v", owner, repo)
+		}
+	})
+
+	t.Run("ssh remote is supported", func(t *testing.T) {
+		owner, repo, err := parseOwnerRepositoryNameFromRemote(entity.Remote{Name: "origin", SshUrl: "git@github.com:Muscaw/GitFortress.git"}, nil)
+		if err != nil {
+			t.Fatalf("could not parse remote: %v", err)
+		}
+		if owner != "Muscaw" || repo != "GitFortress" {
+			t.Fatalf("unexpected owner and repository %v/%v", owner, repo)
+		}
+	})
+}
+
+func Test_ListOwnedRepositories_uses_recorded_identity(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	groupRepository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some-group/some-subgroup"},
+		RepositoryName: entity.RepositoryName{Name: "some-project"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://gitlab.com/some-group/some-subgroup/some-project.git"},
+	}
+	createBareRepository(t, filepath.Join(dirName, "some-group", "some-subgroup", "some-project.git"), &groupRepository, groupRepository.Remote.HttpUrl)
+
+	localGit := GetLocalGit(LocalGitOpts{CloneDirectory: dirName, Authentication: entity.Auth{}})
+	repos, err := localGit.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list owned repositories: %v", err)
+	}
+
+	if len(repos) != 1 || !entity.IsEqual(repos[0], groupRepository) {
+		t.Fatalf("expected repository %v, got %v", groupRepository.GetFullName(), repos)
+	}
+}
+
+func Test_LastSynchronizedAt(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	repository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "Muscaw"},
+		RepositoryName: entity.RepositoryName{Name: "GitFortress"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: "https://github.com/Muscaw/GitFortress.git"},
+	}
+	repoPath := path.Join(dirName, "Muscaw", "GitFortress.git")
+	createBareRepository(t, repoPath, &repository, repository.Remote.HttpUrl)
+	localGit := GetLocalGit(LocalGitOpts{CloneDirectory: dirName})
+
+	synchronizedAt, err := localGit.LastSynchronizedAt(repository)
+	if err != nil {
+		t.Fatalf("could not read last synchronization: %v", err)
+	}
+	if !synchronizedAt.IsZero() {
+		t.Fatalf("expected no synchronization to be recorded. got %v", synchronizedAt)
+	}
+
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		t.Fatalf("could not open repository: %v", err)
+	}
+	expected := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	if err := setLastSynchronizedAt(repo, expected); err != nil {
+		t.Fatalf("could not record synchronization: %v", err)
+	}
+
+	synchronizedAt, err = localGit.LastSynchronizedAt(repository)
+	if err != nil {
+		t.Fatalf("could not read last synchronization: %v", err)
+	}
+	if !synchronizedAt.Equal(expected) {
+		t.Fatalf("expected %v, got %v", expected, synchronizedAt)
+	}
+}
+
+func Test_CloneRepository_missing_repository(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	upstreamPath := filepath.Join(dirName, "upstream")
+	os.MkdirAll(upstreamPath, os.ModePerm)
+	runGit(t, upstreamPath, "init", "--bare")
+
+	localGit := GetLocalGit(LocalGitOpts{CloneDirectory: filepath.Join(dirName, "clones"), Authentication: entity.Auth{}})
+	wiki := entity.NewWikiRepository(entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "owner"},
+		RepositoryName: entity.RepositoryName{Name: "repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: upstreamPath},
+	})
+	// Wikis without any page are empty repositories
+	wiki.Remote.HttpUrl = upstreamPath
+	_, err = localGit.CloneRepository(context.Background(), wiki)
+	if !errors.Is(err, entity.ErrRepositoryNotFound) {
+		t.Fatalf("expected a not found error when cloning an empty repository. got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package system_git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultLayout stores repositories under their full owner path, keeping repositories with the same name apart
+const DefaultLayout = "{namespace-path}/{repo}.git"
+
+// expandLayout replaces the placeholders of the layout:
+//   - {owner}: first component of the owner, such as the top level group of a Gitlab project
+//   - {namespace-path}: full owner path, such as group/subgroup or organization/project
+//   - {repo}: name of the repository
+func expandLayout(layout string, repository entity.Repository) string {
+	owner, _, _ := strings.Cut(repository.OwnerName.Name, "/")
+	return strings.NewReplacer(
+		"{owner}", owner,
+		"{namespace-path}", repository.OwnerName.Name,
+		"{repo}", repository.RepositoryName.Name,
+	).Replace(layout)
+}
+
+func (l localGitVCS) getRepositoryPath(repo entity.Repository) (string, error) {
+	repositoryPath := filepath.Join(l.cloneDirectory, filepath.FromSlash(expandLayout(l.layout, repo)))
+	relativePath, err := filepath.Rel(l.cloneDirectory, repositoryPath)
+	if err != nil || relativePath == "." || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("repository %v resolves to %v which is outside of the clone directory %v", repo.GetFullName(), repositoryPath, l.cloneDirectory)
+	}
+	return repositoryPath, nil
+}
+
+// dataDirectorySuffix replaces the .git suffix of a repository path to get the directory holding the data exported from the forge,
+// such as <repo>.data next to <repo>.git
+const dataDirectorySuffix = ".data"
+
+func getDataDirectoryPath(repositoryPath string) string {
+	return strings.TrimSuffix(repositoryPath, ".git") + dataDirectorySuffix
+}
+
+func (l localGitVCS) GetDataDirectory(repository entity.Repository) (string, error) {
+	repositoryPath, err := l.getRepositoryPath(repository)
+	if err != nil {
+		return "", err
+	}
+	return getDataDirectoryPath(repositoryPath), nil
+}
+
+// moveDataDirectory moves the data directory of a repository along with the repository, if it has any
+func moveDataDirectory(repositoryPath string, targetRepositoryPath string) error {
+	dataPath := getDataDirectoryPath(repositoryPath)
+	if _, err := os.Stat(dataPath); os.IsNotExist(err) {
+		return nil
+	}
+	targetDataPath := getDataDirectoryPath(targetRepositoryPath)
+	if err := os.Rename(dataPath, targetDataPath); err != nil {
+		return fmt.Errorf("could not move data of repository %v to %v: %w", repositoryPath, targetDataPath, err)
+	}
+	return nil
+}
+
+// removeEmptyParents removes the folders left empty between the path and the clone directory
+func (l localGitVCS) removeEmptyParents(path string) {
+	for parent := filepath.Dir(path); parent != l.cloneDirectory && strings.HasPrefix(parent, l.cloneDirectory); parent = filepath.Dir(parent) {
+		if err := os.Remove(parent); err != nil {
+			// Folder is not empty or can not be removed
+			return
+		}
+	}
+}
+
+// MigrateToLayout moves every local repository which is not stored where the layout expects it,
+// such as the flat backups made before layouts existed. Repositories are never overwritten
+func MigrateToLayout(options LocalGitOpts) error {
+	l := newLocalGitVCS(options)
+	localRepos, err := l.listLocalRepositories()
+	if err != nil {
+		return err
+	}
+	for _, localRepo := range localRepos {
+		targetPath, err := l.getRepositoryPath(localRepo.repository)
+		if err != nil {
+			return err
+		}
+		if targetPath == localRepo.path {
+			continue
+		}
+		if _, err := os.Stat(targetPath); err == nil {
+			log.Warn().Msgf("could not move repository %v to %v. target already exists", localRepo.path, targetPath)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(targetPath), os.ModePerm); err != nil {
+			return fmt.Errorf("could not create folder for repository %v: %w", targetPath, err)
+		}
+		if err := os.Rename(localRepo.path, targetPath); err != nil {
+			return fmt.Errorf("could not move repository %v to %v: %w", localRepo.path, targetPath, err)
+		}
+		if err := moveDataDirectory(localRepo.path, targetPath); err != nil {
+			return err
+		}
+		l.removeEmptyParents(localRepo.path)
+		log.Info().Msgf("moved repository %v to %v", localRepo.path, targetPath)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package system_git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+func createBareRepository(t *testing.T, repoPath string, repository *entity.Repository, remoteUrl string) {
+	repo, err := git.PlainInit(repoPath, true)
+	if err != nil {
+		t.Fatalf("could not create test repository: %v", err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remoteUrl}}); err != nil {
+		t.Fatalf("could not create remote: %v", err)
+	}
+	if repository != nil {
+		if err := setRepositoryIdentity(repo, *repository); err != nil {
+			t.Fatalf("could not set repository identity: %v", err)
+		}
+	}
+}
+
+func Test_getRepositoryPath(t *testing.T) {
+	repository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some-group/some-subgroup"},
+		RepositoryName: entity.RepositoryName{Name: "some-project"},
+	}
+	testCases := []struct {
+		layout       string
+		expectedPath string
+	}{
+		{layout: "", expectedPath: "/backup/some-group/some-subgroup/some-project.git"},
+		{layout: "{owner}/{repo}.git", expectedPath: "/backup/some-group/some-project.git"},
+		{layout: "{repo}", expectedPath: "/backup/some-project"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.layout, func(t *testing.T) {
+			l := newLocalGitVCS(LocalGitOpts{CloneDirectory: "/backup", Layout: testCase.layout})
+			repositoryPath, err := l.getRepositoryPath(repository)
+			if err != nil {
+				t.Fatalf("could not get repository path: %v", err)
+			}
+			if repositoryPath != testCase.expectedPath {
+				t.Fatalf("expected %v, got %v", testCase.expectedPath, repositoryPath)
+			}
+		})
+	}
+
+	t.Run("path escaping the clone directory", func(t *testing.T) {
+		l := newLocalGitVCS(LocalGitOpts{CloneDirectory: "/backup"})
+		_, err := l.getRepositoryPath(entity.Repository{OwnerName: entity.OwnerName{Name: "../.."}, RepositoryName: entity.RepositoryName{Name: "etc"}})
+		if err == nil {
+			t.Fatal("expected an error for a path outside of the clone directory")
+		}
+	})
+}
+
+func Test_MigrateToLayout(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	// Flat backups made before layouts. utils only has its remote url to identify it
+	createBareRepository(t, filepath.Join(dirName, "utils"), nil, "https://github.com/alice/utils.git")
+	createBareRepository(t, filepath.Join(dirName, "some-project"), &entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "some-group/some-subgroup"},
+		RepositoryName: entity.RepositoryName{Name: "some-project"},
+	}, "https://gitlab.com/some-group/some-subgroup/some-project.git")
+	// Already at the expected location
+	createBareRepository(t, filepath.Join(dirName, "bob", "utils.git"), nil, "https://github.com/bob/utils.git")
+
+	options := LocalGitOpts{CloneDirectory: dirName, Authentication: entity.Auth{}}
+	if err := MigrateToLayout(options); err != nil {
+		t.Fatalf("could not migrate repositories: %v", err)
+	}
+
+	for _, expectedPath := range []string{"alice/utils.git", "bob/utils.git", "some-group/some-subgroup/some-project.git"} {
+		if _, err := git.PlainOpen(filepath.Join(dirName, expectedPath)); err != nil {
+			t.Fatalf("expected repository at %v: %v", expectedPath, err)
+		}
+	}
+	for _, previousPath := range []string{"utils", "some-project"} {
+		if _, err := os.Stat(filepath.Join(dirName, previousPath)); !os.IsNotExist(err) {
+			t.Fatalf("repository should have been moved from %v", previousPath)
+		}
+	}
+
+	repos, err := GetLocalGit(options).ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list owned repositories: %v", err)
+	}
+	if len(repos) != 3 {
+		t.Fatalf("expected 3 repositories after migration, got %v", len(repos))
+	}
+}
+
+func Test_ListOwnedRepositories_gists(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	gist := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "octocat"},
+		RepositoryName: entity.RepositoryName{Name: "gists/aa5a315d61ae9438b18d"},
+		Kind:           entity.KindGist,
+	}
+	localGit := newLocalGitVCS(LocalGitOpts{CloneDirectory: dirName, Authentication: entity.Auth{}})
+	gistPath, err := localGit.getRepositoryPath(gist)
+	if err != nil || gistPath != filepath.Join(dirName, "octocat", "gists", "aa5a315d61ae9438b18d.git") {
+		t.Fatalf("unexpected gist path %v: %v", gistPath, err)
+	}
+	// Gist urls do not contain any owner, so gists are only found back through their recorded identity
+	createBareRepository(t, gistPath, &gist, "https://gist.github.com/aa5a315d61ae9438b18d.git")
+
+	repos, err := localGit.ListOwnedRepositories()
+	if err != nil {
+		t.Fatalf("could not list owned repositories: %v", err)
+	}
+	if len(repos) != 1 || !entity.IsEqual(repos[0], gist) {
+		t.Fatalf("expected the gist to be listed. got %v", repos)
+	}
+}
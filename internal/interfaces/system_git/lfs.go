@@ -0,0 +1,408 @@
+package system_git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rs/zerolog/log"
+)
+
+// lfsPointerMaxSize is the size above which blobs can not be LFS pointers, as done by git-lfs
+const lfsPointerMaxSize = 1024
+
+const lfsBatchSize = 100
+
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+// lfsScannedCommitsFile lists the commits whose trees were already searched for LFS pointers, keeping scans incremental
+const lfsScannedCommitsFile = "gitfortress-scanned-commits"
+
+type lfsPointer struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// parseLfsPointer reads pointer files such as:
+//
+//	version https://git-lfs.github.com/spec/v1
+//	oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+//	size 12345
+func parseLfsPointer(content []byte) (lfsPointer, bool) {
+	if !bytes.HasPrefix(content, []byte("version https://git-lfs.github.com/spec/v1\n")) {
+		return lfsPointer{}, false
+	}
+	var pointer lfsPointer
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			pointer.Oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			pointer.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if len(pointer.Oid) != 64 {
+		return lfsPointer{}, false
+	}
+	return pointer, true
+}
+
+func getLfsDirectory(repositoryPath string) string {
+	return filepath.Join(repositoryPath, "lfs")
+}
+
+// getLfsObjectPath follows the layout of git-lfs: lfs/objects/4d/7a/4d7a2146...
+func getLfsObjectPath(repositoryPath string, oid string) string {
+	return filepath.Join(getLfsDirectory(repositoryPath), "objects", oid[0:2], oid[2:4], oid)
+}
+
+func loadScannedCommits(repositoryPath string) (map[plumbing.Hash]bool, error) {
+	scannedCommits := map[plumbing.Hash]bool{}
+	file, err := os.Open(filepath.Join(getLfsDirectory(repositoryPath), lfsScannedCommitsFile))
+	if os.IsNotExist(err) {
+		return scannedCommits, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		scannedCommits[plumbing.NewHash(scanner.Text())] = true
+	}
+	return scannedCommits, scanner.Err()
+}
+
+func saveScannedCommits(repositoryPath string, scannedCommits map[plumbing.Hash]bool) error {
+	var content strings.Builder
+	for hash := range scannedCommits {
+		content.WriteString(hash.String() + "\n")
+	}
+	if err := os.MkdirAll(getLfsDirectory(repositoryPath), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(getLfsDirectory(repositoryPath), lfsScannedCommitsFile), []byte(content.String()), 0644)
+}
+
+// lfsScanner searches the trees of commits for LFS pointers. Trees and blobs are only read once per scan
+type lfsScanner struct {
+	repo      *git.Repository
+	seenTrees map[plumbing.Hash]bool
+	seenBlobs map[plumbing.Hash]bool
+	pointers  map[string]lfsPointer
+}
+
+func (s *lfsScanner) scanTree(hash plumbing.Hash) error {
+	if s.seenTrees[hash] {
+		return nil
+	}
+	s.seenTrees[hash] = true
+	tree, err := s.repo.TreeObject(hash)
+	if err != nil {
+		return err
+	}
+	for _, entry := range tree.Entries {
+		switch {
+		case entry.Mode == filemode.Dir:
+			if err := s.scanTree(entry.Hash); err != nil {
+				return err
+			}
+		case entry.Mode.IsFile() && !s.seenBlobs[entry.Hash]:
+			s.seenBlobs[entry.Hash] = true
+			if err := s.scanBlob(entry.Hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *lfsScanner) scanBlob(hash plumbing.Hash) error {
+	blob, err := s.repo.BlobObject(hash)
+	if err != nil {
+		return err
+	}
+	if blob.Size > lfsPointerMaxSize {
+		return nil
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if pointer, ok := parseLfsPointer(content); ok {
+		s.pointers[pointer.Oid] = pointer
+	}
+	return nil
+}
+
+// findLfsPointers returns the LFS pointers of every commit reachable from a reference and not scanned yet.
+// Newly scanned commits are added to scannedCommits
+func findLfsPointers(repo *git.Repository, scannedCommits map[plumbing.Hash]bool) ([]lfsPointer, error) {
+	scanner := &lfsScanner{repo: repo, seenTrees: map[plumbing.Hash]bool{}, seenBlobs: map[plumbing.Hash]bool{}, pointers: map[string]lfsPointer{}}
+	references, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		if reference.Type() != plumbing.HashReference {
+			return nil
+		}
+		commit, err := resolveCommit(repo, reference.Hash())
+		if err != nil {
+			// References to trees or blobs can not contain LFS pointers
+			return nil
+		}
+		return object.NewCommitPreorderIter(commit, scannedCommits, nil).ForEach(func(c *object.Commit) error {
+			scannedCommits[c.Hash] = true
+			return scanner.scanTree(c.TreeHash)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	var pointers []lfsPointer
+	for _, pointer := range scanner.pointers {
+		pointers = append(pointers, pointer)
+	}
+	return pointers, nil
+}
+
+func resolveCommit(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	if tag, err := repo.TagObject(hash); err == nil {
+		return tag.Commit()
+	}
+	return repo.CommitObject(hash)
+}
+
+// getLfsEndpoint follows the default git-lfs endpoint of a remote
+func getLfsEndpoint(remoteUrl string) string {
+	remoteUrl = strings.TrimSuffix(remoteUrl, "/")
+	if !strings.HasSuffix(remoteUrl, ".git") {
+		remoteUrl = remoteUrl + ".git"
+	}
+	return remoteUrl + "/info/lfs"
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+type lfsObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lfsBatchObject struct {
+	lfsPointer
+	Actions map[string]lfsAction `json:"actions"`
+	Error   *lfsObjectError      `json:"error"`
+}
+
+type lfsBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers"`
+	Objects   []lfsPointer `json:"objects"`
+}
+
+type lfsBatchResponse struct {
+	Objects []lfsBatchObject `json:"objects"`
+}
+
+// lfsClient downloads objects with the basic transfer of the LFS batch API
+type lfsClient struct {
+	client         *http.Client
+	endpoint       string
+	authentication entity.Auth
+}
+
+func (c lfsClient) batch(ctx context.Context, pointers []lfsPointer) ([]lfsBatchObject, error) {
+	body, err := json.Marshal(lfsBatchRequest{Operation: "download", Transfers: []string{"basic"}, Objects: pointers})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	username := c.authentication.Username
+	if username == "" {
+		username = "git"
+	}
+	req.SetBasicAuth(username, c.authentication.Token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %v when calling %v", resp.StatusCode, req.URL)
+	}
+	var batchResponse lfsBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batchResponse); err != nil {
+		return nil, fmt.Errorf("could not decode response from %v: %w", req.URL, err)
+	}
+	return batchResponse.Objects, nil
+}
+
+// download stores the object once its content matches its oid, so that partial downloads are never kept
+func (c lfsClient) download(ctx context.Context, action lfsAction, pointer lfsPointer, destination string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, action.Href, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range action.Header {
+		req.Header.Set(key, value)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %v when downloading object %v", resp.StatusCode, pointer.Oid)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(destination), pointer.Oid+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not download object %v: %w", pointer.Oid, err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != pointer.Oid {
+		return fmt.Errorf("downloaded object %v does not match its oid", pointer.Oid)
+	}
+	return os.Rename(file.Name(), destination)
+}
+
+// getLfsRemoteUrl returns the url the LFS objects are downloaded from. The LFS SSH transfer is not supported,
+// so repositories mirrored over SSH use the HTTP url reported by the forge, if any
+func getLfsRemoteUrl(repository entity.Repository, remoteUrl string) string {
+	if entity.IsHttpUrl(remoteUrl) {
+		return remoteUrl
+	}
+	return repository.Remote.HttpUrl
+}
+
+// fetchLfsObjects downloads the LFS objects referenced by the commits not scanned yet and returns the downloaded size
+// and the number of objects which could not be downloaded. Such failures do not stop the other downloads: the commits
+// scanned during the call are then left unmarked, so that their objects are requested again on the next call
+func (l localGitVCS) fetchLfsObjects(ctx context.Context, repo *git.Repository, repositoryPath string, repository entity.Repository, remoteUrl string) (int64, int, error) {
+	if !l.lfs {
+		return 0, 0, nil
+	}
+	lfsRemoteUrl := getLfsRemoteUrl(repository, remoteUrl)
+	if lfsRemoteUrl == "" {
+		log.Warn().Msgf("LFS objects of repository %v can not be fetched without HTTP/HTTPS url", repository.GetFullName())
+		return 0, 0, nil
+	}
+	scannedCommits, err := loadScannedCommits(repositoryPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not load scanned commits: %w", err)
+	}
+	pointers, err := findLfsPointers(repo, scannedCommits)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not search LFS pointers: %w", err)
+	}
+
+	var missingPointers []lfsPointer
+	for _, pointer := range pointers {
+		if info, err := os.Stat(getLfsObjectPath(repositoryPath, pointer.Oid)); err != nil || info.Size() != pointer.Size {
+			missingPointers = append(missingPointers, pointer)
+		}
+	}
+
+	client := lfsClient{client: l.httpClient, endpoint: getLfsEndpoint(lfsRemoteUrl), authentication: l.authentication.GetAuthentication(repository)}
+	var downloadedSize int64
+	failedObjects := 0
+	for start := 0; start < len(missingPointers); start += lfsBatchSize {
+		batch := missingPointers[start:min(start+lfsBatchSize, len(missingPointers))]
+		objects, err := client.batch(ctx, batch)
+		if err != nil {
+			log.Warn().Err(err).Msgf("could not request %v LFS objects of repository %v", len(batch), repository.GetFullName())
+			failedObjects += len(batch)
+			continue
+		}
+		requestedOids := map[string]bool{}
+		for _, pointer := range batch {
+			requestedOids[pointer.Oid] = true
+		}
+		for _, o := range objects {
+			delete(requestedOids, o.Oid)
+			if o.Error != nil {
+				log.Warn().Msgf("could not download LFS object %v of repository %v: %v", o.Oid, repository.GetFullName(), o.Error.Message)
+				failedObjects += 1
+				continue
+			}
+			action, ok := o.Actions["download"]
+			if !ok {
+				// Objects without download action are already present according to the server
+				continue
+			}
+			if err := client.download(ctx, action, o.lfsPointer, getLfsObjectPath(repositoryPath, o.Oid)); err != nil {
+				log.Warn().Err(err).Msgf("could not download LFS object %v of repository %v", o.Oid, repository.GetFullName())
+				failedObjects += 1
+				continue
+			}
+			downloadedSize += o.Size
+		}
+		for oid := range requestedOids {
+			log.Warn().Msgf("could not download LFS object %v of repository %v: missing from the batch response", oid, repository.GetFullName())
+			failedObjects += 1
+		}
+	}
+	if failedObjects > 0 {
+		return downloadedSize, failedObjects, nil
+	}
+
+	// Commits are only marked as scanned once all their objects are stored, so that failures are retried
+	if err := saveScannedCommits(repositoryPath, scannedCommits); err != nil {
+		return downloadedSize, 0, fmt.Errorf("could not save scanned commits: %w", err)
+	}
+	return downloadedSize, 0, nil
+}
+
+// fetchLfsObjectsOrWarn keeps LFS failures from failing the clone or synchronization of the git data, which is
+// complete at this point. Returns the downloaded size, the number of failed objects and whether every object is stored.
+// Failed objects are downloaded again on the next synchronization
+func (l localGitVCS) fetchLfsObjectsOrWarn(ctx context.Context, repo *git.Repository, repositoryPath string, repository entity.Repository, remoteUrl string) (int64, int, bool) {
+	downloadedSize, failedObjects, err := l.fetchLfsObjects(ctx, repo, repositoryPath, repository, remoteUrl)
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not fetch LFS objects of repository %v", repository.GetFullName())
+	}
+	return downloadedSize, failedObjects, err == nil && failedObjects == 0
+}
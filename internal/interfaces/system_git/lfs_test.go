@@ -0,0 +1,302 @@
+package system_git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5"
+)
+
+func Test_parseLfsPointer(t *testing.T) {
+	pointer, ok := parseLfsPointer([]byte("version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n"))
+	if !ok {
+		t.Fatal("expected a LFS pointer")
+	}
+	if pointer.Oid != "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393" || pointer.Size != 12345 {
+		t.Fatalf("unexpected pointer %v", pointer)
+	}
+	if _, ok := parseLfsPointer([]byte("some regular file\n")); ok {
+		t.Fatal("regular files are not LFS pointers")
+	}
+}
+
+func Test_getLfsEndpoint(t *testing.T) {
+	for remoteUrl, expected := range map[string]string{
+		"https://github.com/owner/repo.git": "https://github.com/owner/repo.git/info/lfs",
+		"https://github.com/owner/repo":     "https://github.com/owner/repo.git/info/lfs",
+	} {
+		if endpoint := getLfsEndpoint(remoteUrl); endpoint != expected {
+			t.Fatalf("expected endpoint %v for %v. got %v", expected, remoteUrl, endpoint)
+		}
+	}
+}
+
+func Test_fetchLfsObjects(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	content := []byte("some large design asset")
+	checksum := sha256.Sum256(content)
+	oid := hex.EncodeToString(checksum[:])
+
+	upstreamPath := filepath.Join(dirName, "upstream")
+	mirrorPath := filepath.Join(dirName, "mirror.git")
+	os.MkdirAll(upstreamPath, os.ModePerm)
+	runGit(t, upstreamPath, "init", "--initial-branch=main")
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%v\nsize %v\n", oid, len(content))
+	os.WriteFile(filepath.Join(upstreamPath, "asset.psd"), []byte(pointer), 0644)
+	runGit(t, upstreamPath, "add", "asset.psd")
+	runGit(t, upstreamPath, "commit", "-m", "add asset")
+
+	repo, err := git.PlainClone(mirrorPath, false, &git.CloneOptions{URL: upstreamPath, Mirror: true})
+	if err != nil {
+		t.Fatalf("could not clone upstream: %v", err)
+	}
+
+	var requests []string
+	var authorization string
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/owner/repo.git/info/lfs/objects/batch":
+			authorization = r.Header.Get("Authorization")
+			var request lfsBatchRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			if request.Operation != "download" || len(request.Objects) != 1 || request.Objects[0].Oid != oid {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", lfsMediaType)
+			fmt.Fprintf(w, `{"objects":[{"oid":"%v","size":%v,"actions":{"download":{"href":"%v/objects/%v","header":{"X-Some-Header":"value"}}}}]}`, oid, len(content), testServer.URL, oid)
+		case "/objects/" + oid:
+			if r.Header.Get("X-Some-Header") != "value" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write(content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer testServer.Close()
+
+	localGit := newLocalGitVCS(LocalGitOpts{CloneDirectory: dirName, Authentication: entity.Auth{Token: "some-token"}, LFS: true})
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: "owner"}, RepositoryName: entity.RepositoryName{Name: "repo"}}
+	size, failed, err := localGit.fetchLfsObjects(context.Background(), repo, mirrorPath, repository, testServer.URL+"/owner/repo")
+	if err != nil {
+		t.Fatalf("could not fetch LFS objects: %v", err)
+	}
+	if failed != 0 {
+		t.Fatalf("expected no failed object. got %v", failed)
+	}
+	if size != int64(len(content)) {
+		t.Fatalf("expected %v bytes to be fetched. got %v", len(content), size)
+	}
+	if authorization == "" {
+		t.Fatal("expected the batch request to be authenticated")
+	}
+	stored, err := os.ReadFile(filepath.Join(mirrorPath, "lfs", "objects", oid[0:2], oid[2:4], oid))
+	if err != nil || string(stored) != string(content) {
+		t.Fatalf("expected the LFS object to be stored. got %v %v", string(stored), err)
+	}
+
+	// Already scanned commits are not searched again
+	requests = nil
+	size, _, err = localGit.fetchLfsObjects(context.Background(), repo, mirrorPath, repository, testServer.URL+"/owner/repo")
+	if err != nil {
+		t.Fatalf("could not fetch LFS objects: %v", err)
+	}
+	if size != 0 || len(requests) != 0 {
+		t.Fatalf("expected no request on the second fetch. got %v with %v bytes", requests, size)
+	}
+}
+
+func Test_fetchLfsObjects_failed_objects_are_retried(t *testing.T) {
+	content := []byte("some large design asset")
+	checksum := sha256.Sum256(content)
+	oid := hex.EncodeToString(checksum[:])
+	missingOid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+	for name, failObject := range map[string]func(w http.ResponseWriter, r *http.Request, serverUrl string){
+		"missing object": func(w http.ResponseWriter, r *http.Request, serverUrl string) {
+			fmt.Fprintf(w, `{"objects":[{"oid":"%v","size":12,"error":{"code":404,"message":"Object does not exist"}},{"oid":"%v","size":%v,"actions":{"download":{"href":"%v/objects/%v"}}}]}`, missingOid, oid, len(content), serverUrl, oid)
+		},
+		"failed download": func(w http.ResponseWriter, r *http.Request, serverUrl string) {
+			fmt.Fprintf(w, `{"objects":[{"oid":"%v","size":12,"actions":{"download":{"href":"%v/objects/%v"}}},{"oid":"%v","size":%v,"actions":{"download":{"href":"%v/objects/%v"}}}]}`, missingOid, serverUrl, missingOid, oid, len(content), serverUrl, oid)
+		},
+		"object missing from the response": func(w http.ResponseWriter, r *http.Request, serverUrl string) {
+			fmt.Fprintf(w, `{"objects":[{"oid":"%v","size":%v,"actions":{"download":{"href":"%v/objects/%v"}}}]}`, oid, len(content), serverUrl, oid)
+		},
+		"failed batch": func(w http.ResponseWriter, r *http.Request, serverUrl string) {
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dirName, err := os.MkdirTemp("", "test")
+			if err != nil {
+				t.FailNow()
+			}
+			defer os.RemoveAll(dirName)
+
+			upstreamPath := filepath.Join(dirName, "upstream")
+			mirrorPath := filepath.Join(dirName, "mirror.git")
+			os.MkdirAll(upstreamPath, os.ModePerm)
+			runGit(t, upstreamPath, "init", "--initial-branch=main")
+			os.WriteFile(filepath.Join(upstreamPath, "asset.bin"), []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%v\nsize 12\n", missingOid)), 0644)
+			os.WriteFile(filepath.Join(upstreamPath, "asset.psd"), []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%v\nsize %v\n", oid, len(content))), 0644)
+			runGit(t, upstreamPath, "add", "asset.bin", "asset.psd")
+			runGit(t, upstreamPath, "commit", "-m", "add assets")
+
+			repo, err := git.PlainClone(mirrorPath, false, &git.CloneOptions{URL: upstreamPath, Mirror: true})
+			if err != nil {
+				t.Fatalf("could not clone upstream: %v", err)
+			}
+
+			var requestedOids []string
+			var testServer *httptest.Server
+			testServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/owner/repo.git/info/lfs/objects/batch":
+					var request lfsBatchRequest
+					json.NewDecoder(r.Body).Decode(&request)
+					for _, object := range request.Objects {
+						requestedOids = append(requestedOids, object.Oid)
+					}
+					failObject(w, r, testServer.URL)
+				case "/objects/" + oid:
+					w.Write(content)
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer testServer.Close()
+
+			localGit := newLocalGitVCS(LocalGitOpts{CloneDirectory: dirName, Authentication: entity.Auth{}, LFS: true})
+			repository := entity.Repository{OwnerName: entity.OwnerName{Name: "owner"}, RepositoryName: entity.RepositoryName{Name: "repo"}}
+			_, failed, err := localGit.fetchLfsObjects(context.Background(), repo, mirrorPath, repository, testServer.URL+"/owner/repo.git")
+			if err != nil {
+				t.Fatalf("expected failed objects not to return an error. got %v", err)
+			}
+			if name == "failed batch" {
+				if failed != 2 {
+					t.Fatalf("expected both objects to fail. got %v", failed)
+				}
+			} else {
+				if failed != 1 {
+					t.Fatalf("expected one failed object. got %v", failed)
+				}
+				if stored, err := os.ReadFile(getLfsObjectPath(mirrorPath, oid)); err != nil || string(stored) != string(content) {
+					t.Fatalf("expected the other LFS object to be stored. got %v %v", string(stored), err)
+				}
+			}
+
+			// The commit is not marked as scanned, so that the failed object is requested again
+			requestedOids = nil
+			if _, _, err := localGit.fetchLfsObjects(context.Background(), repo, mirrorPath, repository, testServer.URL+"/owner/repo.git"); err != nil {
+				t.Fatalf("expected failed objects not to return an error. got %v", err)
+			}
+			if !slices.Contains(requestedOids, missingOid) {
+				t.Fatalf("expected the failed object to be requested again. got %v", requestedOids)
+			}
+			if name != "failed batch" && slices.Contains(requestedOids, oid) {
+				t.Fatalf("expected the stored object not to be requested again. got %v", requestedOids)
+			}
+		})
+	}
+}
+
+func Test_CloneRepository_and_SynchronizeRepository_succeed_when_lfs_objects_fail(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	upstreamPath := filepath.Join(dirName, "upstream")
+	os.MkdirAll(upstreamPath, os.ModePerm)
+	runGit(t, upstreamPath, "init", "--initial-branch=main")
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12\n"
+	os.WriteFile(filepath.Join(upstreamPath, "asset.bin"), []byte(pointer), 0644)
+	runGit(t, upstreamPath, "add", "asset.bin")
+	runGit(t, upstreamPath, "commit", "-m", "add asset")
+	// The git server does not serve the LFS batch API
+	server := serveGit(t, dirName)
+	defer server.Close()
+
+	localGit := GetLocalGit(LocalGitOpts{CloneDirectory: filepath.Join(dirName, "clones"), Authentication: entity.Auth{}, LFS: true})
+	repository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "owner"},
+		RepositoryName: entity.RepositoryName{Name: "repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: server.URL + "/upstream"},
+	}
+	result, err := localGit.CloneRepository(context.Background(), repository)
+	if err != nil {
+		t.Fatalf("expected the clone to succeed. got %v", err)
+	}
+	if result.LfsObjectsFailed != 1 {
+		t.Fatalf("expected one failed LFS object. got %v", result.LfsObjectsFailed)
+	}
+
+	result, err = localGit.SynchronizeRepository(context.Background(), repository)
+	if err != nil {
+		t.Fatalf("expected the synchronization to succeed. got %v", err)
+	}
+	if result.LfsObjectsFailed != 1 {
+		t.Fatalf("expected the failed LFS object to be retried. got %v", result.LfsObjectsFailed)
+	}
+	// Repositories missing LFS objects must not be skipped as unchanged by the next synchronization
+	if synchronizedAt, err := localGit.LastSynchronizedAt(repository); err != nil || !synchronizedAt.IsZero() {
+		t.Fatalf("expected no synchronization to be recorded while LFS objects are missing. got %v %v", synchronizedAt, err)
+	}
+}
+
+func Test_fetchLfsObjects_uses_the_given_http_client(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	upstreamPath := filepath.Join(dirName, "upstream")
+	mirrorPath := filepath.Join(dirName, "mirror.git")
+	os.MkdirAll(upstreamPath, os.ModePerm)
+	runGit(t, upstreamPath, "init", "--initial-branch=main")
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12\n"
+	os.WriteFile(filepath.Join(upstreamPath, "asset.bin"), []byte(pointer), 0644)
+	runGit(t, upstreamPath, "add", "asset.bin")
+	runGit(t, upstreamPath, "commit", "-m", "add asset")
+
+	repo, err := git.PlainClone(mirrorPath, false, &git.CloneOptions{URL: upstreamPath, Mirror: true})
+	if err != nil {
+		t.Fatalf("could not clone upstream: %v", err)
+	}
+
+	stalled := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer testServer.Close()
+	defer close(stalled)
+
+	localGit := newLocalGitVCS(LocalGitOpts{CloneDirectory: dirName, Authentication: entity.Auth{}, LFS: true, HTTPClient: &http.Client{Timeout: 50 * time.Millisecond}})
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: "owner"}, RepositoryName: entity.RepositoryName{Name: "repo"}}
+	_, failed, err := localGit.fetchLfsObjects(context.Background(), repo, mirrorPath, repository, testServer.URL+"/owner/repo.git")
+	if err != nil || failed != 1 {
+		t.Fatalf("expected the stalled request to time out and its object to fail. got %v failed objects and %v", failed, err)
+	}
+}
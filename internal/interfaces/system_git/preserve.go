@@ -0,0 +1,144 @@
+package system_git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/rs/zerolog/log"
+)
+
+// gitfortressReferencesPrefix is owned by GitFortress. References published by the remote under it are never fetched,
+// and local references under it are never pruned
+const gitfortressReferencesPrefix = "refs/gitfortress/"
+
+// preservedReferencesPrefix keeps the previous tips of rewritten or deleted references under refs/gitfortress/preserved/<time>/<reference>
+const preservedReferencesPrefix = gitfortressReferencesPrefix + "preserved/"
+
+func isGitfortressReference(name plumbing.ReferenceName) bool {
+	return strings.HasPrefix(name.String(), gitfortressReferencesPrefix)
+}
+
+// getFetchRefSpecs mirrors every reference advertised by the remote but the ones under refs/gitfortress/.
+// The default +refs/*:refs/* refspec of mirrors would let the remote overwrite the preserved references
+func getFetchRefSpecs(remoteReferences []*plumbing.Reference) []config.RefSpec {
+	var refSpecs []config.RefSpec
+	for _, reference := range remoteReferences {
+		name := reference.Name()
+		if reference.Type() != plumbing.HashReference || !strings.HasPrefix(name.String(), "refs/") || isGitfortressReference(name) {
+			continue
+		}
+		refSpecs = append(refSpecs, config.RefSpec(fmt.Sprintf("+%v:%v", name, name)))
+	}
+	return refSpecs
+}
+
+// fetchReferences fetches the references advertised by the remote, leaving out refs/gitfortress/
+func fetchReferences(ctx context.Context, repo *git.Repository, targetRemote entity.Remote, auth transport.AuthMethod, remoteReferences []*plumbing.Reference) error {
+	refSpecs := getFetchRefSpecs(remoteReferences)
+	if len(refSpecs) == 0 {
+		return git.NoErrAlreadyUpToDate
+	}
+	return repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: targetRemote.Name,
+		RefSpecs:   refSpecs,
+		Auth:       auth,
+	})
+}
+
+// removeGitfortressReferences removes the references under refs/gitfortress/ cloned from the remote, which are not
+// preserved by GitFortress
+func removeGitfortressReferences(repo *git.Repository) error {
+	references, err := repo.References()
+	if err != nil {
+		return err
+	}
+	var names []plumbing.ReferenceName
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		if isGitfortressReference(reference.Name()) {
+			names = append(names, reference.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isFastForward tells whether the new tip descends from the old one, in which case no history is lost
+func isFastForward(repo *git.Repository, oldHash plumbing.Hash, newHash plumbing.Hash) bool {
+	oldCommit, err := repo.CommitObject(oldHash)
+	if err != nil {
+		return false
+	}
+	newCommit, err := repo.CommitObject(newHash)
+	if err != nil {
+		return false
+	}
+	isAncestor, err := oldCommit.IsAncestor(newCommit)
+	return err == nil && isAncestor
+}
+
+func getPreservedReferenceName(name plumbing.ReferenceName, preservedAt time.Time) plumbing.ReferenceName {
+	return plumbing.ReferenceName(preservedReferencesPrefix + preservedAt.UTC().Format(archiveTimestampFormat) + "/" + strings.TrimPrefix(name.String(), "refs/"))
+}
+
+// preserveReferences keeps the previous tip of every reference deleted or rewritten between both snapshots
+// and returns the names of the references it created
+func preserveReferences(repo *git.Repository, before map[plumbing.ReferenceName]string, after map[plumbing.ReferenceName]string, preservedAt time.Time) ([]string, error) {
+	var preserved []string
+	for name, oldTarget := range before {
+		newTarget, exists := after[name]
+		if exists && (newTarget == oldTarget || isFastForward(repo, plumbing.NewHash(oldTarget), plumbing.NewHash(newTarget))) {
+			continue
+		}
+		preservedName := getPreservedReferenceName(name, preservedAt)
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(preservedName, plumbing.NewHash(oldTarget))); err != nil {
+			return preserved, fmt.Errorf("could not preserve reference %v: %w", name, err)
+		}
+		preserved = append(preserved, preservedName.String())
+	}
+	return preserved, nil
+}
+
+// purgePreservedReferences removes the references preserved before the given time
+func purgePreservedReferences(repo *git.Repository, preservedBefore time.Time) error {
+	references, err := repo.References()
+	if err != nil {
+		return err
+	}
+	var expiredReferences []plumbing.ReferenceName
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		timestamp, _, found := strings.Cut(strings.TrimPrefix(reference.Name().String(), preservedReferencesPrefix), "/")
+		if !strings.HasPrefix(reference.Name().String(), preservedReferencesPrefix) || !found {
+			return nil
+		}
+		preservedAt, err := time.Parse(archiveTimestampFormat, timestamp)
+		if err == nil && preservedAt.Before(preservedBefore) {
+			expiredReferences = append(expiredReferences, reference.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range expiredReferences {
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return fmt.Errorf("could not remove preserved reference %v: %w", name, err)
+		}
+		log.Debug().Msgf("removed expired preserved reference %v", name)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package system_git
+
+import (
+	"context"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("could not run git %v: %v %v", args, err, string(output))
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// serveGit serves the repositories of the folder over the smart HTTP protocol
+func serveGit(t *testing.T, folder string) *httptest.Server {
+	return httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(runGit(t, folder, "--exec-path"), "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + folder, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+}
+
+func listRemoteReferencesOrFail(t *testing.T, repo *git.Repository) []*plumbing.Reference {
+	references, err := listRemoteReferences(context.Background(), repo, entity.Remote{Name: "origin"}, nil)
+	if err != nil {
+		t.Fatalf("could not list remote references: %v", err)
+	}
+	return references
+}
+
+func Test_preserveReferences(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	upstreamPath := filepath.Join(dirName, "upstream")
+	mirrorPath := filepath.Join(dirName, "mirror.git")
+	os.MkdirAll(upstreamPath, os.ModePerm)
+	runGit(t, upstreamPath, "init", "--initial-branch=main")
+	runGit(t, upstreamPath, "commit", "--allow-empty", "-m", "first")
+	runGit(t, upstreamPath, "branch", "feature")
+	runGit(t, upstreamPath, "tag", "v1")
+	firstCommit := runGit(t, upstreamPath, "rev-parse", "HEAD")
+
+	repo, err := git.PlainClone(mirrorPath, false, &git.CloneOptions{URL: upstreamPath, Mirror: true})
+	if err != nil {
+		t.Fatalf("could not clone upstream: %v", err)
+	}
+	before, err := getReferences(repo)
+	if err != nil {
+		t.Fatalf("could not list references: %v", err)
+	}
+
+	// feature is fast-forwarded, main is rewritten and v1 is deleted
+	runGit(t, upstreamPath, "checkout", "feature")
+	runGit(t, upstreamPath, "commit", "--allow-empty", "-m", "second")
+	runGit(t, upstreamPath, "checkout", "--orphan", "rewritten")
+	runGit(t, upstreamPath, "commit", "--allow-empty", "-m", "rewritten")
+	runGit(t, upstreamPath, "branch", "-M", "rewritten", "main")
+	runGit(t, upstreamPath, "tag", "-d", "v1")
+
+	if err := repo.Fetch(&git.FetchOptions{}); err != nil {
+		t.Fatalf("could not fetch upstream: %v", err)
+	}
+	localGit := newLocalGitVCS(LocalGitOpts{CloneDirectory: dirName})
+	if err := localGit.prune(repo, entity.Remote{Name: "origin"}, listRemoteReferencesOrFail(t, repo)); err != nil {
+		t.Fatalf("could not prune: %v", err)
+	}
+	after, err := getReferences(repo)
+	if err != nil {
+		t.Fatalf("could not list references: %v", err)
+	}
+
+	preservedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	preserved, err := preserveReferences(repo, before, after, preservedAt)
+	if err != nil {
+		t.Fatalf("could not preserve references: %v", err)
+	}
+	if len(preserved) != 2 {
+		t.Fatalf("expected the rewritten branch and the deleted tag to be preserved. got %v", preserved)
+	}
+	for _, name := range []string{"refs/gitfortress/preserved/20240301T100000Z/heads/main", "refs/gitfortress/preserved/20240301T100000Z/tags/v1"} {
+		reference, err := repo.Reference(plumbing.ReferenceName(name), false)
+		if err != nil {
+			t.Fatalf("expected reference %v to exist: %v", name, err)
+		}
+		if reference.Hash().String() != firstCommit {
+			t.Fatalf("expected %v to keep the previous tip %v. got %v", name, firstCommit, reference.Hash())
+		}
+	}
+
+	t.Run("preserved references are not pruned", func(t *testing.T) {
+		if err := localGit.prune(repo, entity.Remote{Name: "origin"}, listRemoteReferencesOrFail(t, repo)); err != nil {
+			t.Fatalf("could not prune: %v", err)
+		}
+		if _, err := repo.Reference("refs/gitfortress/preserved/20240301T100000Z/heads/main", false); err != nil {
+			t.Fatalf("preserved reference was pruned: %v", err)
+		}
+	})
+
+	t.Run("expired preserved references are purged", func(t *testing.T) {
+		if err := purgePreservedReferences(repo, preservedAt); err != nil {
+			t.Fatalf("could not purge: %v", err)
+		}
+		if _, err := repo.Reference("refs/gitfortress/preserved/20240301T100000Z/heads/main", false); err != nil {
+			t.Fatal("references preserved at the purge time must be kept")
+		}
+		if err := purgePreservedReferences(repo, preservedAt.Add(time.Second)); err != nil {
+			t.Fatalf("could not purge: %v", err)
+		}
+		if _, err := repo.Reference("refs/gitfortress/preserved/20240301T100000Z/heads/main", false); err == nil {
+			t.Fatal("expired preserved reference was not purged")
+		}
+	})
+}
+
+func Test_SynchronizeRepository_ignores_remote_gitfortress_references(t *testing.T) {
+	dirName, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirName)
+
+	upstreamPath := filepath.Join(dirName, "upstream")
+	os.MkdirAll(upstreamPath, os.ModePerm)
+	runGit(t, upstreamPath, "init", "--initial-branch=main")
+	runGit(t, upstreamPath, "commit", "--allow-empty", "-m", "first")
+	firstCommit := runGit(t, upstreamPath, "rev-parse", "HEAD")
+	runGit(t, upstreamPath, "update-ref", "refs/gitfortress/planted", firstCommit)
+	server := serveGit(t, dirName)
+	defer server.Close()
+
+	localGit := GetLocalGit(LocalGitOpts{CloneDirectory: filepath.Join(dirName, "clones"), Authentication: entity.Auth{}})
+	repository := entity.Repository{
+		OwnerName:      entity.OwnerName{Name: "owner"},
+		RepositoryName: entity.RepositoryName{Name: "repo"},
+		Remote:         entity.Remote{Name: "origin", HttpUrl: server.URL + "/upstream"},
+	}
+	if _, err := localGit.CloneRepository(context.Background(), repository); err != nil {
+		t.Fatalf("could not clone upstream: %v", err)
+	}
+	mirror, err := git.PlainOpen(filepath.Join(dirName, "clones", "owner", "repo.git"))
+	if err != nil {
+		t.Fatalf("could not open mirror: %v", err)
+	}
+	if _, err := mirror.Reference("refs/gitfortress/planted", false); err == nil {
+		t.Fatal("references of the remote under refs/gitfortress/ must not be cloned")
+	}
+
+	// main is rewritten, so that its previous tip is preserved
+	runGit(t, upstreamPath, "checkout", "--orphan", "rewritten")
+	runGit(t, upstreamPath, "commit", "--allow-empty", "-m", "rewritten")
+	runGit(t, upstreamPath, "branch", "-M", "rewritten", "main")
+	rewrittenCommit := runGit(t, upstreamPath, "rev-parse", "HEAD")
+	result, err := localGit.SynchronizeRepository(context.Background(), repository)
+	if err != nil {
+		t.Fatalf("could not synchronize repository: %v", err)
+	}
+	if len(result.PreservedRefs) != 1 {
+		t.Fatalf("expected the previous tip of main to be preserved. got %v", result.PreservedRefs)
+	}
+	preservedName := plumbing.ReferenceName(result.PreservedRefs[0])
+
+	// The remote publishes references overwriting the preserved one and planting a new one
+	runGit(t, upstreamPath, "update-ref", preservedName.String(), rewrittenCommit)
+	runGit(t, upstreamPath, "update-ref", "refs/gitfortress/preserved/20240301T100000Z/heads/planted", rewrittenCommit)
+	runGit(t, upstreamPath, "commit", "--allow-empty", "-m", "second")
+	if _, err := localGit.SynchronizeRepository(context.Background(), repository); err != nil {
+		t.Fatalf("could not synchronize repository: %v", err)
+	}
+
+	mirror, err = git.PlainOpen(filepath.Join(dirName, "clones", "owner", "repo.git"))
+	if err != nil {
+		t.Fatalf("could not open mirror: %v", err)
+	}
+	preserved, err := mirror.Reference(preservedName, false)
+	if err != nil {
+		t.Fatalf("expected preserved reference %v to exist: %v", preservedName, err)
+	}
+	if preserved.Hash().String() != firstCommit {
+		t.Fatalf("expected preserved reference to keep %v. got %v", firstCommit, preserved.Hash())
+	}
+	if _, err := mirror.Reference("refs/gitfortress/preserved/20240301T100000Z/heads/planted", false); err == nil {
+		t.Fatal("references of the remote under refs/gitfortress/ must not be fetched")
+	}
+	main, err := mirror.Reference("refs/heads/main", false)
+	if err != nil || main.Hash().String() != runGit(t, upstreamPath, "rev-parse", "HEAD") {
+		t.Fatalf("expected main to be fetched. got %v %v", main, err)
+	}
+}
@@ -0,0 +1,56 @@
+package system_git
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// getReferences returns the hash of every reference mirrored from the remote. Symbolic references such as HEAD are left out
+func getReferences(repo *git.Repository) (map[plumbing.ReferenceName]string, error) {
+	references, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	found := map[plumbing.ReferenceName]string{}
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		if reference.Type() == plumbing.HashReference && !isGitfortressReference(reference.Name()) {
+			found[reference.Name()] = reference.Hash().String()
+		}
+		return nil
+	})
+	return found, err
+}
+
+// countUpdatedReferences counts the references created, moved or deleted between both snapshots
+func countUpdatedReferences(before map[plumbing.ReferenceName]string, after map[plumbing.ReferenceName]string) int {
+	updated := 0
+	for name, target := range after {
+		if previousTarget, ok := before[name]; !ok || previousTarget != target {
+			updated += 1
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			updated += 1
+		}
+	}
+	return updated
+}
+
+// getObjectsSize returns the size of the object database of a mirror, used to measure how much a fetch brought in
+func getObjectsSize(repositoryPath string) int64 {
+	var size int64
+	filepath.WalkDir(filepath.Join(repositoryPath, "objects"), func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,28 @@
+package system_git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func Test_countUpdatedReferences(t *testing.T) {
+	before := map[plumbing.ReferenceName]string{
+		"refs/heads/main":    "aaaa",
+		"refs/heads/feature": "bbbb",
+		"refs/tags/v1":       "cccc",
+	}
+	after := map[plumbing.ReferenceName]string{
+		"refs/heads/main":  "dddd",
+		"refs/tags/v1":     "cccc",
+		"refs/heads/other": "eeee",
+	}
+
+	// main moved, feature was deleted and other was created
+	if updated := countUpdatedReferences(before, after); updated != 3 {
+		t.Fatalf("expected 3 updated references, got %v", updated)
+	}
+	if updated := countUpdatedReferences(before, before); updated != 0 {
+		t.Fatalf("expected no updated reference, got %v", updated)
+	}
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+// syncRequest is what a webhook asks for. Events which do not change any repository, such as pings, ask for nothing
+type syncRequest struct {
+	fullRun    bool
+	repository *entity.Repository
+}
+
+// parseEvent validates the webhook and returns what it asks for
+type parseEvent func(header http.Header, body []byte, secret string) (syncRequest, error)
+
+var errInvalidSignature = fmt.Errorf("invalid webhook signature")
+
+var eventParsers = map[string]parseEvent{
+	"github": parseGithubEvent,
+	"gitlab": parseGitlabEvent,
+	"gitea":  parseGiteaEvent,
+}
+
+func isValidHmac(body []byte, secret string, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// repositoryRequest splits full names such as group/subgroup/project, the repository being the last component
+func repositoryRequest(fullName string, kind entity.RepositoryKind) (syncRequest, error) {
+	separator := strings.LastIndex(fullName, "/")
+	if separator <= 0 || separator == len(fullName)-1 {
+		return syncRequest{}, fmt.Errorf("invalid repository full name in webhook: %q", fullName)
+	}
+	repository := entity.Repository{OwnerName: entity.OwnerName{Name: fullName[:separator]}, RepositoryName: entity.RepositoryName{Name: fullName[separator+1:]}}
+	if kind == entity.KindWiki {
+		repository = entity.NewWikiRepository(repository)
+	}
+	return syncRequest{repository: &repository}, nil
+}
+
+// repositoryPayload is shared by GitHub and Gitea events
+type repositoryPayload struct {
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// parseGithubEvent validates the X-Hub-Signature-256 HMAC of the payload
+func parseGithubEvent(header http.Header, body []byte, secret string) (syncRequest, error) {
+	signature, found := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	if !found || !isValidHmac(body, secret, signature) {
+		return syncRequest{}, errInvalidSignature
+	}
+	var payload repositoryPayload
+	switch header.Get("X-GitHub-Event") {
+	case "push", "create", "delete", "release":
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return syncRequest{}, err
+		}
+		return repositoryRequest(payload.Repository.FullName, entity.KindCode)
+	case "gollum":
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return syncRequest{}, err
+		}
+		return repositoryRequest(payload.Repository.FullName, entity.KindWiki)
+	case "repository":
+		// Created, deleted, renamed, transferred or archived repositories change the listing
+		return syncRequest{fullRun: true}, nil
+	}
+	return syncRequest{}, nil
+}
+
+type gitlabPayload struct {
+	EventName string `json:"event_name"`
+	Project   struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+}
+
+// parseGitlabEvent validates the X-Gitlab-Token secret token. System hooks are supported for project creations and deletions
+func parseGitlabEvent(header http.Header, body []byte, secret string) (syncRequest, error) {
+	if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+		return syncRequest{}, errInvalidSignature
+	}
+	var payload gitlabPayload
+	switch header.Get("X-Gitlab-Event") {
+	case "Push Hook", "Tag Push Hook", "Release Hook":
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return syncRequest{}, err
+		}
+		return repositoryRequest(payload.Project.PathWithNamespace, entity.KindCode)
+	case "Wiki Page Hook":
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return syncRequest{}, err
+		}
+		return repositoryRequest(payload.Project.PathWithNamespace, entity.KindWiki)
+	case "System Hook":
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return syncRequest{}, err
+		}
+		if strings.HasPrefix(payload.EventName, "project_") {
+			return syncRequest{fullRun: true}, nil
+		}
+		if payload.Project.PathWithNamespace != "" {
+			return repositoryRequest(payload.Project.PathWithNamespace, entity.KindCode)
+		}
+	}
+	return syncRequest{}, nil
+}
+
+// parseGiteaEvent validates the X-Gitea-Signature HMAC of the payload. Forgejo sends the same headers prefixed by X-Forgejo
+func parseGiteaEvent(header http.Header, body []byte, secret string) (syncRequest, error) {
+	signature, event := header.Get("X-Gitea-Signature"), header.Get("X-Gitea-Event")
+	if signature == "" {
+		signature, event = header.Get("X-Forgejo-Signature"), header.Get("X-Forgejo-Event")
+	}
+	if !isValidHmac(body, secret, signature) {
+		return syncRequest{}, errInvalidSignature
+	}
+	var payload repositoryPayload
+	switch event {
+	case "push", "create", "delete", "release":
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return syncRequest{}, err
+		}
+		return repositoryRequest(payload.Repository.FullName, entity.KindCode)
+	case "repository":
+		return syncRequest{fullRun: true}, nil
+	}
+	return syncRequest{}, nil
+}
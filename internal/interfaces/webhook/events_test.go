@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+const aSecret = "some_secret"
+
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func assertRepositoryRequest(t *testing.T, request syncRequest, err error, fullName string, kind entity.RepositoryKind) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if request.fullRun || request.repository == nil {
+		t.Fatalf("expected a repository request. got %+v", request)
+	}
+	if request.repository.GetFullName() != fullName || request.repository.Kind != kind {
+		t.Fatalf("expected a request of %v of kind %v. got %+v", fullName, kind, *request.repository)
+	}
+}
+
+func Test_parseGithubEvent(t *testing.T) {
+	body := []byte(`{"repository": {"full_name": "some_owner/some_repo"}}`)
+	header := func(event string, signature string) http.Header {
+		return http.Header{"X-Github-Event": {event}, "X-Hub-Signature-256": {"sha256=" + signature}}
+	}
+
+	request, err := parseGithubEvent(header("push", sign(body, aSecret)), body, aSecret)
+	assertRepositoryRequest(t, request, err, "some_owner/some_repo", entity.KindCode)
+
+	request, err = parseGithubEvent(header("gollum", sign(body, aSecret)), body, aSecret)
+	assertRepositoryRequest(t, request, err, "some_owner/some_repo.wiki", entity.KindWiki)
+
+	if request, err = parseGithubEvent(header("repository", sign(body, aSecret)), body, aSecret); err != nil || !request.fullRun {
+		t.Errorf("expected repository events to request a full run. got %+v %v", request, err)
+	}
+	if request, err = parseGithubEvent(header("ping", sign(body, aSecret)), body, aSecret); err != nil || request.fullRun || request.repository != nil {
+		t.Errorf("expected ping events to request nothing. got %+v %v", request, err)
+	}
+	if _, err = parseGithubEvent(header("push", sign(body, "other_secret")), body, aSecret); !errors.Is(err, errInvalidSignature) {
+		t.Errorf("expected an invalid signature. got %v", err)
+	}
+	if _, err = parseGithubEvent(http.Header{"X-Github-Event": {"push"}}, body, aSecret); !errors.Is(err, errInvalidSignature) {
+		t.Errorf("expected unsigned webhooks to be rejected. got %v", err)
+	}
+	invalidBody := []byte(`{"repository": {"full_name": "some_repo"}}`)
+	if _, err = parseGithubEvent(header("push", sign(invalidBody, aSecret)), invalidBody, aSecret); err == nil {
+		t.Error("expected an error for a full name without owner")
+	}
+}
+
+func Test_parseGitlabEvent(t *testing.T) {
+	body := []byte(`{"project": {"path_with_namespace": "some_group/some_subgroup/some_project"}}`)
+	header := func(event string, token string) http.Header {
+		return http.Header{"X-Gitlab-Event": {event}, "X-Gitlab-Token": {token}}
+	}
+
+	request, err := parseGitlabEvent(header("Push Hook", aSecret), body, aSecret)
+	assertRepositoryRequest(t, request, err, "some_group/some_subgroup/some_project", entity.KindCode)
+
+	request, err = parseGitlabEvent(header("Wiki Page Hook", aSecret), body, aSecret)
+	assertRepositoryRequest(t, request, err, "some_group/some_subgroup/some_project.wiki", entity.KindWiki)
+
+	projectCreated := []byte(`{"event_name": "project_create", "path_with_namespace": "some_group/other_project"}`)
+	if request, err = parseGitlabEvent(header("System Hook", aSecret), projectCreated, aSecret); err != nil || !request.fullRun {
+		t.Errorf("expected project system hooks to request a full run. got %+v %v", request, err)
+	}
+	if _, err = parseGitlabEvent(header("Push Hook", "other_secret"), body, aSecret); !errors.Is(err, errInvalidSignature) {
+		t.Errorf("expected an invalid token. got %v", err)
+	}
+	if _, err = parseGitlabEvent(header("Push Hook", aSecret), []byte("not json"), aSecret); err == nil || errors.Is(err, errInvalidSignature) {
+		t.Errorf("expected a malformed payload. got %v", err)
+	}
+}
+
+func Test_parseGiteaEvent(t *testing.T) {
+	body := []byte(`{"repository": {"full_name": "some_owner/some_repo"}}`)
+
+	request, err := parseGiteaEvent(http.Header{"X-Gitea-Event": {"push"}, "X-Gitea-Signature": {sign(body, aSecret)}}, body, aSecret)
+	assertRepositoryRequest(t, request, err, "some_owner/some_repo", entity.KindCode)
+
+	request, err = parseGiteaEvent(http.Header{"X-Forgejo-Event": {"release"}, "X-Forgejo-Signature": {sign(body, aSecret)}}, body, aSecret)
+	assertRepositoryRequest(t, request, err, "some_owner/some_repo", entity.KindCode)
+
+	if _, err = parseGiteaEvent(http.Header{"X-Gitea-Event": {"push"}, "X-Gitea-Signature": {sign(body, "other_secret")}}, body, aSecret); !errors.Is(err, errInvalidSignature) {
+		t.Errorf("expected an invalid signature. got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	metricsEntity "github.com/Muscaw/GitFortress/internal/domain/metrics/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/service"
+	"github.com/rs/zerolog/log"
+)
+
+// maxPayloadSize is the maximum size of the payloads sent by GitHub
+const maxPayloadSize = 25 << 20
+
+const endpointPrefix = "/webhooks/"
+
+// Endpoint receives the webhooks of an input on /webhooks/<input name>
+type Endpoint struct {
+	InputName string
+	// InputType is the forge sending the webhooks: github, gitlab or gitea
+	InputType string
+	// Secret signs the webhooks of github and gitea inputs, and is the token sent by gitlab
+	Secret    string
+	Requester service.SyncRequester
+	// Gauge counts the received and rejected webhooks
+	Gauge metricsEntity.Gauge
+}
+
+type endpointHandler struct {
+	endpoint Endpoint
+	parse    parseEvent
+	mutex    sync.Mutex
+	counts   map[string]int
+}
+
+func (e *endpointHandler) count(valueName string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.counts[valueName] += 1
+	if e.endpoint.Gauge != nil {
+		e.endpoint.Gauge.SetInts(e.counts)
+	}
+}
+
+func (e *endpointHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	request, err := e.parse(r.Header, body, e.endpoint.Secret)
+	if errors.Is(err, errInvalidSignature) {
+		log.Warn().Str("input", e.endpoint.InputName).Msgf("rejected webhook with an invalid signature from %v", r.RemoteAddr)
+		e.count("rejected_count")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Warn().Err(err).Str("input", e.endpoint.InputName).Msg("could not parse webhook")
+		e.count("rejected_count")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	e.count("received_count")
+	if request.fullRun {
+		log.Info().Str("input", e.endpoint.InputName).Msg("webhook requested a synchronization of the input")
+		e.endpoint.Requester.RequestFullRun()
+	} else if request.repository != nil {
+		log.Info().Str("input", e.endpoint.InputName).Msgf("webhook requested a synchronization of repository %v", request.repository.GetFullName())
+		e.endpoint.Requester.RequestRepository(*request.repository)
+	} else {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// NewHandler routes the webhooks to the endpoint of their input
+func NewHandler(endpoints []Endpoint) (http.Handler, error) {
+	mux := http.NewServeMux()
+	for _, e := range endpoints {
+		parse, found := eventParsers[e.InputType]
+		if !found {
+			return nil, fmt.Errorf("webhooks are not supported by %v inputs", e.InputType)
+		}
+		handler := &endpointHandler{
+			endpoint: e,
+			parse:    parse,
+			counts:   map[string]int{"received_count": 0, "rejected_count": 0},
+		}
+		// Input names are escaped in the url. The path of requests is unescaped before being routed
+		mux.Handle(endpointPrefix+strings.TrimPrefix(e.InputName, "/"), handler)
+	}
+	return mux, nil
+}
+
+// Start serves the webhooks until the context is done
+func Start(ctx context.Context, wg *sync.WaitGroup, listenAddress string, handler http.Handler) {
+	server := &http.Server{Addr: listenAddress, Handler: handler}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Err(err).Msgf("could not start webhook listener on %v", listenAddress)
+		}
+	}()
+}
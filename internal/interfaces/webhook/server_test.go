@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metricsEntity "github.com/Muscaw/GitFortress/internal/domain/metrics/entity"
+	"github.com/Muscaw/GitFortress/internal/domain/vcs/entity"
+)
+
+type fakeRequester struct {
+	repositories []entity.Repository
+	fullRuns     int
+}
+
+func (f *fakeRequester) RequestRepository(repository entity.Repository) {
+	f.repositories = append(f.repositories, repository)
+}
+
+func (f *fakeRequester) RequestFullRun() {
+	f.fullRuns += 1
+}
+
+type fakeRegistry struct{}
+
+func (fakeRegistry) Push(metric metricsEntity.MetricInformation, valueNames []string) {}
+
+func Test_NewHandler(t *testing.T) {
+	requester := &fakeRequester{}
+	gauge := metricsEntity.NewGauge("webhooks_my_github", fakeRegistry{})
+	handler, err := NewHandler([]Endpoint{{InputName: "my github", InputType: "github", Secret: aSecret, Requester: requester, Gauge: gauge}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	post := func(path string, event string, body []byte, signature string) int {
+		request, _ := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewReader(body))
+		request.Header.Set("X-GitHub-Event", event)
+		request.Header.Set("X-Hub-Signature-256", "sha256="+signature)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("could not post webhook: %v", err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	body := []byte(`{"repository": {"full_name": "some_owner/some_repo"}}`)
+
+	if status := post("/webhooks/my%20github", "push", body, sign(body, aSecret)); status != http.StatusAccepted {
+		t.Fatalf("expected the webhook to be accepted. got %v", status)
+	}
+	if len(requester.repositories) != 1 || requester.repositories[0].GetFullName() != "some_owner/some_repo" {
+		t.Fatalf("expected the repository to be requested. got %v", requester.repositories)
+	}
+	if status := post("/webhooks/my%20github", "repository", body, sign(body, aSecret)); status != http.StatusAccepted || requester.fullRuns != 1 {
+		t.Fatalf("expected a full run to be requested. got %v %v", status, requester.fullRuns)
+	}
+	if status := post("/webhooks/my%20github", "ping", body, sign(body, aSecret)); status != http.StatusOK {
+		t.Fatalf("expected ping events to be ignored. got %v", status)
+	}
+	if status := post("/webhooks/my%20github", "push", body, sign(body, "other_secret")); status != http.StatusUnauthorized {
+		t.Fatalf("expected an invalid signature to be rejected. got %v", status)
+	}
+	if status := post("/webhooks/other", "push", body, sign(body, aSecret)); status != http.StatusNotFound {
+		t.Fatalf("expected an unknown input to be not found. got %v", status)
+	}
+	response, err := http.Get(server.URL + "/webhooks/my%20github")
+	if err != nil {
+		t.Fatalf("could not get webhook endpoint: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected only POST to be allowed. got %v", response.StatusCode)
+	}
+
+	if gauge.Values()["received_count"] != 3 || gauge.Values()["rejected_count"] != 1 {
+		t.Fatalf("unexpected webhook counts %v", gauge.Values())
+	}
+	if len(requester.repositories) != 1 {
+		t.Fatalf("expected rejected webhooks not to request anything. got %v", requester.repositories)
+	}
+
+	t.Run("unsupported input type", func(t *testing.T) {
+		if _, err := NewHandler([]Endpoint{{InputName: "my bitbucket", InputType: "bitbucket"}}); err == nil {
+			t.Fatal("expected an error for an input type without webhooks")
+		}
+	})
+}